@@ -0,0 +1,205 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/umgbhalla/gokv/api/grpc/kvrpc"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Error codes beyond those of the query engine.
+const (
+	codeUnavailable = "UNAVAILABLE"
+	codeLagged      = "WATCH_LAGGED"
+	codeCanceled    = "CANCELED"
+)
+
+var (
+	errShuttingDown = errors.New("server shutting down")
+	errLagged       = errors.New("watch fell behind and missed events; read the keys again and watch anew")
+	errInternal     = errors.New("internal error")
+)
+
+// statusCodes maps error codes to gRPC status codes.
+var statusCodes = map[string]codes.Code{
+	query.CodeParse:            codes.InvalidArgument,
+	query.CodeUnknownCommand:   codes.InvalidArgument,
+	query.CodeInvalidArgument:  codes.InvalidArgument,
+	query.CodeNotFound:         codes.NotFound,
+	query.CodeWrongType:        codes.FailedPrecondition,
+	query.CodeConflict:         codes.Aborted,
+	query.CodePermissionDenied: codes.PermissionDenied,
+	query.CodeTooLarge:         codes.ResourceExhausted,
+	query.CodeInternal:         codes.Internal,
+	auth.CodeUnauthenticated:   codes.Unauthenticated,
+	codeUnavailable:            codes.Unavailable,
+	codeLagged:                 codes.Aborted,
+	codeCanceled:               codes.Canceled,
+}
+
+// invalidf reports a malformed request.
+func invalidf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", query.ErrParse, fmt.Sprintf(format, args...))
+}
+
+// errorCode classifies err. Status errors come from grpc itself, such as
+// for a request that cannot be decoded or a cancelled stream.
+func errorCode(err error) string {
+	switch {
+	case errors.Is(err, auth.ErrNoCredentials), errors.Is(err, auth.ErrInvalidCredentials):
+		return auth.CodeUnauthenticated
+	case errors.Is(err, errShuttingDown):
+		return codeUnavailable
+	case errors.Is(err, errLagged):
+		return codeLagged
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return codeCanceled
+	}
+	if st, ok := status.FromError(err); ok {
+		switch st.Code() {
+		case codes.Canceled, codes.DeadlineExceeded:
+			return codeCanceled
+		case codes.InvalidArgument:
+			return query.CodeInvalidArgument
+		case codes.ResourceExhausted:
+			return query.CodeTooLarge
+		case codes.Unavailable:
+			return codeUnavailable
+		}
+	}
+	return query.ErrorCode(err)
+}
+
+// toStatus converts the error a call failed with, classified as code, into
+// a status error.
+func toStatus(err error, code string) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	return status.Error(statusCodes[code], err.Error())
+}
+
+// methodName is the last element of a full method name, such as Get.
+func methodName(fullMethod string) string {
+	return fullMethod[strings.LastIndexByte(fullMethod, '/')+1:]
+}
+
+// authenticate checks the credentials of the call in ctx and returns a
+// context carrying its principal.
+func (s *Server) authenticate(ctx context.Context) (context.Context, error) {
+	if s.authn == nil {
+		return ctx, nil
+	}
+	r := &http.Request{Header: http.Header{}}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, v := range md.Get("authorization") {
+		r.Header.Add("Authorization", v)
+	}
+	for _, v := range md.Get(strings.ToLower(auth.APIKeyHeader)) {
+		r.Header.Add(auth.APIKeyHeader, v)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if info, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			r.TLS = &info.State
+		}
+	}
+	p, err := s.authn.Authenticate(r)
+	if err != nil {
+		return nil, err
+	}
+	return auth.NewContext(ctx, p), nil
+}
+
+// queryFor returns the query a call runs through: on behalf of its
+// principal, attributed to its peer, on the database its metadata selects.
+func (s *Server) queryFor(ctx context.Context) (*query.Query, error) {
+	q := s.query
+	if p, ok := auth.FromContext(ctx); ok {
+		q = q.WithPrincipal(p)
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		q = q.WithClient(p.Addr.String())
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if dbs := md.Get(kvrpc.MetadataDB); len(dbs) > 0 && dbs[len(dbs)-1] != "" {
+		return q.Select(dbs[len(dbs)-1])
+	}
+	return q, nil
+}
+
+// recovered turns a panic in a call into an internal error, so that it
+// fails only that call.
+func recovered(method string, err *error) {
+	if p := recover(); p != nil {
+		slog.Error("grpc call panicked", "method", method, "panic", p, "stack", string(debug.Stack()))
+		*err = errInternal
+	}
+}
+
+func (s *Server) unaryInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (resp interface{}, err error) {
+	start := time.Now()
+	method := methodName(info.FullMethod)
+	defer func() {
+		code := codeOK
+		if err != nil {
+			code = errorCode(err)
+			err = toStatus(err, code)
+			grpc.SetTrailer(ctx, metadata.Pairs(kvrpc.MetadataCode, code))
+		}
+		observeCall(method, code, start)
+	}()
+	defer recovered(method, &err)
+
+	authed, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return handler(authed, req)
+}
+
+func (s *Server) streamInterceptor(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) (err error) {
+	start := time.Now()
+	method := methodName(info.FullMethod)
+	activeStreams.Inc()
+	defer func() {
+		activeStreams.Dec()
+		code := codeOK
+		if err != nil {
+			code = errorCode(err)
+			err = toStatus(err, code)
+			ss.SetTrailer(metadata.Pairs(kvrpc.MetadataCode, code))
+		}
+		observeCall(method, code, start)
+	}()
+	defer recovered(method, &err)
+
+	ctx, err := s.authenticate(ss.Context())
+	if err != nil {
+		return err
+	}
+	return handler(srv, &authenticatedStream{ss, ctx})
+}
+
+// authenticatedStream carries the principal in its context.
+type authenticatedStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *authenticatedStream) Context() context.Context {
+	return s.ctx
+}
@@ -0,0 +1,18 @@
+// Package kvrpc defines the gRPC service gokv.v1.KV, served by api/grpc.
+// The messages and stubs are generated from kv.proto; regenerate them with
+// go generate after changing it, which needs protoc, protoc-gen-go and
+// protoc-gen-go-grpc on the PATH.
+package kvrpc
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative --go-grpc_out=../../.. --go-grpc_opt=paths=source_relative api/grpc/kvrpc/kv.proto
+
+// Metadata keys read by the server. Credentials are sent as on HTTP, in
+// "authorization" as a bearer token or in "x-api-key".
+const (
+	// MetadataDB selects the logical database of a call. The default
+	// database is used without it.
+	MetadataDB = "gokv-db"
+	// MetadataCode is the trailer holding the error code, such as
+	// NOT_FOUND, of a failed call.
+	MetadataCode = "gokv-code"
+)
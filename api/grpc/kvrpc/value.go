@@ -0,0 +1,35 @@
+package kvrpc
+
+import (
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// NewValue converts a value of the store's data model, as from
+// AsInterface, into a Value. A []byte is binary data; anything else is a
+// JSON document, converted as by structpb.NewValue.
+func NewValue(v interface{}) (*Value, error) {
+	if b, ok := v.([]byte); ok {
+		return &Value{Kind: &Value_Binary{Binary: b}}, nil
+	}
+	json, err := structpb.NewValue(v)
+	if err != nil {
+		return nil, err
+	}
+	return &Value{Kind: &Value_Json{Json: json}}, nil
+}
+
+// AsInterface converts x into the store's data model: []byte for binary
+// data, never nil, and otherwise the document as by
+// structpb.Value.AsInterface. A nil Value, or one without a kind, is nil.
+func (x *Value) AsInterface() interface{} {
+	switch k := x.GetKind().(type) {
+	case *Value_Binary:
+		if k.Binary == nil {
+			return []byte{}
+		}
+		return k.Binary
+	case *Value_Json:
+		return k.Json.AsInterface()
+	}
+	return nil
+}
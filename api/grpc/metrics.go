@@ -0,0 +1,26 @@
+package grpc
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+const codeOK = "OK"
+
+var (
+	activeConnections = metrics.Default.NewGauge("gokv_grpc_connections",
+		"Open gRPC connections.")
+	activeStreams = metrics.Default.NewGauge("gokv_grpc_streams",
+		"Open gRPC Watch and Txn streams.")
+	callsTotal = metrics.Default.NewCounterVec("gokv_grpc_calls_total",
+		"gRPC calls handled, by method and result code.", "method", "code")
+	callDuration = metrics.Default.NewHistogramVec("gokv_grpc_call_duration_seconds",
+		"Time spent handling gRPC calls, for streams from open to close.", nil, "method")
+)
+
+// observeCall records one call of method, such as Get or Watch.
+func observeCall(method, code string, start time.Time) {
+	callsTotal.With(method, code).Inc()
+	callDuration.With(method).Since(start)
+}
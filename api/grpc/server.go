@@ -0,0 +1,194 @@
+// Package grpc serves the key space as the gRPC service gokv.v1.KV, for
+// internal services that want typed calls and streams instead of JSON over
+// HTTP. The service is defined in api/grpc/kvrpc/kv.proto, with stubs
+// generated into package kvrpc, and pkg/client has a client for it. The
+// server reflection service is registered too, for tools such as grpcurl.
+//
+// Calls are authenticated as HTTP requests are, from the "authorization"
+// or "x-api-key" metadata or a verified TLS client certificate, and run
+// through the same query engine, ACL and limits.
+package grpc
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/umgbhalla/gokv/api/grpc/kvrpc"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/stats"
+)
+
+// defaultMaxRequestSize bounds a request message when no limit is set.
+const defaultMaxRequestSize = 512 << 20
+
+// ErrServerClosed is returned by Start and StartTLS after Shutdown.
+var ErrServerClosed = errors.New("grpc: server closed")
+
+// Server serves the KV service.
+type Server struct {
+	query     *query.Query
+	authn     auth.Authenticator
+	listening chan struct{}
+	listened  sync.Once
+	// closing is closed by Shutdown to end watches and idle transactions,
+	// which would otherwise hold a graceful stop open.
+	closing chan struct{}
+	clients atomic.Int64
+
+	maxRequestSize int
+
+	mu     sync.Mutex
+	server *grpc.Server
+	addr   net.Addr
+	closed bool
+}
+
+func NewServer(query *query.Query) *Server {
+	return &Server{
+		query:     query,
+		listening: make(chan struct{}),
+		closing:   make(chan struct{}),
+	}
+}
+
+func (s *Server) Start(addr string) error {
+	return s.start(addr)
+}
+
+// StartTLS is like Start but requires TLS using cfg, which must provide the
+// certificate.
+func (s *Server) StartTLS(addr string, cfg *tls.Config) error {
+	return s.start(addr, grpc.Creds(credentials.NewTLS(cfg)))
+}
+
+func (s *Server) start(addr string, opts ...grpc.ServerOption) error {
+	// Whatever happens, nothing is left waiting on Listening.
+	defer s.signalListening()
+
+	maxRequestSize := s.maxRequestSize
+	if maxRequestSize <= 0 {
+		maxRequestSize = defaultMaxRequestSize
+	}
+	opts = append(opts,
+		grpc.MaxRecvMsgSize(maxRequestSize),
+		grpc.StatsHandler(connStats{s}),
+		grpc.ChainUnaryInterceptor(s.unaryInterceptor),
+		grpc.ChainStreamInterceptor(s.streamInterceptor),
+	)
+	srv := grpc.NewServer(opts...)
+	kvrpc.RegisterKVServer(srv, &service{s: s})
+	reflection.Register(srv)
+
+	// The address is bound under the lock so that Shutdown either comes
+	// first or finds the server to stop.
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrServerClosed
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		s.mu.Unlock()
+		return err
+	}
+	s.server, s.addr = srv, ln.Addr()
+	s.mu.Unlock()
+
+	s.signalListening()
+	if err := srv.Serve(ln); err != nil && err != grpc.ErrServerStopped {
+		return err
+	}
+	return ErrServerClosed
+}
+
+// Listening is closed once the server has bound its address, or once
+// Start or StartTLS has failed to; Addr tells the two apart.
+func (s *Server) Listening() <-chan struct{} {
+	return s.listening
+}
+
+func (s *Server) signalListening() {
+	s.listened.Do(func() { close(s.listening) })
+}
+
+// Addr returns the address the server is bound to, or nil if it has not
+// bound one.
+func (s *Server) Addr() net.Addr {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.addr
+}
+
+// UseAuthenticator requires every call to be authenticated by a.
+func (s *Server) UseAuthenticator(a auth.Authenticator) {
+	s.authn = a
+}
+
+// SetMaxRequestSize bounds a request message, in bytes. Zero means the
+// default of 512MiB.
+func (s *Server) SetMaxRequestSize(n int) {
+	s.maxRequestSize = n
+}
+
+// Clients returns the number of open connections.
+func (s *Server) Clients() int {
+	return int(s.clients.Load())
+}
+
+// Shutdown stops accepting connections, ends every watch and every
+// transaction stream not in the middle of a transaction, and waits for the
+// other calls to finish. Calls still running when ctx is done are
+// cancelled.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.closing)
+	}
+	srv := s.server
+	s.mu.Unlock()
+	if srv == nil {
+		return nil
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		srv.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		srv.Stop()
+		return ctx.Err()
+	}
+}
+
+// connStats counts connections.
+type connStats struct {
+	s *Server
+}
+
+func (h connStats) TagRPC(ctx context.Context, _ *stats.RPCTagInfo) context.Context   { return ctx }
+func (h connStats) HandleRPC(context.Context, stats.RPCStats)                         {}
+func (h connStats) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+
+func (h connStats) HandleConn(_ context.Context, st stats.ConnStats) {
+	switch st.(type) {
+	case *stats.ConnBegin:
+		h.s.clients.Add(1)
+		activeConnections.Inc()
+	case *stats.ConnEnd:
+		h.s.clients.Add(-1)
+		activeConnections.Dec()
+	}
+}
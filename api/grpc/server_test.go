@@ -0,0 +1,322 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/api/grpc/kvrpc"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// tokenAuth accepts the bearer token "secret".
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Principal{Name: "app"}, nil
+}
+
+// serve starts s on a free port and returns a connection to it.
+func serve(t *testing.T, s *Server) *grpc.ClientConn {
+	t.Helper()
+	errc := make(chan error, 1)
+	go func() { errc <- s.Start("127.0.0.1:0") }()
+	<-s.Listening()
+	if s.Addr() == nil {
+		t.Fatalf("not listening: %v", <-errc)
+	}
+	conn, err := grpc.NewClient(s.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+		s.Shutdown(context.Background())
+		if err := <-errc; err != ErrServerClosed {
+			t.Errorf("Start = %v, want ErrServerClosed", err)
+		}
+	})
+	return conn
+}
+
+func newServer() *Server {
+	return NewServer(query.New(store.NewDatabases(0, 0)))
+}
+
+func jsonValue(t *testing.T, v interface{}) *kvrpc.Value {
+	t.Helper()
+	value, err := kvrpc.NewValue(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return value
+}
+
+// expectCode checks that err is a status with code c and, if trailer is
+// given, that the server classified it as code.
+func expectCode(t *testing.T, err error, c codes.Code, trailer metadata.MD, code string) {
+	t.Helper()
+	if status.Code(err) != c {
+		t.Fatalf("err = %v, want %v", err, c)
+	}
+	if trailer != nil {
+		if got := trailer.Get(kvrpc.MetadataCode); len(got) != 1 || got[0] != code {
+			t.Fatalf("code = %q, want %q", got, code)
+		}
+	}
+}
+
+func TestStartFailureSignalsListening(t *testing.T) {
+	taken, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer taken.Close()
+
+	s := newServer()
+	if err := s.Start(taken.Addr().String()); err == nil {
+		t.Fatal("Start on a taken address succeeded")
+	}
+	select {
+	case <-s.Listening():
+	default:
+		t.Fatal("Listening not closed after Start failed")
+	}
+	if s.Addr() != nil || s.server != nil {
+		t.Fatalf("failed Start left addr %v, server %v", s.Addr(), s.server)
+	}
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStartAfterShutdown(t *testing.T) {
+	s := newServer()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start("127.0.0.1:0"); err != ErrServerClosed {
+		t.Fatalf("Start = %v, want ErrServerClosed", err)
+	}
+	<-s.Listening()
+	if s.Addr() != nil {
+		t.Fatalf("addr = %v after Shutdown", s.Addr())
+	}
+}
+
+func TestGetSetDelete(t *testing.T) {
+	kv := kvrpc.NewKVClient(serve(t, newServer()))
+	ctx := context.Background()
+
+	doc := map[string]interface{}{"name": "ada", "tags": []interface{}{"a", 1.5, nil}}
+	set, err := kv.Set(ctx, &kvrpc.SetRequest{Key: "user:1", Value: jsonValue(t, doc), Ttl: durationpb.New(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := kv.Get(ctx, &kvrpc.GetRequest{Key: "user:1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(e.Value.AsInterface()) != fmt.Sprint(doc) || e.Version != set.Version || e.ExpiresAt == nil {
+		t.Fatalf("entry = %v, want %v at version %d, expiring", e, doc, set.Version)
+	}
+
+	_, err = kv.Set(ctx, &kvrpc.SetRequest{Key: "img", Value: &kvrpc.Value{Kind: &kvrpc.Value_Binary{Binary: []byte{1, 2}}, ContentType: "image/png"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e, err := kv.Get(ctx, &kvrpc.GetRequest{Key: "img"}); err != nil || string(e.Value.GetBinary()) != "\x01\x02" || e.Value.ContentType != "image/png" {
+		t.Fatalf("binary entry = %v, %v", e, err)
+	}
+
+	var trailer metadata.MD
+	stale := set.Version + 1
+	_, err = kv.Set(ctx, &kvrpc.SetRequest{Key: "user:1", Value: jsonValue(t, 1.0), IfVersion: &stale}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.Aborted, trailer, query.CodeConflict)
+
+	_, err = kv.Set(ctx, &kvrpc.SetRequest{Key: "user:1", Value: jsonValue(t, 1.0), Ttl: durationpb.New(-time.Second)}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.InvalidArgument, trailer, query.CodeParse)
+
+	_, err = kv.Set(ctx, &kvrpc.SetRequest{Key: "k", Value: &kvrpc.Value{Kind: &kvrpc.Value_Json{Json: structpb.NewStringValue("x")}, ContentType: "text/plain"}})
+	expectCode(t, err, codes.InvalidArgument, nil, "")
+
+	del, err := kv.Delete(ctx, &kvrpc.DeleteRequest{Key: "user:1"})
+	if err != nil || !del.Deleted {
+		t.Fatalf("delete = %v, %v", del, err)
+	}
+	_, err = kv.Get(ctx, &kvrpc.GetRequest{Key: "user:1"}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.NotFound, trailer, query.CodeNotFound)
+}
+
+func TestBatch(t *testing.T) {
+	kv := kvrpc.NewKVClient(serve(t, newServer()))
+
+	resp, err := kv.Batch(context.Background(), &kvrpc.BatchRequest{Ops: []*kvrpc.Op{
+		{Op: &kvrpc.Op_Set{Set: &kvrpc.SetRequest{Key: "a", Value: jsonValue(t, "x")}}},
+		{Op: &kvrpc.Op_Get{Get: &kvrpc.GetRequest{Key: "a"}}},
+		{Op: &kvrpc.Op_Get{Get: &kvrpc.GetRequest{Key: "missing"}}},
+		{Op: &kvrpc.Op_Commit{Commit: &kvrpc.Commit{}}},
+		{},
+		{Op: &kvrpc.Op_Delete{Delete: &kvrpc.DeleteRequest{Key: "a"}}},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := resp.Results
+	if len(r) != 6 {
+		t.Fatalf("%d results, want 6", len(r))
+	}
+	if r[0].GetSet().GetVersion() == 0 || r[1].GetEntry().GetValue().AsInterface() != "x" || !r[5].GetDelete().GetDeleted() {
+		t.Fatalf("results = %v", r)
+	}
+	for i, code := range map[int]string{2: query.CodeNotFound, 3: query.CodeParse, 4: query.CodeParse} {
+		if r[i].GetError().GetCode() != code {
+			t.Errorf("result %d = %v, want %s", i, r[i], code)
+		}
+	}
+}
+
+func TestWatch(t *testing.T) {
+	kv := kvrpc.NewKVClient(serve(t, newServer()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := kv.Watch(ctx, &kvrpc.WatchRequest{Match: "user:*:name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"user:1:age", "user:1:name"} {
+		if _, err := kv.Set(ctx, &kvrpc.SetRequest{Key: key, Value: jsonValue(t, "v")}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := kv.Delete(ctx, &kvrpc.DeleteRequest{Key: "user:1:name"}); err != nil {
+		t.Fatal(err)
+	}
+	e, err := stream.Recv()
+	if err != nil || e.Type != kvrpc.EventType_EVENT_TYPE_SET || e.Key != "user:1:name" || e.Entry.GetValue().AsInterface() != "v" {
+		t.Fatalf("event = %v, %v", e, err)
+	}
+	e, err = stream.Recv()
+	if err != nil || e.Type != kvrpc.EventType_EVENT_TYPE_DELETE || e.Key != "user:1:name" || e.Entry != nil {
+		t.Fatalf("event = %v, %v", e, err)
+	}
+
+	bad, err := kv.Watch(ctx, &kvrpc.WatchRequest{Match: "a*", Regex: "^a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = bad.Recv()
+	expectCode(t, err, codes.InvalidArgument, bad.Trailer(), query.CodeParse)
+}
+
+func TestTxn(t *testing.T) {
+	kv := kvrpc.NewKVClient(serve(t, newServer()))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := kv.Set(ctx, &kvrpc.SetRequest{Key: "n", Value: jsonValue(t, 1.0)}); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := kv.Txn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	do := func(op *kvrpc.Op) *kvrpc.Result {
+		t.Helper()
+		if err := stream.Send(op); err != nil {
+			t.Fatal(err)
+		}
+		res, err := stream.Recv()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+	get := &kvrpc.Op{Op: &kvrpc.Op_Get{Get: &kvrpc.GetRequest{Key: "n"}}}
+	set := &kvrpc.Op{Op: &kvrpc.Op_Set{Set: &kvrpc.SetRequest{Key: "n", Value: jsonValue(t, 2.0)}}}
+	commit := &kvrpc.Op{Op: &kvrpc.Op_Commit{Commit: &kvrpc.Commit{}}}
+
+	// A transaction reads its own writes and commits them.
+	if res := do(get); res.GetEntry().GetValue().AsInterface() != 1.0 {
+		t.Fatalf("get = %v", res)
+	}
+	do(set)
+	if res := do(get); res.GetEntry().GetValue().AsInterface() != 2.0 {
+		t.Fatalf("get after set = %v", res)
+	}
+	if res := do(commit); res.GetError() != nil {
+		t.Fatalf("commit = %v", res)
+	}
+	if e, err := kv.Get(ctx, &kvrpc.GetRequest{Key: "n"}); err != nil || e.Value.AsInterface() != 2.0 {
+		t.Fatalf("after commit: %v, %v", e, err)
+	}
+
+	// A key read changing before the commit fails it.
+	do(get)
+	if _, err := kv.Set(ctx, &kvrpc.SetRequest{Key: "n", Value: jsonValue(t, 3.0)}); err != nil {
+		t.Fatal(err)
+	}
+	do(set)
+	if res := do(commit); res.GetError().GetCode() != query.CodeConflict {
+		t.Fatalf("commit = %v, want CONFLICT", res)
+	}
+	if err := stream.CloseSend(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAuthentication(t *testing.T) {
+	s := newServer()
+	s.UseAuthenticator(tokenAuth{})
+	kv := kvrpc.NewKVClient(serve(t, s))
+
+	var trailer metadata.MD
+	_, err := kv.Get(context.Background(), &kvrpc.GetRequest{Key: "k"}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.Unauthenticated, trailer, auth.CodeUnauthenticated)
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Bearer secret")
+	_, err = kv.Get(ctx, &kvrpc.GetRequest{Key: "k"}, grpc.Trailer(&trailer))
+	expectCode(t, err, codes.NotFound, trailer, query.CodeNotFound)
+}
+
+func TestReflection(t *testing.T) {
+	conn := serve(t, newServer())
+	stream, err := reflectionpb.NewServerReflectionClient(conn).ServerReflectionInfo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.CloseSend()
+	err = stream.Send(&reflectionpb.ServerReflectionRequest{
+		MessageRequest: &reflectionpb.ServerReflectionRequest_FileContainingSymbol{FileContainingSymbol: "gokv.v1.KV"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := stream.Recv()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.GetFileDescriptorResponse() == nil {
+		t.Fatalf("response = %v, want the descriptor of gokv.v1.KV", res)
+	}
+}
@@ -0,0 +1,421 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/umgbhalla/gokv/api/grpc/kvrpc"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// service implements kvrpc.KVServer.
+type service struct {
+	kvrpc.UnimplementedKVServer
+	s *Server
+}
+
+func (svc *service) Get(ctx context.Context, req *kvrpc.GetRequest) (*kvrpc.Entry, error) {
+	res, err := svc.run(ctx, &kvrpc.Op{Op: &kvrpc.Op_Get{Get: req}})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetEntry(), nil
+}
+
+func (svc *service) Set(ctx context.Context, req *kvrpc.SetRequest) (*kvrpc.SetResponse, error) {
+	res, err := svc.run(ctx, &kvrpc.Op{Op: &kvrpc.Op_Set{Set: req}})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetSet(), nil
+}
+
+func (svc *service) Delete(ctx context.Context, req *kvrpc.DeleteRequest) (*kvrpc.DeleteResponse, error) {
+	res, err := svc.run(ctx, &kvrpc.Op{Op: &kvrpc.Op_Delete{Delete: req}})
+	if err != nil {
+		return nil, err
+	}
+	return res.GetDelete(), nil
+}
+
+func (svc *service) run(ctx context.Context, op *kvrpc.Op) (*kvrpc.Result, error) {
+	q, err := svc.s.queryFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return apply(q, op)
+}
+
+func (svc *service) Batch(ctx context.Context, req *kvrpc.BatchRequest) (*kvrpc.BatchResponse, error) {
+	q, err := svc.s.queryFor(ctx)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]*kvrpc.Result, len(req.Ops))
+	for i, op := range req.Ops {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		res, err := apply(q, op)
+		if err != nil {
+			res = failed(err)
+		}
+		results[i] = res
+	}
+	return &kvrpc.BatchResponse{Results: results}, nil
+}
+
+func (svc *service) Watch(req *kvrpc.WatchRequest, stream grpc.ServerStreamingServer[kvrpc.WatchEvent]) error {
+	ctx := stream.Context()
+	q, err := svc.s.queryFor(ctx)
+	if err != nil {
+		return err
+	}
+	var m *query.Matcher
+	switch {
+	case req.Match != "" && req.Regex != "":
+		return invalidf("match and regex are exclusive")
+	case req.Match != "":
+		m, err = query.CompileGlob(req.Match)
+	case req.Regex != "":
+		m, err = query.CompileRegex(req.Regex)
+	}
+	if err != nil {
+		return err
+	}
+	w, err := q.Watch(req.Prefix, m)
+	if err != nil {
+		return err
+	}
+	defer w.Stop()
+	// The headers tell the client that every later change will be sent.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case e, ok := <-w.Events():
+			if !ok {
+				// Only a lagging watcher is closed while the call runs.
+				return errLagged
+			}
+			event := &kvrpc.WatchEvent{Type: eventTypes[e.Type], Key: e.Key}
+			if e.Type == store.EventSet {
+				if event.Entry, err = entry(e.Value); err != nil {
+					return err
+				}
+			}
+			if err := stream.Send(event); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-svc.s.closing:
+			return errShuttingDown
+		}
+	}
+}
+
+var eventTypes = map[store.EventType]kvrpc.EventType{
+	store.EventSet:    kvrpc.EventType_EVENT_TYPE_SET,
+	store.EventDelete: kvrpc.EventType_EVENT_TYPE_DELETE,
+	store.EventExpire: kvrpc.EventType_EVENT_TYPE_EXPIRE,
+}
+
+func (svc *service) Txn(stream grpc.BidiStreamingServer[kvrpc.Op, kvrpc.Result]) error {
+	ctx := stream.Context()
+	q, err := svc.s.queryFor(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Ops are received apart, so that shutting down can end a stream
+	// waiting for the next one.
+	ops := make(chan *kvrpc.Op)
+	recvErr := make(chan error, 1)
+	go func() {
+		for {
+			op, err := stream.Recv()
+			if err != nil {
+				recvErr <- err
+				return
+			}
+			select {
+			case ops <- op:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	t := &txn{q: q}
+	closing := svc.s.closing
+	for {
+		select {
+		case op := <-ops:
+			if err := stream.Send(t.step(op)); err != nil {
+				return err
+			}
+			if closing == nil && !t.open() {
+				return errShuttingDown
+			}
+		case err := <-recvErr:
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		case <-closing:
+			if !t.open() {
+				return errShuttingDown
+			}
+			// Let the client finish the transaction it has begun.
+			closing = nil
+		}
+	}
+}
+
+// txn is the transaction in progress on a Txn stream.
+type txn struct {
+	q *query.Query
+	// reads holds the version each key was read at, zero if it did not
+	// exist, and the version set and delete ops require.
+	reads  map[string]uint64
+	writes []query.TxnWrite
+	// pending indexes the last write of each key in writes.
+	pending map[string]int
+}
+
+func (t *txn) open() bool {
+	return len(t.reads) > 0 || len(t.writes) > 0
+}
+
+func (t *txn) reset() {
+	t.reads, t.writes, t.pending = nil, nil, nil
+}
+
+func (t *txn) step(op *kvrpc.Op) *kvrpc.Result {
+	res, err := t.apply(op)
+	if err != nil {
+		return failed(err)
+	}
+	return res
+}
+
+func (t *txn) apply(op *kvrpc.Op) (*kvrpc.Result, error) {
+	switch o := op.Op.(type) {
+	case *kvrpc.Op_Get:
+		key := o.Get.GetKey()
+		if err := validateKey("get", key); err != nil {
+			return nil, err
+		}
+		if i, ok := t.pending[key]; ok {
+			if t.writes[i].Delete {
+				return nil, query.ErrNotFound
+			}
+			return entryResult(t.writes[i].Value)
+		}
+		v, err := t.q.GetValue(key)
+		if err != nil && !errors.Is(err, query.ErrNotFound) {
+			return nil, err
+		}
+		if conflict := t.expect(key, v.Version); conflict != nil {
+			return nil, conflict
+		}
+		if err != nil {
+			return nil, err
+		}
+		return entryResult(v)
+	case *kvrpc.Op_Set:
+		w, err := setWrite(o.Set)
+		if err != nil {
+			return nil, err
+		}
+		return t.write(w, o.Set.IfVersion)
+	case *kvrpc.Op_Delete:
+		w, err := deleteWrite(o.Delete)
+		if err != nil {
+			return nil, err
+		}
+		return t.write(w, o.Delete.IfVersion)
+	case *kvrpc.Op_Commit:
+		defer t.reset()
+		if err := t.q.Commit(t.reads, t.writes); err != nil {
+			return nil, err
+		}
+		return &kvrpc.Result{}, nil
+	case *kvrpc.Op_Rollback:
+		t.reset()
+		return &kvrpc.Result{}, nil
+	}
+	return nil, errEmptyOp
+}
+
+// write holds w back until the transaction commits, requiring its key to
+// be at version then, if given.
+func (t *txn) write(w query.TxnWrite, version *uint64) (*kvrpc.Result, error) {
+	if version != nil {
+		if err := t.expect(w.Key, *version); err != nil {
+			return nil, err
+		}
+	}
+	if t.pending == nil {
+		t.pending = make(map[string]int)
+	}
+	t.pending[w.Key] = len(t.writes)
+	t.writes = append(t.writes, w)
+	return &kvrpc.Result{}, nil
+}
+
+// expect records that key must be at version when the transaction commits.
+// Expecting two versions of a key dooms the transaction, which fails at
+// once.
+func (t *txn) expect(key string, version uint64) error {
+	if v, ok := t.reads[key]; ok {
+		if v != version {
+			return query.ErrConflict
+		}
+		return nil
+	}
+	if t.reads == nil {
+		t.reads = make(map[string]uint64)
+	}
+	t.reads[key] = version
+	return nil
+}
+
+// errEmptyOp is the error of an Op without an operation.
+var errEmptyOp = invalidf("op has no operation")
+
+// apply runs op on its own.
+func apply(q *query.Query, op *kvrpc.Op) (*kvrpc.Result, error) {
+	switch o := op.Op.(type) {
+	case *kvrpc.Op_Get:
+		key := o.Get.GetKey()
+		if err := validateKey("get", key); err != nil {
+			return nil, err
+		}
+		v, err := q.GetValue(key)
+		if err != nil {
+			return nil, err
+		}
+		return entryResult(v)
+	case *kvrpc.Op_Set:
+		w, err := setWrite(o.Set)
+		if err != nil {
+			return nil, err
+		}
+		stored, err := q.Update(w.Key, func(current store.Value, exists bool) (store.Value, error) {
+			if !matches(o.Set.IfVersion, current, exists) {
+				return store.Value{}, query.ErrConflict
+			}
+			return w.Value, nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &kvrpc.Result{Result: &kvrpc.Result_Set{Set: &kvrpc.SetResponse{Version: stored.Version}}}, nil
+	case *kvrpc.Op_Delete:
+		w, err := deleteWrite(o.Delete)
+		if err != nil {
+			return nil, err
+		}
+		var deleted bool
+		err = q.DeleteIf(w.Key, func(current store.Value, exists bool) error {
+			if !matches(o.Delete.IfVersion, current, exists) {
+				return query.ErrConflict
+			}
+			deleted = exists
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return &kvrpc.Result{Result: &kvrpc.Result_Delete{Delete: &kvrpc.DeleteResponse{Deleted: deleted}}}, nil
+	case *kvrpc.Op_Commit, *kvrpc.Op_Rollback:
+		return nil, invalidf("commit and rollback are only allowed in a transaction")
+	}
+	return nil, errEmptyOp
+}
+
+// matches reports whether the current entry is at the version required, if
+// any.
+func matches(version *uint64, current store.Value, exists bool) bool {
+	switch {
+	case version == nil:
+		return true
+	case !exists:
+		return *version == 0
+	}
+	return current.Version == *version
+}
+
+func validateKey(op, key string) error {
+	if key == "" {
+		return invalidf("%s requires a key", op)
+	}
+	return nil
+}
+
+// setWrite checks a set request and converts it into a write.
+func setWrite(req *kvrpc.SetRequest) (query.TxnWrite, error) {
+	if err := validateKey("set", req.GetKey()); err != nil {
+		return query.TxnWrite{}, err
+	}
+	var ttl time.Duration
+	if req.Ttl != nil {
+		if err := req.Ttl.CheckValid(); err != nil || req.Ttl.AsDuration() < 0 {
+			return query.TxnWrite{}, invalidf("ttl must be a non-negative duration")
+		}
+		// A TTL past the range of time.Duration is cut to its maximum.
+		ttl = req.Ttl.AsDuration()
+	}
+	value := req.GetValue().AsInterface()
+	contentType := req.GetValue().GetContentType()
+	if _, binary := value.([]byte); contentType != "" && !binary {
+		return query.TxnWrite{}, invalidf("content_type is only allowed with a binary value")
+	}
+	return query.TxnWrite{Key: req.GetKey(), Value: store.Value{
+		Data: value, ContentType: contentType, ExpiresAt: store.ExpiresIn(ttl),
+	}}, nil
+}
+
+// deleteWrite checks a delete request and converts it into a write.
+func deleteWrite(req *kvrpc.DeleteRequest) (query.TxnWrite, error) {
+	if err := validateKey("delete", req.GetKey()); err != nil {
+		return query.TxnWrite{}, err
+	}
+	return query.TxnWrite{Key: req.GetKey(), Delete: true}, nil
+}
+
+func entry(v store.Value) (*kvrpc.Entry, error) {
+	value, err := kvrpc.NewValue(v.Data)
+	if err != nil {
+		return nil, err
+	}
+	value.ContentType = v.ContentType
+	e := &kvrpc.Entry{Value: value, Version: v.Version}
+	if !v.ExpiresAt.IsZero() {
+		e.ExpiresAt = timestamppb.New(v.ExpiresAt)
+	}
+	return e, nil
+}
+
+func entryResult(v store.Value) (*kvrpc.Result, error) {
+	e, err := entry(v)
+	if err != nil {
+		return nil, err
+	}
+	return &kvrpc.Result{Result: &kvrpc.Result_Entry{Entry: e}}, nil
+}
+
+// failed is the result of an op that failed with err.
+func failed(err error) *kvrpc.Result {
+	return &kvrpc.Result{Result: &kvrpc.Result_Error{Error: &kvrpc.Error{Code: errorCode(err), Message: err.Error()}}}
+}
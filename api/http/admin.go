@@ -0,0 +1,120 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// setupAdminRoutes registers the server statistics, slowlog and ACL
+// management APIs, which require permission to run the INFO, SLOWLOG and ACL
+// commands respectively.
+func (s *Server) setupAdminRoutes() {
+	admin := s.router.PathPrefix("/admin").Subrouter()
+	admin.HandleFunc("/whoami", s.handleWhoAmI).Methods("GET")
+	admin.HandleFunc("/stats", s.handleStats).Methods("GET")
+	admin.HandleFunc("/slowlog", s.handleSlowlog).Methods("GET")
+	admin.HandleFunc("/slowlog", s.handleResetSlowlog).Methods("DELETE")
+	admin.HandleFunc("/acl/users", s.handleACLUsers).Methods("GET")
+	admin.HandleFunc("/acl/users/{name}", s.handleACLUser).Methods("GET")
+	admin.HandleFunc("/acl/users/{name}", s.handleSetACLUser).Methods("PUT")
+	admin.HandleFunc("/acl/users/{name}", s.handleDeleteACLUser).Methods("DELETE")
+}
+
+func (s *Server) handleWhoAmI(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, r, s.principal(r).Principal(), http.StatusOK)
+}
+
+func (s *Server) handleStats(w http.ResponseWriter, r *http.Request) {
+	info, err := s.principal(r).Info()
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, info, http.StatusOK)
+}
+
+// handleSlowlog returns the slowest recent commands, newest first, limited
+// by the optional count parameter.
+func (s *Server) handleSlowlog(w http.ResponseWriter, r *http.Request) {
+	count := 0
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			s.errorResponse(w, r, "count must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		count = n
+	}
+	entries, err := s.principal(r).Slowlog(count)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, entries, http.StatusOK)
+}
+
+func (s *Server) handleResetSlowlog(w http.ResponseWriter, r *http.Request) {
+	if err := s.principal(r).ResetSlowlog(); err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleACLUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := s.principal(r).ACLUsers()
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, users, http.StatusOK)
+}
+
+func (s *Server) handleACLUser(w http.ResponseWriter, r *http.Request) {
+	user, err := s.principal(r).ACLUser(pathVar(r, "name"))
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, user, http.StatusOK)
+}
+
+// handleSetACLUser replaces the user's rules with the body, which is either
+// {"rules": [...]} or a bare list of rules.
+func (s *Server) handleSetACLUser(w http.ResponseWriter, r *http.Request) {
+	var decoded interface{}
+	c, err := decodeBody(r, &decoded)
+	if err != nil {
+		s.legacyBodyError(w, r, c, err)
+		return
+	}
+	body, err := json.Marshal(decoded)
+	if err != nil {
+		s.legacyBodyError(w, r, c, err)
+		return
+	}
+	user := query.ACLUser{Name: pathVar(r, "name")}
+	if err := json.Unmarshal(body, &user.Rules); err != nil {
+		if err := json.Unmarshal(body, &user); err != nil {
+			s.errorResponse(w, r, "Invalid rules", http.StatusBadRequest)
+			return
+		}
+		user.Name = pathVar(r, "name")
+	}
+	if err := s.principal(r).SetACLUser(user); err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, user, http.StatusOK)
+}
+
+func (s *Server) handleDeleteACLUser(w http.ResponseWriter, r *http.Request) {
+	if err := s.principal(r).DeleteACLUser(pathVar(r, "name")); err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,126 @@
+package http
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// octetStream is the media type of binary values stored without one.
+const octetStream = "application/octet-stream"
+
+// isRawBody reports whether a PUT body is stored as bytes rather than
+// decoded: any valid Content-Type that no codec reads, such as image/png or
+// application/octet-stream.
+func isRawBody(r *http.Request) bool {
+	header := r.Header.Get("Content-Type")
+	if _, _, err := mime.ParseMediaType(header); err != nil {
+		return false
+	}
+	_, decodable := codec.ForContentType(header)
+	return !decodable
+}
+
+// readRawValue reads a binary value. A body longer than the value limit is
+// refused before it is read, and one over the chunking threshold is read
+// straight into chunks rather than a single buffer.
+func (s *Server) readRawValue(q *query.Query, r *http.Request) (interface{}, error) {
+	limit := q.Limits().MaxValueSize
+	tooLarge := fmt.Errorf("%w: value exceeds the limit of %d bytes", query.ErrTooLarge, limit)
+	if limit > 0 && r.ContentLength > limit {
+		return nil, tooLarge
+	}
+	var body io.Reader = r.Body
+	if limit > 0 {
+		body = io.LimitReader(r.Body, limit+1)
+	}
+
+	var data interface{}
+	var size int64
+	if s.chunkThreshold > 0 && (r.ContentLength < 0 || r.ContentLength > s.chunkThreshold) {
+		chunks, err := store.ReadChunks(body, s.chunkSize)
+		if err != nil {
+			return nil, err
+		}
+		data, size = chunks, chunks.Size()
+		if size <= s.chunkThreshold {
+			data = chunks.Bytes()
+		}
+	} else {
+		buf, err := readBody(body, r.ContentLength)
+		if err != nil {
+			return nil, err
+		}
+		data, size = buf, int64(len(buf))
+	}
+	if limit > 0 && size > limit {
+		return nil, tooLarge
+	}
+	return data, nil
+}
+
+// readBody reads r into a single buffer, sized up front when the length is
+// known.
+func readBody(r io.Reader, length int64) ([]byte, error) {
+	if length < 0 {
+		return io.ReadAll(r)
+	}
+	buf := make([]byte, length)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
+
+// rawRepresentation returns the bytes and media type to answer a GET with
+// instead of an encoded value: those of a binary value stored with a content
+// type, or of any binary value when the client accepts
+// application/octet-stream.
+func rawRepresentation(r *http.Request, v store.Value) (io.ReadSeeker, string, bool) {
+	var content io.ReadSeeker
+	switch data := v.Data.(type) {
+	case []byte:
+		content = bytes.NewReader(data)
+	case *store.Chunks:
+		content = data.NewReader()
+	default:
+		return nil, "", false
+	}
+	switch {
+	case v.ContentType != "":
+		return content, v.ContentType, true
+	case acceptsOctetStream(r.Header.Get("Accept")):
+		return content, octetStream, true
+	}
+	return nil, "", false
+}
+
+func acceptsOctetStream(accept string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil || mediaType != octetStream {
+			continue
+		}
+		if q, err := strconv.ParseFloat(params["q"], 64); err == nil && q == 0 {
+			return false
+		}
+		return true
+	}
+	return false
+}
+
+// writeRaw answers with content as is, honouring Range and If-Range.
+// Validators have been set and the other preconditions already checked.
+func writeRaw(w http.ResponseWriter, r *http.Request, v store.Value, content io.ReadSeeker, contentType string) {
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Add("Vary", "Accept")
+	http.ServeContent(w, r, "", v.ModifiedAt, content)
+}
@@ -0,0 +1,95 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// errUnsupportedMediaType is returned by decodeBody for a Content-Type no
+// codec reads.
+var errUnsupportedMediaType = errors.New("unsupported media type")
+
+// responseCodec encodes the response to r as its Accept header asks. When
+// no codec is acceptable the header is disregarded, as RFC 9110 allows, and
+// the response is JSON.
+func responseCodec(r *http.Request) codec.Codec {
+	if c, ok := codec.Negotiate(r.Header.Get("Accept")); ok {
+		return c
+	}
+	return codec.JSON
+}
+
+// decodeBody reads the request body into v with the codec its Content-Type
+// names. A request without a Content-Type is taken to be JSON.
+func decodeBody(r *http.Request, v interface{}) (codec.Codec, error) {
+	c, ok := codec.ForContentType(r.Header.Get("Content-Type"))
+	if !ok {
+		return nil, errUnsupportedMediaType
+	}
+	return c, c.Decode(r.Body, v)
+}
+
+// bodyError answers a /v1 request whose body could not be read or decoded
+// with c.
+func (s *Server) bodyError(w http.ResponseWriter, r *http.Request, c codec.Codec, err error) {
+	if errorCode(err) == query.CodeTooLarge {
+		s.problemError(w, r, err)
+		return
+	}
+	if c == nil {
+		s.problemResponse(w, r, http.StatusBadRequest, query.CodeInvalidArgument, "could not read request body")
+		return
+	}
+	if errors.Is(err, errUnsupportedMediaType) {
+		s.problemResponse(w, r, http.StatusUnsupportedMediaType, query.CodeInvalidArgument,
+			"unsupported Content-Type "+r.Header.Get("Content-Type"))
+		return
+	}
+	s.problemResponse(w, r, http.StatusBadRequest, query.CodeInvalidArgument, "request body is not valid "+formatName(c))
+}
+
+// legacyBodyError is bodyError for the legacy and admin routes.
+func (s *Server) legacyBodyError(w http.ResponseWriter, r *http.Request, c codec.Codec, err error) {
+	if errorCode(err) == query.CodeTooLarge {
+		s.queryError(w, r, err)
+		return
+	}
+	if errors.Is(err, errUnsupportedMediaType) {
+		s.errorResponse(w, r, "Unsupported Content-Type", http.StatusUnsupportedMediaType)
+		return
+	}
+	s.errorResponse(w, r, "Invalid "+formatName(c), http.StatusBadRequest)
+}
+
+func formatName(c codec.Codec) string {
+	switch c {
+	case codec.MessagePack:
+		return "MessagePack"
+	case codec.CBOR:
+		return "CBOR"
+	}
+	return "JSON"
+}
+
+// respond encodes data with the codec the request accepts. A Content-Type
+// already set, such as application/problem+json, is kept.
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, data interface{}, status int) {
+	c := responseCodec(r)
+	body, err := c.Marshal(data)
+	if err != nil {
+		c, status = codec.JSON, http.StatusInternalServerError
+		body, _ = c.Marshal(map[string]string{"error": err.Error(), "code": query.CodeInternal})
+	}
+	if !c.Binary() {
+		body = append(body, '\n')
+	}
+	if w.Header().Get("Content-Type") == "" || err != nil {
+		w.Header().Set("Content-Type", c.ContentType())
+	}
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(body)
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+const codePreconditionFailed = "PRECONDITION_FAILED"
+
+var errPreconditionFailed = errors.New("precondition failed")
+
+func statusFor(code string) int {
+	switch code {
+	case query.CodeParse, query.CodeUnknownCommand, query.CodeInvalidArgument:
+		return http.StatusBadRequest
+	case query.CodePermissionDenied:
+		return http.StatusForbidden
+	case query.CodeNotFound:
+		return http.StatusNotFound
+	case query.CodeConflict:
+		return http.StatusConflict
+	case query.CodeWrongType:
+		return http.StatusUnprocessableEntity
+	case codePreconditionFailed:
+		return http.StatusPreconditionFailed
+	case query.CodeTooLarge:
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusInternalServerError
+}
+
+func errorCode(err error) string {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.Is(err, errPreconditionFailed):
+		return codePreconditionFailed
+	case errors.As(err, &tooLarge):
+		return query.CodeTooLarge
+	}
+	return query.ErrorCode(err)
+}
+
+// queryError answers a failed operation on the legacy routes with
+// {"error": ..., "code": ...} and the status matching its code.
+func (s *Server) queryError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCode(err)
+	s.respond(w, r, map[string]string{"error": err.Error(), "code": code}, statusFor(code))
+}
+
+// problemError is queryError for the /v1 routes.
+func (s *Server) problemError(w http.ResponseWriter, r *http.Request, err error) {
+	code := errorCode(err)
+	s.problemResponse(w, r, statusFor(code), code, err.Error())
+}
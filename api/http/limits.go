@@ -0,0 +1,42 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// SetMaxRequestSize makes requests with a body over n bytes fail with 413
+// Content Too Large. Zero means no limit. Keys and values are limited by
+// query.Limits.
+func (s *Server) SetMaxRequestSize(n int64) {
+	s.maxRequestSize = n
+}
+
+// SetChunking stores binary values over threshold bytes as pieces of
+// chunkSize bytes, see store.Chunks. A zero threshold, the default, stores
+// every value whole.
+func (s *Server) SetChunking(threshold int64, chunkSize int) {
+	if chunkSize <= 0 {
+		chunkSize = store.DefaultChunkSize
+	}
+	s.chunkThreshold, s.chunkSize = threshold, chunkSize
+}
+
+// limitBody refuses a request whose declared length is over the limit and
+// stops reading any other body once it passes it.
+func (s *Server) limitBody(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if max := s.maxRequestSize; max > 0 {
+			if r.ContentLength > max {
+				detail := fmt.Sprintf("request body is %d bytes, the limit is %d", r.ContentLength, max)
+				s.problemResponse(w, r, http.StatusRequestEntityTooLarge, query.CodeTooLarge, detail)
+				return
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, max)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
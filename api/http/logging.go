@@ -0,0 +1,20 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/umgbhalla/gokv/internal/logging"
+)
+
+// requestID tags each request with the client's X-Request-ID, when usable,
+// or a new one, and echoes it in the response.
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(logging.RequestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(logging.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
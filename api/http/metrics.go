@@ -0,0 +1,82 @@
+package http
+
+import (
+	"bufio"
+	"errors"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/umgbhalla/gokv/internal/logging"
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+var (
+	httpRequests = metrics.Default.NewCounterVec("gokv_http_requests_total",
+		"HTTP requests served, by route template, method and status code.", "route", "method", "code")
+	httpDuration = metrics.Default.NewHistogramVec("gokv_http_request_duration_seconds",
+		"Time spent serving HTTP requests.", nil, "route", "method")
+)
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.bytes += n
+	return n, err
+}
+
+// Hijack lets WebSocket upgrades through the recorder. The status is
+// reported as 101 Switching Protocols.
+func (r *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := r.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("response does not support hijacking")
+	}
+	r.status = http.StatusSwitchingProtocols
+	return h.Hijack()
+}
+
+// instrument records the count and latency of requests per route and
+// writes the access log. Routes are labelled by template, such as
+// /v1/keys/{key:.+}, not by path.
+func instrument(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tpl, err := current.GetPathTemplate(); err == nil {
+				route = tpl
+			}
+		}
+		httpRequests.With(route, r.Method, strconv.Itoa(rec.status)).Inc()
+		httpDuration.With(route, r.Method).Since(start)
+
+		attrs := []slog.Attr{
+			slog.String("request_id", logging.RequestID(r.Context())),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.Path),
+			slog.String("route", route),
+			slog.Int("status", rec.status),
+			slog.Int("bytes", rec.bytes),
+			slog.Duration("duration", time.Since(start)),
+			slog.String("remote", r.RemoteAddr),
+		}
+		slog.LogAttrs(r.Context(), slog.LevelInfo, "http request", attrs...)
+	})
+}
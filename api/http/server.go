@@ -2,79 +2,214 @@ package http
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/health"
+	"github.com/umgbhalla/gokv/internal/metrics"
 	"github.com/umgbhalla/gokv/internal/query"
-	"github.com/umgbhalla/gokv/internal/store"
 )
 
 type Server struct {
-	store  *store.Store
-	query  *query.Query
-	router *mux.Router
-	server *http.Server
+	query     *query.Query
+	router    *mux.Router
+	server    *http.Server
+	listening chan struct{}
+	readiness *health.Readiness
+	websocket bool
+
+	maxRequestSize int64
+	chunkThreshold int64
+	chunkSize      int
 }
 
-func NewServer(store *store.Store, query *query.Query) *Server {
+func NewServer(query *query.Query) *Server {
 	s := &Server{
-		store:  store,
 		query:  query,
-		router: mux.NewRouter(),
+		// Keys may contain '/' or '%2F', so match on the raw path and
+		// unescape variables with pathVar.
+		router:    mux.NewRouter().UseEncodedPath().SkipClean(true),
+		listening: make(chan struct{}),
 	}
+	// Registered first so that it also sees requests refused by later
+	// middleware, such as authentication.
+	s.router.Use(instrument)
+	s.router.Use(s.limitBody)
 	s.setupRoutes()
+	s.setupV1Routes()
+	s.setupAdminRoutes()
 	return s
 }
 
 func (s *Server) Start(addr string) error {
 	s.server = &http.Server{
 		Addr:    addr,
-		Handler: s.router,
+		Handler: s.handler(),
+	}
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(ln)
+}
+
+// StartTLS is like Start but serves HTTPS with cfg, which must provide the
+// certificate.
+func (s *Server) StartTLS(addr string, cfg *tls.Config) error {
+	s.server = &http.Server{
+		Addr:      addr,
+		Handler:   s.handler(),
+		TLSConfig: cfg,
+	}
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.server.ServeTLS(ln, "", "")
+}
+
+// handler wraps the router so that every response, including those for
+// unknown routes, carries a request ID.
+func (s *Server) handler() http.Handler {
+	return requestID(s.router)
+}
+
+func (s *Server) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
 	}
-	return s.server.ListenAndServe()
+	close(s.listening)
+	return ln, nil
 }
 
+// Listening is closed once the server has bound its address.
+func (s *Server) Listening() <-chan struct{} {
+	return s.listening
+}
+
+// SetReadiness makes /readyz report r.
+func (s *Server) SetReadiness(r *health.Readiness) {
+	s.readiness = r
+}
+
+// Shutdown stops accepting requests and waits for those in flight until
+// ctx is done. Upgraded WebSocket connections are not waited for; they
+// belong to the WebSocket server.
 func (s *Server) Shutdown(ctx context.Context) error {
+	if s.server == nil {
+		return nil
+	}
 	return s.server.Shutdown(ctx)
 }
 
+// MountWebSocket serves the WebSocket endpoint h on /ws, so that one port
+// serves both APIs. h authenticates connections itself.
+func (s *Server) MountWebSocket(h http.Handler) {
+	s.router.Handle("/ws", h).Methods("GET")
+	s.websocket = true
+}
+
+// UseAuthenticator requires every route but the health probes and the
+// WebSocket endpoint to be authenticated by a. The principal is available to
+// handlers through auth.FromContext.
+func (s *Server) UseAuthenticator(a auth.Authenticator) {
+	authenticate := auth.Middleware(a)
+	s.router.Use(func(next http.Handler) http.Handler {
+		authenticated := authenticate(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" || (s.websocket && r.URL.Path == "/ws") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			authenticated.ServeHTTP(w, r)
+		})
+	})
+}
+
 func (s *Server) Router() *mux.Router {
 	return s.router
 }
 
 func (s *Server) setupRoutes() {
-	s.router.HandleFunc("/get/{key}", s.handleGet).Methods("GET")
-	s.router.HandleFunc("/set", s.handleSet).Methods("POST")
-	s.router.HandleFunc("/delete/{key}", s.handleDelete).Methods("DELETE")
-	s.router.HandleFunc("/query", s.handleQuery).Methods("GET")
+	// Keyspace routes are served both for the default database and, under
+	// /db/{db}, for any named one.
+	for _, r := range []*mux.Router{s.router, s.router.PathPrefix("/db/{db}").Subrouter()} {
+		r.HandleFunc("/get/{key}", deprecated(s.handleGet)).Methods("GET")
+		r.HandleFunc("/set", deprecated(s.handleSet)).Methods("POST")
+		r.HandleFunc("/delete/{key}", deprecated(s.handleDelete)).Methods("DELETE")
+		r.HandleFunc("/query", s.handleQuery).Methods("GET")
+		r.HandleFunc("/keys", s.handleKeys).Methods("GET")
+	}
+	s.router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	s.router.HandleFunc("/healthz", s.handleHealthz).Methods("GET", "HEAD")
+	s.router.HandleFunc("/readyz", s.handleReadyz).Methods("GET", "HEAD")
+	s.router.HandleFunc("/jobs", s.handleJobs).Methods("GET")
+	s.router.HandleFunc("/jobs/{id}", s.handleJob).Methods("GET")
+}
+
+// principal returns the Query acting for the request's authenticated
+// principal, if any.
+func (s *Server) principal(r *http.Request) *query.Query {
+	p, _ := auth.FromContext(r.Context())
+	return s.query.WithPrincipal(p).WithClient(r.RemoteAddr)
+}
+
+// database returns the Query for the database named in the path, or the
+// default database when there is none.
+func (s *Server) database(r *http.Request) (*query.Query, error) {
+	q := s.principal(r)
+	if _, ok := mux.Vars(r)["db"]; !ok {
+		return q, nil
+	}
+	return q.Select(pathVar(r, "db"))
 }
 
 func (s *Server) handleGet(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
-	value, ok := s.store.Get(key)
+	q, err := s.database(r)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	value, err := q.Get(key)
 
-	if !ok {
-		s.errorResponse(w, "Key not found", http.StatusNotFound)
+	if err != nil {
+		s.queryError(w, r, err)
 		return
 	}
-	s.jsonResponse(w, map[string]interface{}{"value": value}, http.StatusOK)
+	s.respond(w, r, map[string]interface{}{"value": value}, http.StatusOK)
 }
 
 func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
-	var data map[string]interface{}
-	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
-		s.errorResponse(w, "Invalid JSON", http.StatusBadRequest)
+	q, err := s.database(r)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	var body interface{}
+	c, err := decodeBody(r, &body)
+	if err != nil {
+		s.legacyBodyError(w, r, c, err)
+		return
+	}
+	data, ok := body.(map[string]interface{})
+	if !ok {
+		s.errorResponse(w, r, "Invalid "+formatName(c), http.StatusBadRequest)
 		return
 	}
 
 	key, ok := data["key"].(string)
 	if !ok {
-		s.errorResponse(w, "Invalid key", http.StatusBadRequest)
+		s.errorResponse(w, r, "Invalid key", http.StatusBadRequest)
 		return
 	}
+	linkSuccessor(w, r, key)
 
 	value := data["value"]
 	ttl := time.Duration(0)
@@ -82,46 +217,118 @@ func (s *Server) handleSet(w http.ResponseWriter, r *http.Request) {
 		ttl = time.Duration(ttlSeconds) * time.Second
 	}
 
-	if err := s.store.Set(key, value, ttl); err != nil {
-		s.errorResponse(w, "Error setting value", http.StatusInternalServerError)
+	if err := q.Set(key, value, ttl); err != nil {
+		s.queryError(w, r, err)
 		return
 	}
 
-	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+	s.respond(w, r, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
 func (s *Server) handleDelete(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	key := vars["key"]
-	if err := s.store.Delete(key); err != nil {
-		s.errorResponse(w, "Error deleting key", http.StatusInternalServerError)
+	q, err := s.database(r)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	if err := q.Delete(key); err != nil {
+		s.queryError(w, r, err)
 		return
 	}
-	s.jsonResponse(w, map[string]string{"status": "ok"}, http.StatusOK)
+	s.respond(w, r, map[string]string{"status": "ok"}, http.StatusOK)
 }
 
 func (s *Server) handleQuery(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
 	queryString := r.URL.Query().Get("q")
 	if queryString == "" {
-		s.errorResponse(w, "Missing query parameter", http.StatusBadRequest)
+		s.errorResponse(w, r, "Missing query parameter", http.StatusBadRequest)
+		return
+	}
+
+	result, err := q.Execute(queryString)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+
+	s.respond(w, r, result, http.StatusOK)
+}
+
+func (s *Server) handleKeys(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	params := r.URL.Query()
+	limit := 0
+	if raw := params.Get("limit"); raw != "" {
+		n, err := strconv.Atoi(raw)
+		if err != nil || n < 0 {
+			s.errorResponse(w, r, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	var m *query.Matcher
+	switch {
+	case params.Get("match") != "":
+		m, err = query.CompileGlob(params.Get("match"))
+	case params.Get("regex") != "":
+		m, err = query.CompileRegex(params.Get("regex"))
+	}
+	if err != nil {
+		s.queryError(w, r, err)
 		return
 	}
 
-	result, err := s.query.Execute(queryString)
+	page, err := q.ScanMatch(params.Get("prefix"), m, params.Get("cursor"), limit)
 	if err != nil {
-		s.errorResponse(w, "Error executing query", http.StatusInternalServerError)
+		s.queryError(w, r, err)
 		return
 	}
+	s.respond(w, r, page, http.StatusOK)
+}
 
-	s.jsonResponse(w, result, http.StatusOK)
+func (s *Server) handleJobs(w http.ResponseWriter, r *http.Request) {
+	jobs, err := s.principal(r).Jobs()
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, jobs, http.StatusOK)
 }
 
-func (s *Server) jsonResponse(w http.ResponseWriter, data interface{}, status int) {
-	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(status)
-	json.NewEncoder(w).Encode(data)
+func (s *Server) handleJob(w http.ResponseWriter, r *http.Request) {
+	job, err := s.principal(r).Job(pathVar(r, "id"))
+	if err != nil {
+		s.queryError(w, r, err)
+		return
+	}
+	s.respond(w, r, job, http.StatusOK)
+}
+
+// handleHealthz reports that the process is up and serving requests.
+func (s *Server) handleHealthz(w http.ResponseWriter, r *http.Request) {
+	s.respond(w, r, map[string]string{"status": "ok"}, http.StatusOK)
+}
+
+// handleReadyz fails with 503 until every component has started.
+func (s *Server) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	if s.readiness != nil && !s.readiness.Ready() {
+		s.respond(w, r, map[string]interface{}{"status": "starting", "pending": s.readiness.Pending()}, http.StatusServiceUnavailable)
+		return
+	}
+	s.respond(w, r, map[string]string{"status": "ready"}, http.StatusOK)
 }
 
-func (s *Server) errorResponse(w http.ResponseWriter, message string, status int) {
-	s.jsonResponse(w, map[string]string{"error": message}, status)
+func (s *Server) errorResponse(w http.ResponseWriter, r *http.Request, message string, status int) {
+	s.respond(w, r, map[string]string{"error": message}, status)
 }
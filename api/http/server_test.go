@@ -0,0 +1,95 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// principalFor authenticates every request as the principal it names.
+type principalFor string
+
+func (p principalFor) Authenticate(*http.Request) (*auth.Principal, error) {
+	return &auth.Principal{Name: string(p)}, nil
+}
+
+func TestLegacyRoutesMapQueryErrors(t *testing.T) {
+	acl, err := query.LoadACL(filepath.Join(t.TempDir(), "acl.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = acl.SetUser(query.ACLUser{Name: "reader", Rules: []query.ACLRule{{Commands: []string{"@read"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := query.New(store.NewDatabases(0, 0))
+	q.SetACL(acl)
+	s := NewServer(q)
+	s.UseAuthenticator(principalFor("reader"))
+
+	tests := []struct {
+		method, path, body string
+		status             int
+		code               string
+	}{
+		{"POST", "/set", `{"key": "a", "value": 1}`, http.StatusForbidden, query.CodePermissionDenied},
+		{"DELETE", "/delete/a", "", http.StatusForbidden, query.CodePermissionDenied},
+		{"GET", "/get/a", "", http.StatusNotFound, query.CodeNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.handler().ServeHTTP(w, r)
+			if w.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.status, w.Body)
+			}
+			var body map[string]string
+			if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+				t.Fatal(err)
+			}
+			if body["code"] != tt.code {
+				t.Errorf("code = %q, want %q", body["code"], tt.code)
+			}
+		})
+	}
+}
+
+func TestLegacyRoutesLinkSuccessor(t *testing.T) {
+	s := NewServer(query.New(store.NewDatabases(0, 0)))
+	tests := []struct {
+		method, path, body string
+		link               string
+	}{
+		{"POST", "/set", `{"key": "a b/c", "value": 1}`, `</v1/keys/a%20b%2Fc>; rel="successor-version"`},
+		{"GET", "/get/a%20b%2Fc", "", `</v1/keys/a%20b%2Fc>; rel="successor-version"`},
+		{"DELETE", "/delete/a", "", `</v1/keys/a>; rel="successor-version"`},
+		{"GET", "/db/1/get/a", "", `</v1/db/1/keys/a>; rel="successor-version"`},
+		{"POST", "/db/1/set", `{"key": "a", "value": 1}`, `</v1/db/1/keys/a>; rel="successor-version"`},
+		// Without a key there is nothing to link.
+		{"POST", "/set", `{"value": 1}`, ""},
+		{"POST", "/set", `not json`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			r.Header.Set("Content-Type", "application/json")
+			w := httptest.NewRecorder()
+			s.handler().ServeHTTP(w, r)
+			if got := w.Header().Get("Deprecation"); got != "true" {
+				t.Errorf("Deprecation = %q, want true", got)
+			}
+			if got := w.Header().Get("Link"); got != tt.link {
+				t.Errorf("Link = %q, want %q", got, tt.link)
+			}
+		})
+	}
+}
@@ -0,0 +1,379 @@
+package http
+
+import (
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// TTLHeader sets the time to live of a value on PUT and PATCH, as a number
+// of seconds or a duration such as 90s. The ttl query parameter takes the
+// same values.
+const TTLHeader = "X-Gokv-TTL"
+
+func (s *Server) setupV1Routes() {
+	v1 := s.router.PathPrefix("/v1").Subrouter()
+	for _, r := range []*mux.Router{v1, v1.PathPrefix("/db/{db}").Subrouter()} {
+		r.HandleFunc("/keys/{key:.+}", s.handleV1Get).Methods("GET", "HEAD")
+		r.HandleFunc("/keys/{key:.+}", s.handleV1Put).Methods("PUT")
+		r.HandleFunc("/keys/{key:.+}", s.handleV1Patch).Methods("PATCH")
+		r.HandleFunc("/keys/{key:.+}", s.handleV1Delete).Methods("DELETE")
+	}
+}
+
+func (s *Server) handleV1Get(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	value, err := q.GetValue(key)
+	exists := err == nil
+
+	if status := checkReadPreconditions(r, value, exists); status != 0 {
+		if status == http.StatusNotModified {
+			writeValidators(w, value)
+			w.WriteHeader(status)
+			return
+		}
+		s.problemError(w, r, errPreconditionFailed)
+		return
+	}
+	if !exists {
+		s.problemError(w, r, store.ErrNotFound)
+		return
+	}
+
+	writeValidators(w, value)
+	if content, contentType, ok := rawRepresentation(r, value); ok {
+		writeRaw(w, r, value, content, contentType)
+		return
+	}
+	s.respond(w, r, value.Data, http.StatusOK)
+}
+
+// handleV1Put stores the body decoded, or as raw bytes with its media type
+// when the Content-Type is not one the codecs read.
+func (s *Server) handleV1Put(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	ttl, _, err := requestTTL(r)
+	if err != nil {
+		s.problemResponse(w, r, http.StatusBadRequest, query.CodeInvalidArgument, err.Error())
+		return
+	}
+	var data interface{}
+	var contentType string
+	if isRawBody(r) {
+		data, err = s.readRawValue(q, r)
+		if err != nil {
+			s.bodyError(w, r, nil, err)
+			return
+		}
+		contentType = r.Header.Get("Content-Type")
+	} else if c, err := decodeBody(r, &data); err != nil {
+		s.bodyError(w, r, c, err)
+		return
+	}
+
+	created := false
+	value, err := q.Update(key, func(current store.Value, exists bool) (store.Value, error) {
+		if !checkWritePreconditions(r, current, exists) {
+			return store.Value{}, errPreconditionFailed
+		}
+		created = !exists
+		return store.Value{Data: data, ContentType: contentType, ExpiresAt: store.ExpiresIn(ttl)}, nil
+	})
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+
+	writeValidators(w, value)
+	if created {
+		w.Header().Set("Location", r.URL.Path)
+		w.WriteHeader(http.StatusCreated)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleV1Patch applies a JSON merge patch (RFC 7396) to the stored value.
+// The expiry is kept unless the request sets a new TTL.
+func (s *Server) handleV1Patch(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	ttl, ttlSet, err := requestTTL(r)
+	if err != nil {
+		s.problemResponse(w, r, http.StatusBadRequest, query.CodeInvalidArgument, err.Error())
+		return
+	}
+	var patch interface{}
+	if c, err := decodeBody(r, &patch); err != nil {
+		s.bodyError(w, r, c, err)
+		return
+	}
+
+	value, err := q.Update(key, func(current store.Value, exists bool) (store.Value, error) {
+		if !exists {
+			return store.Value{}, store.ErrNotFound
+		}
+		if !checkWritePreconditions(r, current, exists) {
+			return store.Value{}, errPreconditionFailed
+		}
+		if _, isObject := patch.(map[string]interface{}); isObject {
+			if _, ok := current.Data.(map[string]interface{}); !ok {
+				return store.Value{}, store.ErrWrongType
+			}
+		}
+		next := store.Value{Data: mergePatch(current.Data, patch), ExpiresAt: current.ExpiresAt}
+		if ttlSet {
+			next.ExpiresAt = store.ExpiresIn(ttl)
+		}
+		return next, nil
+	})
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+
+	writeValidators(w, value)
+	s.respond(w, r, value.Data, http.StatusOK)
+}
+
+func (s *Server) handleV1Delete(w http.ResponseWriter, r *http.Request) {
+	q, err := s.database(r)
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+	key := pathVar(r, "key")
+	err = q.DeleteIf(key, func(current store.Value, exists bool) error {
+		if !exists {
+			return store.ErrNotFound
+		}
+		if !checkWritePreconditions(r, current, exists) {
+			return errPreconditionFailed
+		}
+		return nil
+	})
+	if err != nil {
+		s.problemError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func pathVar(r *http.Request, name string) string {
+	raw := mux.Vars(r)[name]
+	if v, err := url.PathUnescape(raw); err == nil {
+		return v
+	}
+	return raw
+}
+
+// maxTTLSeconds is the longest TTL, in seconds, a time.Duration holds.
+const maxTTLSeconds = float64(math.MaxInt64 / int64(time.Second))
+
+func requestTTL(r *http.Request) (time.Duration, bool, error) {
+	raw := r.URL.Query().Get("ttl")
+	if raw == "" {
+		raw = r.Header.Get(TTLHeader)
+	}
+	if raw == "" {
+		return 0, false, nil
+	}
+	if seconds, err := strconv.ParseFloat(raw, 64); err == nil {
+		if seconds < 0 {
+			return 0, false, fmt.Errorf("invalid TTL %q: must not be negative", raw)
+		}
+		if !(seconds <= maxTTLSeconds) {
+			return 0, false, fmt.Errorf("invalid TTL %q", raw)
+		}
+		return time.Duration(seconds * float64(time.Second)), true, nil
+	}
+	d, err := time.ParseDuration(raw)
+	if err != nil {
+		return 0, false, fmt.Errorf("invalid TTL %q", raw)
+	}
+	if d < 0 {
+		return 0, false, fmt.Errorf("invalid TTL %q: must not be negative", raw)
+	}
+	return d, true, nil
+}
+
+func etag(v store.Value) string {
+	return `"` + strconv.FormatUint(v.Version, 10) + `"`
+}
+
+func writeValidators(w http.ResponseWriter, v store.Value) {
+	if v.Version == 0 {
+		return
+	}
+	w.Header().Set("ETag", etag(v))
+	w.Header().Set("Last-Modified", v.ModifiedAt.UTC().Format(http.TimeFormat))
+	if !v.ExpiresAt.IsZero() {
+		w.Header().Set("Expires", v.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// etagMatches reports whether the If-Match or If-None-Match header value
+// lists the entity tag of v. If-Match uses the strong comparison of RFC 9110,
+// which no weak tag passes, and If-None-Match the weak one, which ignores
+// the W/ prefix.
+func etagMatches(header string, v store.Value, exists, strong bool) bool {
+	if !exists {
+		return false
+	}
+	if strings.TrimSpace(header) == "*" {
+		return true
+	}
+	want := etag(v)
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if !strong {
+			candidate = strings.TrimPrefix(candidate, "W/")
+		}
+		if candidate == want {
+			return true
+		}
+	}
+	return false
+}
+
+func modifiedSince(header string, v store.Value) (bool, bool) {
+	since, err := http.ParseTime(header)
+	if err != nil {
+		return false, false
+	}
+	return v.ModifiedAt.Truncate(time.Second).After(since), true
+}
+
+// checkReadPreconditions evaluates conditional headers for GET and HEAD in
+// the order given by RFC 9110. It returns 0 when the request should proceed.
+func checkReadPreconditions(r *http.Request, v store.Value, exists bool) int {
+	if h := r.Header.Get("If-Match"); h != "" {
+		if !etagMatches(h, v, exists, true) {
+			return http.StatusPreconditionFailed
+		}
+	} else if h := r.Header.Get("If-Unmodified-Since"); h != "" && exists {
+		if modified, ok := modifiedSince(h, v); ok && modified {
+			return http.StatusPreconditionFailed
+		}
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" {
+		if etagMatches(h, v, exists, false) {
+			return http.StatusNotModified
+		}
+	} else if h := r.Header.Get("If-Modified-Since"); h != "" && exists {
+		if modified, ok := modifiedSince(h, v); ok && !modified {
+			return http.StatusNotModified
+		}
+	}
+	return 0
+}
+
+// checkWritePreconditions evaluates conditional headers for PUT, PATCH and
+// DELETE against the current entry. If-None-Match: * makes a PUT create-only.
+func checkWritePreconditions(r *http.Request, v store.Value, exists bool) bool {
+	if h := r.Header.Get("If-Match"); h != "" {
+		if !etagMatches(h, v, exists, true) {
+			return false
+		}
+	} else if h := r.Header.Get("If-Unmodified-Since"); h != "" && exists {
+		if modified, ok := modifiedSince(h, v); ok && modified {
+			return false
+		}
+	}
+	if h := r.Header.Get("If-None-Match"); h != "" && etagMatches(h, v, exists, false) {
+		return false
+	}
+	return true
+}
+
+// mergePatch implements JSON Merge Patch (RFC 7396).
+func mergePatch(target, patch interface{}) interface{} {
+	patchObj, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	targetObj, ok := target.(map[string]interface{})
+	result := make(map[string]interface{}, len(targetObj)+len(patchObj))
+	if ok {
+		for k, v := range targetObj {
+			result[k] = v
+		}
+	}
+	for k, v := range patchObj {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = mergePatch(result[k], v)
+	}
+	return result
+}
+
+// problem is an RFC 9457 problem details body, extended with the query
+// error code.
+type problem struct {
+	Type   string `json:"type"`
+	Title  string `json:"title"`
+	Status int    `json:"status"`
+	Detail string `json:"detail,omitempty"`
+	Code   string `json:"code,omitempty"`
+}
+
+func (s *Server) problemResponse(w http.ResponseWriter, r *http.Request, status int, code, detail string) {
+	if responseCodec(r) == codec.JSON {
+		w.Header().Set("Content-Type", "application/problem+json")
+	}
+	s.respond(w, r, problem{
+		Type:   "about:blank",
+		Title:  http.StatusText(status),
+		Status: status,
+		Detail: detail,
+		Code:   code,
+	}, status)
+}
+
+// deprecated marks a handler as a legacy alias of a /v1 route. Routes
+// naming the key in the path link their successor here; others do so with
+// linkSuccessor once they know the key.
+func deprecated(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		if _, ok := mux.Vars(r)["key"]; ok {
+			linkSuccessor(w, r, pathVar(r, "key"))
+		}
+		h(w, r)
+	}
+}
+
+// linkSuccessor sets the Link header of a legacy response to the /v1 URI of
+// key, in the request's database.
+func linkSuccessor(w http.ResponseWriter, r *http.Request, key string) {
+	prefix := "/v1"
+	if _, ok := mux.Vars(r)["db"]; ok {
+		prefix += "/db/" + url.PathEscape(pathVar(r, "db"))
+	}
+	w.Header().Set("Link", fmt.Sprintf("<%s/keys/%s>; rel=\"successor-version\"", prefix, url.PathEscape(key)))
+}
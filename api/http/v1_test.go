@@ -0,0 +1,157 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+func TestEtagMatches(t *testing.T) {
+	v := store.Value{Version: 3}
+	tests := []struct {
+		header         string
+		exists, strong bool
+		want           bool
+	}{
+		{`"3"`, true, true, true},
+		{`"3"`, true, false, true},
+		{`W/"3"`, true, true, false},
+		{`W/"3"`, true, false, true},
+		{`"4"`, true, false, false},
+		{`"1", "3"`, true, true, true},
+		{`"1",W/"3"`, true, false, true},
+		{`*`, true, true, true},
+		{` * `, true, false, true},
+		{`*`, false, true, false},
+		{`"3"`, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := etagMatches(tt.header, v, tt.exists, tt.strong); got != tt.want {
+			t.Errorf("etagMatches(%s, exists=%v, strong=%v) = %v, want %v", tt.header, tt.exists, tt.strong, got, tt.want)
+		}
+	}
+}
+
+// Conditional headers checked against a value of version 3 last modified
+// at lastModified.
+var (
+	lastModified   = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	beforeModified = lastModified.Add(-time.Hour).Format(http.TimeFormat)
+	afterModified  = lastModified.Add(time.Hour).Format(http.TimeFormat)
+	atModified     = lastModified.Format(http.TimeFormat)
+)
+
+func TestCheckReadPreconditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		exists  bool
+		want    int
+	}{
+		{"none", nil, true, 0},
+		{"If-Match current", map[string]string{"If-Match": `"3"`}, true, 0},
+		{"If-Match stale", map[string]string{"If-Match": `"2"`}, true, http.StatusPreconditionFailed},
+		{"If-Match weak", map[string]string{"If-Match": `W/"3"`}, true, http.StatusPreconditionFailed},
+		{"If-Match * missing", map[string]string{"If-Match": `*`}, false, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since beforeModified", map[string]string{"If-Unmodified-Since": beforeModified}, true, http.StatusPreconditionFailed},
+		{"If-Unmodified-Since at", map[string]string{"If-Unmodified-Since": atModified}, true, 0},
+		{"If-Unmodified-Since invalid", map[string]string{"If-Unmodified-Since": "yesterday"}, true, 0},
+		// If-Match takes precedence over If-Unmodified-Since.
+		{"If-Match over If-Unmodified-Since", map[string]string{"If-Match": `"3"`, "If-Unmodified-Since": beforeModified}, true, 0},
+		{"If-None-Match current", map[string]string{"If-None-Match": `"3"`}, true, http.StatusNotModified},
+		{"If-None-Match weak", map[string]string{"If-None-Match": `W/"3"`}, true, http.StatusNotModified},
+		{"If-None-Match stale", map[string]string{"If-None-Match": `"2"`}, true, 0},
+		{"If-None-Match * missing", map[string]string{"If-None-Match": `*`}, false, 0},
+		{"If-Modified-Since at", map[string]string{"If-Modified-Since": atModified}, true, http.StatusNotModified},
+		{"If-Modified-Since beforeModified", map[string]string{"If-Modified-Since": beforeModified}, true, 0},
+		{"If-Modified-Since missing", map[string]string{"If-Modified-Since": afterModified}, false, 0},
+		// If-None-Match takes precedence over If-Modified-Since.
+		{"If-None-Match over If-Modified-Since", map[string]string{"If-None-Match": `"2"`, "If-Modified-Since": afterModified}, true, 0},
+		// A failed If-Match is 412 even when If-None-Match would give 304.
+		{"412 beforeModified 304", map[string]string{"If-Match": `"2"`, "If-None-Match": `"3"`}, true, http.StatusPreconditionFailed},
+	}
+	v := store.Value{Version: 3, ModifiedAt: lastModified}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/v1/keys/k", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := checkReadPreconditions(r, v, tt.exists); got != tt.want {
+				t.Errorf("status = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckWritePreconditions(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers map[string]string
+		exists  bool
+		want    bool
+	}{
+		{"none", nil, true, true},
+		{"If-Match current", map[string]string{"If-Match": `"3"`}, true, true},
+		{"If-Match stale", map[string]string{"If-Match": `"2"`}, true, false},
+		{"If-Match weak", map[string]string{"If-Match": `W/"3"`}, true, false},
+		{"If-Match * existing", map[string]string{"If-Match": `*`}, true, true},
+		{"If-Match * missing", map[string]string{"If-Match": `*`}, false, false},
+		{"If-Unmodified-Since beforeModified", map[string]string{"If-Unmodified-Since": beforeModified}, true, false},
+		{"If-Unmodified-Since afterModified", map[string]string{"If-Unmodified-Since": afterModified}, true, true},
+		{"If-Unmodified-Since missing", map[string]string{"If-Unmodified-Since": beforeModified}, false, true},
+		{"If-Match over If-Unmodified-Since", map[string]string{"If-Match": `"3"`, "If-Unmodified-Since": beforeModified}, true, true},
+		{"If-None-Match * existing", map[string]string{"If-None-Match": `*`}, true, false},
+		{"If-None-Match * missing", map[string]string{"If-None-Match": `*`}, false, true},
+		{"If-None-Match current", map[string]string{"If-None-Match": `W/"3"`}, true, false},
+		{"If-None-Match stale", map[string]string{"If-None-Match": `"2"`}, true, true},
+		// Writes fail with 412, never 304, and ignore If-Modified-Since.
+		{"If-Modified-Since", map[string]string{"If-Modified-Since": afterModified}, true, true},
+	}
+	v := store.Value{Version: 3, ModifiedAt: lastModified}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("PUT", "/v1/keys/k", nil)
+			for name, value := range tt.headers {
+				r.Header.Set(name, value)
+			}
+			if got := checkWritePreconditions(r, v, tt.exists); got != tt.want {
+				t.Errorf("proceed = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := NewServer(query.New(store.NewDatabases(0, 0)))
+	do := func(method, ifNoneMatch string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/v1/keys/k", strings.NewReader(`1`))
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("If-None-Match", ifNoneMatch)
+		w := httptest.NewRecorder()
+		s.handler().ServeHTTP(w, r)
+		return w
+	}
+
+	// If-None-Match: * makes a PUT create-only.
+	created := do("PUT", "*")
+	if created.Code != http.StatusCreated {
+		t.Fatalf("first PUT: status = %d: %s", created.Code, created.Body)
+	}
+	if w := do("PUT", "*"); w.Code != http.StatusPreconditionFailed {
+		t.Errorf("second PUT: status = %d, want %d", w.Code, http.StatusPreconditionFailed)
+	}
+
+	etag := created.Header().Get("ETag")
+	if w := do("GET", etag); w.Code != http.StatusNotModified {
+		t.Errorf("GET with the current tag: status = %d, want %d", w.Code, http.StatusNotModified)
+	}
+	if w := do("GET", `"0"`); w.Code != http.StatusOK {
+		t.Errorf("GET with a stale tag: status = %d, want %d", w.Code, http.StatusOK)
+	}
+}
@@ -0,0 +1,380 @@
+package memcached
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+	"github.com/umgbhalla/gokv/internal/version"
+)
+
+// maxKeyLength is the longest key memcached accepts.
+const maxKeyLength = 250
+
+// maxRelativeExptime is the largest exptime taken as seconds from now.
+// Larger ones are Unix times, as in memcached.
+const maxRelativeExptime = 60 * 60 * 24 * 30
+
+var commands = map[string]func(c *conn, tokens []string) error{
+	"get":       retrieve,
+	"gets":      retrieve,
+	"set":       storage,
+	"add":       storage,
+	"replace":   storage,
+	"cas":       storage,
+	"delete":    deleteCommand,
+	"incr":      arithmetic,
+	"decr":      arithmetic,
+	"touch":     touch,
+	"version":   versionCommand,
+	"verbosity": verbosity,
+	"quit":      quit,
+}
+
+var (
+	errTooLarge     = &replyError{query.ErrTooLarge, "SERVER_ERROR object too large for cache"}
+	errNonNumeric   = &replyError{query.ErrWrongType, "CLIENT_ERROR cannot increment or decrement non-numeric value"}
+	errInvalidDelta = &replyError{query.ErrParse, "CLIENT_ERROR invalid numeric delta argument"}
+)
+
+// validKey reports whether key is one memcached accepts. Keys cannot hold
+// whitespace, having been split on it.
+func validKey(key string) bool {
+	if len(key) > maxKeyLength {
+		return false
+	}
+	for i := 0; i < len(key); i++ {
+		if key[i] < 0x20 || key[i] == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+// optionalNoreply consumes the noreply that may follow the n arguments of
+// a command, reporting whether the command line is well formed.
+func (c *conn) optionalNoreply(tokens []string, n int) bool {
+	switch {
+	case len(tokens) == n:
+		return true
+	case len(tokens) == n+1 && tokens[n] == "noreply":
+		c.noreply = true
+		return true
+	}
+	return false
+}
+
+// expiresAt converts an exptime: zero for none, up to 30 days in seconds
+// from now, beyond that a Unix time. A negative exptime expires the item
+// at once.
+func expiresAt(exptime int64) time.Time {
+	switch {
+	case exptime == 0:
+		return time.Time{}
+	case exptime < 0:
+		return time.Now()
+	case exptime <= maxRelativeExptime:
+		return time.Now().Add(time.Duration(exptime) * time.Second)
+	}
+	return time.Unix(exptime, 0)
+}
+
+// value converts a data block into a value to store: a string if it is
+// valid UTF-8, binary otherwise.
+func value(data []byte) interface{} {
+	if utf8.Valid(data) {
+		return string(data)
+	}
+	return data
+}
+
+// encode returns the bytes of a stored value, in pieces for a chunked one.
+// Strings and binary values are sent as they are, numbers in decimal and
+// anything else as JSON.
+func encode(data interface{}) ([][]byte, int64, error) {
+	var b []byte
+	switch d := data.(type) {
+	case string:
+		b = []byte(d)
+	case []byte:
+		b = d
+	case *store.Chunks:
+		return d.Parts(), d.Size(), nil
+	case float64:
+		b = strconv.AppendFloat(nil, d, 'f', -1, 64)
+	default:
+		var err error
+		if b, err = json.Marshal(d); err != nil {
+			return nil, 0, err
+		}
+	}
+	return [][]byte{b}, int64(len(b)), nil
+}
+
+// get|gets <key>*
+func retrieve(c *conn, tokens []string) error {
+	if len(tokens) < 2 {
+		return errUnknownCommand
+	}
+	type item struct {
+		key   string
+		v     store.Value
+		parts [][]byte
+		size  int64
+	}
+	// Every item is encoded before any is written, so that an error can
+	// still be sent on its own.
+	items := make([]item, 0, len(tokens)-1)
+	for _, key := range tokens[1:] {
+		if !validKey(key) {
+			return errBadFormat
+		}
+		v, err := c.q.GetValue(key)
+		if errors.Is(err, query.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		parts, size, err := encode(v.Data)
+		if err != nil {
+			return err
+		}
+		items = append(items, item{key, v, parts, size})
+	}
+
+	for _, it := range items {
+		c.w.WriteString("VALUE " + it.key + " " + strconv.FormatUint(uint64(it.v.Flags), 10) + " " + strconv.FormatInt(it.size, 10))
+		if tokens[0] == "gets" {
+			c.w.WriteString(" " + strconv.FormatUint(it.v.Version, 10))
+		}
+		c.w.WriteString("\r\n")
+		for _, p := range it.parts {
+			c.w.Write(p)
+		}
+		c.w.WriteString("\r\n")
+	}
+	c.w.WriteString("END\r\n")
+	return nil
+}
+
+// storage handles set, add, replace and cas:
+//
+//	<command> <key> <flags> <exptime> <bytes> [<cas unique>] [noreply]
+//
+// The data block is read whenever its size can be, so that the connection
+// stays in step even if the rest of the line is invalid.
+func storage(c *conn, tokens []string) error {
+	name := tokens[0]
+	n := 5
+	if name == "cas" {
+		n = 6
+	}
+	if len(tokens) < n {
+		return errUnknownCommand
+	}
+	size, err := strconv.ParseInt(tokens[4], 10, 64)
+	if err != nil || size < 0 {
+		return errBadFormat
+	}
+	valid := c.optionalNoreply(tokens, n)
+	limit := c.s.maxItemSize
+	if limit <= 0 {
+		limit = defaultMaxItemSize
+	}
+	if !c.authenticated && size > maxAuthDataSize {
+		// Only credentials are read before authenticating, and they are
+		// not worth buffering a large block for.
+		c.discard(size)
+		return errAuthFailed
+	}
+	if size > limit {
+		c.discard(size)
+		return errTooLarge
+	}
+	data, err := c.readData(size)
+	if err != nil {
+		return err
+	}
+
+	key := tokens[1]
+	flags, err := strconv.ParseUint(tokens[2], 10, 32)
+	valid = valid && err == nil && validKey(key)
+	exptime, err := strconv.ParseInt(tokens[3], 10, 64)
+	valid = valid && err == nil
+	var cas uint64
+	if name == "cas" {
+		cas, err = strconv.ParseUint(tokens[5], 10, 64)
+		valid = valid && err == nil
+	}
+	if !valid {
+		return errBadFormat
+	}
+	if !c.authenticated {
+		return c.authenticate(data)
+	}
+
+	stored := store.Value{Data: value(data), Flags: uint32(flags), ExpiresAt: expiresAt(exptime)}
+	_, err = c.q.Update(key, func(current store.Value, exists bool) (store.Value, error) {
+		switch {
+		case name == "add" && exists:
+			return store.Value{}, query.ErrConflict
+		case (name == "replace" || name == "cas") && !exists:
+			return store.Value{}, query.ErrNotFound
+		case name == "cas" && current.Version != cas:
+			return store.Value{}, query.ErrConflict
+		}
+		return stored, nil
+	})
+	switch {
+	case err == nil:
+		c.reply("STORED")
+	case name == "cas" && errors.Is(err, query.ErrNotFound):
+		c.reply("NOT_FOUND")
+	case name == "cas" && errors.Is(err, query.ErrConflict):
+		c.reply("EXISTS")
+	case errors.Is(err, query.ErrNotFound), errors.Is(err, query.ErrConflict):
+		c.reply("NOT_STORED")
+	default:
+		return err
+	}
+	return nil
+}
+
+// delete <key> [0] [noreply]. The 0 is accepted from older clients, which
+// sent a hold time.
+func deleteCommand(c *conn, tokens []string) error {
+	if len(tokens) > 2 && tokens[2] == "0" {
+		tokens = append(tokens[:2:2], tokens[3:]...)
+	}
+	if len(tokens) < 2 || !c.optionalNoreply(tokens, 2) || !validKey(tokens[1]) {
+		return &replyError{query.ErrParse, "CLIENT_ERROR bad command line format.  Usage: delete <key> [noreply]"}
+	}
+	err := c.q.DeleteIf(tokens[1], func(_ store.Value, exists bool) error {
+		if !exists {
+			return query.ErrNotFound
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		c.reply("DELETED")
+	case errors.Is(err, query.ErrNotFound):
+		c.reply("NOT_FOUND")
+	default:
+		return err
+	}
+	return nil
+}
+
+// incr|decr <key> <value> [noreply]. The item must hold a decimal number,
+// which is replaced by the result as a string. incr wraps around at 64
+// bits; decr stops at 0. Flags and exptime are kept.
+func arithmetic(c *conn, tokens []string) error {
+	if len(tokens) < 3 || !c.optionalNoreply(tokens, 3) || !validKey(tokens[1]) {
+		return errUnknownCommand
+	}
+	delta, err := strconv.ParseUint(tokens[2], 10, 64)
+	if err != nil {
+		return errInvalidDelta
+	}
+	var result uint64
+	_, err = c.q.Update(tokens[1], func(current store.Value, exists bool) (store.Value, error) {
+		if !exists {
+			return store.Value{}, query.ErrNotFound
+		}
+		n, ok := counter(current.Data)
+		if !ok {
+			return store.Value{}, errNonNumeric
+		}
+		switch {
+		case tokens[0] == "incr":
+			result = n + delta
+		case delta > n:
+			result = 0
+		default:
+			result = n - delta
+		}
+		current.Data = strconv.FormatUint(result, 10)
+		return current, nil
+	})
+	if errors.Is(err, query.ErrNotFound) {
+		c.reply("NOT_FOUND")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.reply(strconv.FormatUint(result, 10))
+	return nil
+}
+
+// counter reads a stored value as an unsigned 64-bit integer.
+func counter(data interface{}) (uint64, bool) {
+	switch d := data.(type) {
+	case string:
+		n, err := strconv.ParseUint(d, 10, 64)
+		return n, err == nil
+	case []byte:
+		n, err := strconv.ParseUint(string(d), 10, 64)
+		return n, err == nil
+	case float64:
+		// Numbers set through the other APIs, exact only up to 2^53.
+		if d >= 0 && d <= 1<<53 && d == math.Trunc(d) {
+			return uint64(d), true
+		}
+	}
+	return 0, false
+}
+
+// touch <key> <exptime> [noreply]
+func touch(c *conn, tokens []string) error {
+	if len(tokens) < 3 || !c.optionalNoreply(tokens, 3) || !validKey(tokens[1]) {
+		return errUnknownCommand
+	}
+	exptime, err := strconv.ParseInt(tokens[2], 10, 64)
+	if err != nil {
+		return &replyError{query.ErrParse, "CLIENT_ERROR invalid exptime argument"}
+	}
+	_, err = c.q.Update(tokens[1], func(current store.Value, exists bool) (store.Value, error) {
+		if !exists {
+			return store.Value{}, query.ErrNotFound
+		}
+		current.ExpiresAt = expiresAt(exptime)
+		return current, nil
+	})
+	switch {
+	case err == nil:
+		c.reply("TOUCHED")
+	case errors.Is(err, query.ErrNotFound):
+		c.reply("NOT_FOUND")
+	default:
+		return err
+	}
+	return nil
+}
+
+func versionCommand(c *conn, tokens []string) error {
+	c.reply("VERSION " + version.Version)
+	return nil
+}
+
+// verbosity <level> [noreply] is accepted and ignored; logging is
+// configured on the server.
+func verbosity(c *conn, tokens []string) error {
+	if len(tokens) < 2 || !c.optionalNoreply(tokens, 2) {
+		return errUnknownCommand
+	}
+	c.reply("OK")
+	return nil
+}
+
+func quit(c *conn, tokens []string) error {
+	c.quit = true
+	return nil
+}
@@ -0,0 +1,252 @@
+package memcached
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+const (
+	// readBufferSize also bounds the length of a command line.
+	readBufferSize = 16 << 10
+	// defaultMaxItemSize bounds an item when no limit is set.
+	defaultMaxItemSize = 512 << 20
+	// maxAuthDataSize bounds the data of a set before the client has
+	// authenticated, which leaves room for a username and a token.
+	maxAuthDataSize = 64 << 10
+)
+
+// replyError is an error reply as sent: ERROR, CLIENT_ERROR <message> or
+// SERVER_ERROR <message>. It wraps the error it stands for, by which it is
+// classified in metrics.
+type replyError struct {
+	err error
+	msg string
+}
+
+func (e *replyError) Error() string { return e.msg }
+func (e *replyError) Unwrap() error { return e.err }
+
+var (
+	errUnknownCommand  = &replyError{query.ErrUnknownCommand, "ERROR"}
+	errBadFormat       = &replyError{query.ErrParse, "CLIENT_ERROR bad command line format"}
+	errBadChunk        = &replyError{query.ErrParse, "CLIENT_ERROR bad data chunk"}
+	errLineTooLong     = &replyError{query.ErrParse, "CLIENT_ERROR line too long"}
+	errUnauthenticated = &replyError{auth.ErrNoCredentials, "CLIENT_ERROR unauthenticated"}
+	errAuthFailed      = &replyError{auth.ErrInvalidCredentials, "CLIENT_ERROR authentication failure"}
+	errInternal        = &replyError{errors.New("internal error"), "SERVER_ERROR internal error"}
+)
+
+// errorCode classifies err for metrics.
+func errorCode(err error) string {
+	if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		return auth.CodeUnauthenticated
+	}
+	return query.ErrorCode(err)
+}
+
+// errorLine returns the error reply for err.
+func errorLine(err error) string {
+	var re *replyError
+	if errors.As(err, &re) {
+		return re.msg
+	}
+	switch query.ErrorCode(err) {
+	case query.CodeParse, query.CodeInvalidArgument, query.CodePermissionDenied:
+		return "CLIENT_ERROR " + err.Error()
+	}
+	return "SERVER_ERROR " + err.Error()
+}
+
+// conn is one client connection. Its commands run one at a time on the
+// goroutine reading them.
+type conn struct {
+	s   *Server
+	nc  net.Conn
+	id  int64
+	log *slog.Logger
+	tls *tls.ConnectionState
+	r   *bufio.Reader
+	w   *bufio.Writer
+
+	// q is replaced when the client authenticates.
+	q             *query.Query
+	authenticated bool
+	// noreply is set by a command that asked for no reply.
+	noreply bool
+	quit    bool
+	// err is set when the connection cannot continue, such as after a data
+	// block that is not followed by CRLF.
+	err error
+}
+
+func (s *Server) newConn(nc net.Conn) *conn {
+	return &conn{
+		s:             s,
+		nc:            nc,
+		r:             bufio.NewReaderSize(nc, readBufferSize),
+		w:             bufio.NewWriter(nc),
+		q:             s.query.WithClient(nc.RemoteAddr().String()),
+		authenticated: s.authn == nil,
+	}
+}
+
+// serve runs commands until the client disconnects or sends quit. Replies
+// are flushed once every command received so far has run, so a pipeline is
+// answered in one write.
+func (c *conn) serve() error {
+	for {
+		line, err := c.readLine()
+		if err != nil {
+			if err == errLineTooLong {
+				c.reply(errLineTooLong.msg)
+				c.w.Flush()
+				return err
+			}
+			c.w.Flush()
+			if err == io.EOF || errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		if tokens := strings.Fields(line); len(tokens) > 0 {
+			if err := c.dispatch(tokens); err != nil {
+				c.w.Flush()
+				return err
+			}
+		}
+		if c.quit {
+			return c.w.Flush()
+		}
+		if c.r.Buffered() == 0 {
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (c *conn) readLine() (string, error) {
+	line, err := c.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return "", errLineTooLong
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(line[:len(line)-1]), "\r"), nil
+}
+
+// readData reads a storage command's data block of size bytes and the CRLF
+// after it.
+func (c *conn) readData(size int64) ([]byte, error) {
+	data := make([]byte, size+2)
+	if _, err := io.ReadFull(c.r, data); err != nil {
+		c.err = err
+		return nil, err
+	}
+	if data[size] != '\r' || data[size+1] != '\n' {
+		c.err = errBadChunk
+		return nil, errBadChunk
+	}
+	return data[:size:size], nil
+}
+
+// discard skips a data block that will not be stored.
+func (c *conn) discard(size int64) {
+	if _, err := io.CopyN(io.Discard, c.r, size+2); err != nil {
+		c.err = err
+	}
+}
+
+// reply writes one line, unless the command asked for no reply.
+func (c *conn) reply(line string) {
+	if c.noreply {
+		return
+	}
+	c.w.WriteString(line)
+	c.w.WriteString("\r\n")
+}
+
+// dispatch runs one command and writes its reply. A panic fails only this
+// command. The error returned ends the connection.
+func (c *conn) dispatch(tokens []string) error {
+	start := time.Now()
+	name := tokens[0]
+	run, ok := commands[name]
+	if !ok {
+		name = "unknown"
+	}
+	code := codeOK
+	c.noreply = false
+	defer func() { observeCommand(name, code, start) }()
+	defer func() {
+		if p := recover(); p != nil {
+			c.log.Error("memcached command panicked", "command", name, "panic", p, "stack", string(debug.Stack()))
+			code = query.CodeInternal
+			c.reply(errInternal.msg)
+		}
+	}()
+
+	var err error
+	switch {
+	case !ok:
+		err = errUnknownCommand
+	case !c.authenticated && name != "set" && name != "quit":
+		err = errUnauthenticated
+	default:
+		err = run(c, tokens)
+	}
+	if err != nil {
+		code = errorCode(err)
+		c.reply(errorLine(err))
+	}
+	return c.err
+}
+
+// authenticateTLS authenticates the connection by its verified client
+// certificate, if it has one.
+func (c *conn) authenticateTLS() {
+	if c.s.authn == nil || c.tls == nil {
+		return
+	}
+	p, err := c.s.authn.Authenticate(&http.Request{Header: http.Header{}, TLS: c.tls})
+	if err == nil {
+		c.setPrincipal(p)
+	}
+}
+
+// authenticate checks the "<username> <password>" data of the first set.
+// The password is checked as a bearer token and must belong to the
+// principal named.
+func (c *conn) authenticate(data []byte) error {
+	fields := strings.Fields(string(data))
+	if len(fields) != 2 {
+		return errAuthFailed
+	}
+	r := &http.Request{Header: http.Header{"Authorization": {"Bearer " + fields[1]}}}
+	p, err := c.s.authn.Authenticate(r)
+	if err != nil || p.Name != fields[0] {
+		return errAuthFailed
+	}
+	c.setPrincipal(p)
+	c.reply("STORED")
+	return nil
+}
+
+func (c *conn) setPrincipal(p *auth.Principal) {
+	c.q = c.s.query.WithPrincipal(p).WithClient(c.nc.RemoteAddr().String())
+	c.authenticated = true
+	c.log = c.log.With("principal", p.Name)
+}
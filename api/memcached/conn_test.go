@@ -0,0 +1,63 @@
+package memcached
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// tokenAuth accepts the bearer token "secret" for the principal "app".
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Principal{Name: "app"}, nil
+}
+
+func TestDataSizeBeforeAuth(t *testing.T) {
+	s := NewServer(query.New(store.NewDatabases(0, 0)))
+	s.UseAuthenticator(tokenAuth{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(ln)
+	defer ln.Close()
+
+	nc, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Close()
+	nc.SetDeadline(time.Now().Add(5 * time.Second))
+	r := bufio.NewReader(nc)
+	expect := func(want string) {
+		t.Helper()
+		if line, err := r.ReadString('\n'); line != want+"\r\n" {
+			t.Fatalf("reply = %q, %v; want %q", line, err, want)
+		}
+	}
+	large := strings.Repeat("x", maxAuthDataSize+1)
+
+	// A block too large to be credentials is skipped, keeping the
+	// connection in step.
+	fmt.Fprintf(nc, "set k 0 0 %d\r\n%s\r\n", len(large), large)
+	expect("CLIENT_ERROR authentication failure")
+	fmt.Fprintf(nc, "get k\r\n")
+	expect("CLIENT_ERROR unauthenticated")
+
+	fmt.Fprintf(nc, "set auth 0 0 10\r\napp secret\r\n")
+	expect("STORED")
+	fmt.Fprintf(nc, "set k 0 0 %d\r\n%s\r\n", len(large), large)
+	expect("STORED")
+}
@@ -0,0 +1,25 @@
+package memcached
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+const codeOK = "OK"
+
+var (
+	activeConnections = metrics.Default.NewGauge("gokv_memcached_connections",
+		"Open memcached connections.")
+	commandsTotal = metrics.Default.NewCounterVec("gokv_memcached_commands_total",
+		"memcached commands handled, by command and result code.", "command", "code")
+	commandDuration = metrics.Default.NewHistogramVec("gokv_memcached_command_duration_seconds",
+		"Time spent handling memcached commands.", nil, "command")
+)
+
+// observeCommand records one command. name is a known command or
+// "unknown".
+func observeCommand(name, code string, start time.Time) {
+	commandsTotal.With(name, code).Inc()
+	commandDuration.With(name).Since(start)
+}
@@ -0,0 +1,620 @@
+package resp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+	"github.com/umgbhalla/gokv/internal/version"
+)
+
+// command is one RESP command. arity counts the command's name among its
+// arguments, as Redis does: a positive arity is exact and a negative one is
+// the minimum.
+type command struct {
+	arity int
+	// beforeAuth commands may run before the client has authenticated.
+	beforeAuth bool
+	run        func(c *conn, args [][]byte) error
+}
+
+var commands = map[string]command{
+	"hello":  {arity: -1, beforeAuth: true, run: hello},
+	"auth":   {arity: -2, beforeAuth: true, run: authCommand},
+	"quit":   {arity: -1, beforeAuth: true, run: quit},
+	"ping":   {arity: -1, run: ping},
+	"echo":   {arity: 2, run: echo},
+	"select": {arity: 2, run: selectDB},
+	"get":    {arity: 2, run: get},
+	"set":    {arity: -3, run: set},
+	"del":    {arity: -2, run: del},
+	"exists": {arity: -2, run: exists},
+	"expire": {arity: 3, run: expire},
+	"ttl":    {arity: 2, run: ttl},
+	"keys":   {arity: 2, run: keys},
+	"scan":   {arity: -2, run: scan},
+	"incr":   {arity: 2, run: incr},
+	"decr":   {arity: 2, run: decr},
+	"incrby": {arity: 3, run: incrBy},
+	"decrby": {arity: 3, run: decrBy},
+	"info":   {arity: -1, run: info},
+}
+
+var (
+	errWrongType       = &replyError{query.ErrWrongType, "WRONGTYPE Operation against a key holding the wrong kind of value"}
+	errValueNotInteger = &replyError{query.ErrWrongType, "ERR value is not an integer or out of range"}
+	errOverflow        = &replyError{query.ErrTooLarge, "ERR increment or decrement would overflow"}
+	errInvalidCursor   = &replyError{query.ErrInvalidCursor, "ERR invalid cursor"}
+)
+
+func expireTimeError(command string) error {
+	return &replyError{query.ErrParse, "ERR invalid expire time in '" + command + "' command"}
+}
+
+// value converts a bulk string argument into a value to store: a string if
+// it is valid UTF-8, binary otherwise.
+func value(arg []byte) interface{} {
+	if utf8.Valid(arg) {
+		return string(arg)
+	}
+	return arg
+}
+
+// HELLO [protover [AUTH username password] [SETNAME clientname]]
+func hello(c *conn, args [][]byte) error {
+	proto := c.w.proto
+	if len(args) > 1 {
+		n, err := strconv.Atoi(string(args[1]))
+		if err != nil {
+			return &replyError{query.ErrParse, "ERR Protocol version is not an integer or out of range"}
+		}
+		if n != 2 && n != 3 {
+			return &replyError{query.ErrParse, "NOPROTO unsupported protocol version"}
+		}
+		proto = n
+	}
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i])) {
+		case "AUTH":
+			if i+2 >= len(args) {
+				return errSyntax
+			}
+			if err := c.authenticate(string(args[i+1]), string(args[i+2])); err != nil {
+				return err
+			}
+			i += 2
+		case "SETNAME":
+			// Accepted for compatibility; connections are identified by
+			// their address.
+			if i+1 >= len(args) {
+				return errSyntax
+			}
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if !c.authenticated {
+		return &replyError{auth.ErrNoCredentials, "NOAUTH HELLO must be called with the client already authenticated, " +
+			"otherwise the HELLO <proto> AUTH <user> <pass> option can be used to authenticate the client " +
+			"and select the RESP protocol version at the same time"}
+	}
+
+	c.w.proto = proto
+	c.w.mapHeader(7)
+	c.w.bulkString("server")
+	c.w.bulkString("gokv")
+	c.w.bulkString("version")
+	c.w.bulkString(version.Version)
+	c.w.bulkString("proto")
+	c.w.integer(int64(proto))
+	c.w.bulkString("id")
+	c.w.integer(c.id)
+	c.w.bulkString("mode")
+	c.w.bulkString("standalone")
+	c.w.bulkString("role")
+	c.w.bulkString("master")
+	c.w.bulkString("modules")
+	c.w.array(0)
+	return nil
+}
+
+// AUTH [username] password
+func authCommand(c *conn, args [][]byte) error {
+	var err error
+	switch len(args) {
+	case 2:
+		err = c.authenticate("", string(args[1]))
+	case 3:
+		err = c.authenticate(string(args[1]), string(args[2]))
+	default:
+		return errSyntax
+	}
+	if err != nil {
+		return err
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+func quit(c *conn, args [][]byte) error {
+	c.quit = true
+	c.w.simple("OK")
+	return nil
+}
+
+func ping(c *conn, args [][]byte) error {
+	switch len(args) {
+	case 1:
+		c.w.simple("PONG")
+	case 2:
+		c.w.bulk(args[1])
+	default:
+		return &replyError{query.ErrParse, "ERR wrong number of arguments for 'ping' command"}
+	}
+	return nil
+}
+
+func echo(c *conn, args [][]byte) error {
+	c.w.bulk(args[1])
+	return nil
+}
+
+func selectDB(c *conn, args [][]byte) error {
+	if _, err := c.session.Execute("SELECT " + string(args[1])); err != nil {
+		return err
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+func get(c *conn, args [][]byte) error {
+	v, err := c.query().Get(string(args[1]))
+	if errors.Is(err, query.ErrNotFound) {
+		c.w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return c.w.data(v)
+}
+
+// SET key value [NX | XX] [EX seconds | PX milliseconds | KEEPTTL]
+func set(c *conn, args [][]byte) error {
+	var (
+		nx, xx, keepTTL bool
+		ttl             time.Duration
+	)
+	for i := 3; i < len(args); i++ {
+		switch option := strings.ToUpper(string(args[i])); option {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "KEEPTTL":
+			keepTTL = true
+		case "EX", "PX":
+			if ttl != 0 || i+1 == len(args) {
+				return errSyntax
+			}
+			n, err := strconv.ParseInt(string(args[i+1]), 10, 64)
+			if err != nil {
+				return errNotInteger
+			}
+			unit := time.Second
+			if option == "PX" {
+				unit = time.Millisecond
+			}
+			if n <= 0 || n > math.MaxInt64/int64(unit) {
+				return expireTimeError("set")
+			}
+			ttl = time.Duration(n) * unit
+			i++
+		default:
+			return errSyntax
+		}
+	}
+	if (nx && xx) || (keepTTL && ttl != 0) {
+		return errSyntax
+	}
+
+	data := value(args[2])
+	_, err := c.query().Update(string(args[1]), func(current store.Value, exists bool) (store.Value, error) {
+		if (nx && exists) || (xx && !exists) {
+			return store.Value{}, query.ErrConflict
+		}
+		next := store.Value{Data: data, ExpiresAt: store.ExpiresIn(ttl)}
+		if keepTTL {
+			next.ExpiresAt = current.ExpiresAt
+		}
+		return next, nil
+	})
+	if errors.Is(err, query.ErrConflict) {
+		c.w.null()
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	c.w.simple("OK")
+	return nil
+}
+
+// remove deletes key, reporting whether it existed.
+func remove(q *query.Query, key string) (bool, error) {
+	err := q.DeleteIf(key, func(_ store.Value, exists bool) error {
+		if !exists {
+			return query.ErrNotFound
+		}
+		return nil
+	})
+	if errors.Is(err, query.ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func del(c *conn, args [][]byte) error {
+	n := int64(0)
+	for _, key := range args[1:] {
+		deleted, err := remove(c.query(), string(key))
+		if err != nil {
+			return err
+		}
+		if deleted {
+			n++
+		}
+	}
+	c.w.integer(n)
+	return nil
+}
+
+// EXISTS counts a key as often as it is named, as Redis does.
+func exists(c *conn, args [][]byte) error {
+	n := int64(0)
+	for _, key := range args[1:] {
+		_, err := c.query().GetValue(string(key))
+		if errors.Is(err, query.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		n++
+	}
+	c.w.integer(n)
+	return nil
+}
+
+// EXPIRE key seconds. A TTL of zero or less deletes the key.
+func expire(c *conn, args [][]byte) error {
+	seconds, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	if seconds > math.MaxInt64/int64(time.Second) {
+		return expireTimeError("expire")
+	}
+	var ok bool
+	if seconds <= 0 {
+		ok, err = remove(c.query(), string(args[1]))
+	} else {
+		ok, err = c.query().Expire(string(args[1]), time.Duration(seconds)*time.Second)
+	}
+	if err != nil {
+		return err
+	}
+	if ok {
+		c.w.integer(1)
+	} else {
+		c.w.integer(0)
+	}
+	return nil
+}
+
+// TTL replies with the seconds left, rounded, -1 for a key that does not
+// expire and -2 for a missing key.
+func ttl(c *conn, args [][]byte) error {
+	v, err := c.query().GetValue(string(args[1]))
+	switch {
+	case errors.Is(err, query.ErrNotFound):
+		c.w.integer(-2)
+	case err != nil:
+		return err
+	case v.ExpiresAt.IsZero():
+		c.w.integer(-1)
+	default:
+		ms := time.Until(v.ExpiresAt).Milliseconds()
+		c.w.integer((ms + 500) / 1000)
+	}
+	return nil
+}
+
+func keys(c *conn, args [][]byte) error {
+	m, err := query.CompileGlob(string(args[1]))
+	if err != nil {
+		return err
+	}
+	keys, err := c.query().Keys(m)
+	if err != nil {
+		return err
+	}
+	c.w.array(len(keys))
+	for _, k := range keys {
+		c.w.bulkString(k)
+	}
+	return nil
+}
+
+// defaultScanCount is the number of keys SCAN returns without COUNT.
+const defaultScanCount = 10
+
+// SCAN cursor [MATCH pattern] [COUNT count]
+func scan(c *conn, args [][]byte) error {
+	id, err := strconv.ParseUint(string(args[1]), 10, 64)
+	if err != nil {
+		return errInvalidCursor
+	}
+	var cursor string
+	if id != 0 {
+		var ok bool
+		if cursor, ok = c.s.cursors.get(id); !ok {
+			return errInvalidCursor
+		}
+	}
+	var m *query.Matcher
+	count := defaultScanCount
+	for i := 2; i < len(args); i += 2 {
+		if i+1 == len(args) {
+			return errSyntax
+		}
+		switch strings.ToUpper(string(args[i])) {
+		case "MATCH":
+			if m, err = query.CompileGlob(string(args[i+1])); err != nil {
+				return err
+			}
+		case "COUNT":
+			if count, err = strconv.Atoi(string(args[i+1])); err != nil {
+				return errNotInteger
+			}
+			if count < 1 {
+				return errSyntax
+			}
+		default:
+			return errSyntax
+		}
+	}
+
+	page, err := c.query().ScanMatch("", m, cursor, count)
+	if err != nil {
+		return err
+	}
+	next := "0"
+	if page.Cursor != "" {
+		next = strconv.FormatUint(c.s.cursors.add(page.Cursor), 10)
+	}
+	c.w.array(2)
+	c.w.bulkString(next)
+	c.w.array(len(page.Entries))
+	for _, e := range page.Entries {
+		c.w.bulkString(e.Key)
+	}
+	return nil
+}
+
+// maxCursors is the number of SCAN cursors remembered. Continuing from an
+// older one fails with an invalid cursor error.
+const maxCursors = 1 << 16
+
+// cursors maps the integer cursors Redis clients expect onto the opaque
+// ones of query.Scan. They are shared by all connections, since clients
+// may continue a scan on another connection from their pool.
+type cursors struct {
+	mu   sync.Mutex
+	last uint64
+	m    map[uint64]string
+}
+
+func newCursors() *cursors {
+	return &cursors{m: make(map[uint64]string)}
+}
+
+func (c *cursors) add(cursor string) uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.last++
+	c.m[c.last] = cursor
+	if c.last > maxCursors {
+		delete(c.m, c.last-maxCursors)
+	}
+	return c.last
+}
+
+func (c *cursors) get(id uint64) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	cursor, ok := c.m[id]
+	return cursor, ok
+}
+
+// maxInteger bounds the results of INCR and friends. Numbers are stored as
+// float64, which holds integers exactly only up to 2^53.
+const maxInteger = 1 << 53
+
+func incr(c *conn, args [][]byte) error {
+	return increment(c, string(args[1]), 1)
+}
+
+func decr(c *conn, args [][]byte) error {
+	return increment(c, string(args[1]), -1)
+}
+
+func incrBy(c *conn, args [][]byte) error {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil {
+		return errNotInteger
+	}
+	return increment(c, string(args[1]), delta)
+}
+
+func decrBy(c *conn, args [][]byte) error {
+	delta, err := strconv.ParseInt(string(args[2]), 10, 64)
+	if err != nil || delta == math.MinInt64 {
+		return errNotInteger
+	}
+	return increment(c, string(args[1]), -delta)
+}
+
+// increment adds delta to the integer at key, which is taken to be 0 if
+// missing, and stores the result as a number. The key's TTL and memcached
+// flags are kept.
+func increment(c *conn, key string, delta int64) error {
+	if delta > maxInteger || delta < -maxInteger {
+		return errOverflow
+	}
+	var result int64
+	_, err := c.query().Update(key, func(current store.Value, exists bool) (store.Value, error) {
+		var n int64
+		if exists {
+			var err error
+			if n, err = integer(current.Data); err != nil {
+				return store.Value{}, err
+			}
+		}
+		result = n + delta
+		if result > maxInteger || result < -maxInteger {
+			return store.Value{}, errOverflow
+		}
+		return store.Value{Data: float64(result), Flags: current.Flags, ExpiresAt: current.ExpiresAt}, nil
+	})
+	if err != nil {
+		return err
+	}
+	c.w.integer(result)
+	return nil
+}
+
+// integer reads a stored value as an integer: a number without a fraction
+// or a string holding one.
+func integer(data interface{}) (int64, error) {
+	var n int64
+	switch d := data.(type) {
+	case float64:
+		if d != math.Trunc(d) {
+			return 0, errValueNotInteger
+		}
+		n = int64(d)
+	case string:
+		var err error
+		if n, err = strconv.ParseInt(d, 10, 64); err != nil {
+			return 0, errValueNotInteger
+		}
+	case []byte:
+		var err error
+		if n, err = strconv.ParseInt(string(d), 10, 64); err != nil {
+			return 0, errValueNotInteger
+		}
+	case *store.Chunks:
+		return 0, errValueNotInteger
+	default:
+		return 0, errWrongType
+	}
+	if n > maxInteger || n < -maxInteger {
+		return 0, errValueNotInteger
+	}
+	return n, nil
+}
+
+// INFO [section ...] replies with the sections of query.Info in Redis'
+// text format. Nested fields are named by their path joined with
+// underscores.
+func info(c *conn, args [][]byte) error {
+	sections, err := c.query().Info()
+	if err != nil {
+		return err
+	}
+	all := len(args) == 1
+	var names []string
+	for _, arg := range args[1:] {
+		name := strings.ToLower(string(arg))
+		if name == "all" || name == "everything" || name == "default" {
+			all = true
+		}
+		names = append(names, name)
+	}
+	if all {
+		names = names[:0]
+		for name := range sections {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	}
+
+	var b strings.Builder
+	for _, name := range names {
+		section, ok := sections[name]
+		if !ok {
+			continue
+		}
+		// Sections are round-tripped through JSON to name their fields
+		// as the other APIs do.
+		encoded, err := json.Marshal(section)
+		if err != nil {
+			return err
+		}
+		var fields interface{}
+		if err := json.Unmarshal(encoded, &fields); err != nil {
+			return err
+		}
+		if b.Len() > 0 {
+			b.WriteString("\r\n")
+		}
+		b.WriteString("# " + strings.ToUpper(name[:1]) + name[1:] + "\r\n")
+		writeInfo(&b, name, fields, true)
+	}
+	c.w.bulkString(b.String())
+	return nil
+}
+
+// writeInfo writes v as field:value lines. The fields of a section's top
+// level are not prefixed with its name.
+func writeInfo(b *strings.Builder, name string, v interface{}, top bool) {
+	field := func(key string) string {
+		if top {
+			return key
+		}
+		return name + "_" + key
+	}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			writeInfo(b, field(k), t[k], false)
+		}
+	case []interface{}:
+		for i, item := range t {
+			writeInfo(b, field(strconv.Itoa(i)), item, false)
+		}
+	case float64:
+		fmt.Fprintf(b, "%s:%s\r\n", name, strconv.FormatFloat(t, 'f', -1, 64))
+	case nil:
+		fmt.Fprintf(b, "%s:\r\n", name)
+	default:
+		fmt.Fprintf(b, "%s:%v\r\n", name, t)
+	}
+}
@@ -0,0 +1,204 @@
+package resp
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"runtime/debug"
+	"strings"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// replyError is an error sent as written, Redis-style, with the kind of
+// error as its first word. It wraps the error it stands for, by which it is
+// classified in metrics.
+type replyError struct {
+	err error
+	msg string
+}
+
+func (e *replyError) Error() string { return e.msg }
+func (e *replyError) Unwrap() error { return e.err }
+
+var (
+	errSyntax      = &replyError{query.ErrParse, "ERR syntax error"}
+	errNotInteger  = &replyError{query.ErrParse, "ERR value is not an integer or out of range"}
+	errNoAuth      = &replyError{auth.ErrNoCredentials, "NOAUTH Authentication required."}
+	errWrongPass   = &replyError{auth.ErrInvalidCredentials, "WRONGPASS invalid username-password pair or user is disabled."}
+	errNoAuthSetup = &replyError{auth.ErrNoCredentials, "ERR AUTH called without any authentication configured"}
+	errInternal    = &replyError{errors.New("internal error"), "ERR internal error"}
+)
+
+// errorCode classifies err for metrics.
+func errorCode(err error) string {
+	if errors.Is(err, auth.ErrNoCredentials) || errors.Is(err, auth.ErrInvalidCredentials) {
+		return auth.CodeUnauthenticated
+	}
+	return query.ErrorCode(err)
+}
+
+// errorLine returns the text of the error reply for err.
+func errorLine(err error) string {
+	var re *replyError
+	switch {
+	case errors.As(err, &re):
+		return re.msg
+	case errors.Is(err, query.ErrWrongType):
+		return "WRONGTYPE " + err.Error()
+	case errors.Is(err, query.ErrPermissionDenied):
+		return "NOPERM " + err.Error()
+	}
+	return "ERR " + err.Error()
+}
+
+// conn is one client connection. Its commands run one at a time on the
+// goroutine reading them.
+type conn struct {
+	s   *Server
+	nc  net.Conn
+	id  int64
+	log *slog.Logger
+	tls *tls.ConnectionState
+	r   *reader
+	w   *writer
+
+	// session is replaced when the client authenticates.
+	session       *query.Session
+	authenticated bool
+	quit          bool
+}
+
+func (s *Server) newConn(nc net.Conn) *conn {
+	c := &conn{
+		s:             s,
+		nc:            nc,
+		r:             newReader(nc, s.maxRequestSize),
+		w:             newWriter(nc),
+		authenticated: s.authn == nil,
+	}
+	if s.authn != nil {
+		c.r.setMax(min(c.r.max, maxUnauthenticatedRequestSize))
+	}
+	c.session = s.query.WithClient(nc.RemoteAddr().String()).NewSession()
+	return c
+}
+
+func (c *conn) query() *query.Query {
+	return c.session.Query()
+}
+
+// serve runs commands until the client disconnects or sends QUIT. Replies
+// are flushed once every command received so far has run, so a pipeline is
+// answered in one write.
+func (c *conn) serve() error {
+	for {
+		args, err := c.r.readCommand()
+		if err != nil {
+			if errors.Is(err, errProtocol) {
+				c.w.error("ERR " + err.Error())
+				c.w.Flush()
+				return err
+			}
+			c.w.Flush()
+			if err == io.EOF || errors.Is(err, os.ErrDeadlineExceeded) {
+				return nil
+			}
+			return err
+		}
+		if len(args) > 0 {
+			c.dispatch(args)
+		}
+		if c.quit {
+			return c.w.Flush()
+		}
+		if !c.r.buffered() {
+			if err := c.w.Flush(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// dispatch runs one command and writes its reply. A panic fails only this
+// command.
+func (c *conn) dispatch(args [][]byte) {
+	start := time.Now()
+	name := strings.ToLower(string(args[0]))
+	cmd, ok := commands[name]
+	if !ok {
+		name = "unknown"
+	}
+	code := codeOK
+	defer func() { observeCommand(name, code, start) }()
+	defer func() {
+		if p := recover(); p != nil {
+			c.log.Error("resp command panicked", "command", name, "panic", p, "stack", string(debug.Stack()))
+			code = query.CodeInternal
+			c.w.error(errInternal.msg)
+		}
+	}()
+
+	var err error
+	switch {
+	case !ok:
+		err = &replyError{query.ErrUnknownCommand, "ERR unknown command '" + string(args[0]) + "'"}
+	case !c.authenticated && !cmd.beforeAuth:
+		err = errNoAuth
+	case (cmd.arity > 0 && len(args) != cmd.arity) || len(args) < -cmd.arity:
+		err = &replyError{query.ErrParse, "ERR wrong number of arguments for '" + name + "' command"}
+	default:
+		err = cmd.run(c, args)
+	}
+	if err != nil {
+		code = errorCode(err)
+		c.w.error(errorLine(err))
+	}
+}
+
+// authenticateTLS authenticates the connection by its verified client
+// certificate, if it has one.
+func (c *conn) authenticateTLS() {
+	if c.s.authn == nil || c.tls == nil {
+		return
+	}
+	p, err := c.s.authn.Authenticate(&http.Request{Header: http.Header{}, TLS: c.tls})
+	if err == nil {
+		c.setPrincipal(p)
+	}
+}
+
+// authenticate checks password as a bearer token. A username other than
+// Redis' "default" must name the principal the token belongs to.
+func (c *conn) authenticate(username, password string) error {
+	if c.s.authn == nil {
+		return errNoAuthSetup
+	}
+	r := &http.Request{Header: http.Header{"Authorization": {"Bearer " + password}}}
+	p, err := c.s.authn.Authenticate(r)
+	if err != nil || (username != "" && username != "default" && username != p.Name) {
+		return errWrongPass
+	}
+	c.setPrincipal(p)
+	return nil
+}
+
+// setPrincipal runs the connection's commands on behalf of p from now on,
+// in the database already selected.
+func (c *conn) setPrincipal(p *auth.Principal) {
+	current := c.query()
+	q := c.s.query.WithPrincipal(p).WithClient(c.nc.RemoteAddr().String())
+	if selected, err := q.Select(current.DB()); err == nil {
+		q = selected
+	}
+	c.session = q.NewSession()
+	c.authenticated = true
+	c.r.setMax(c.s.maxRequestSize)
+	c.log = c.log.With("principal", p.Name)
+}
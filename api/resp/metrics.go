@@ -0,0 +1,24 @@
+package resp
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+const codeOK = "OK"
+
+var (
+	activeConnections = metrics.Default.NewGauge("gokv_resp_connections",
+		"Open RESP connections.")
+	commandsTotal = metrics.Default.NewCounterVec("gokv_resp_commands_total",
+		"RESP commands handled, by command and result code.", "command", "code")
+	commandDuration = metrics.Default.NewHistogramVec("gokv_resp_command_duration_seconds",
+		"Time spent handling RESP commands.", nil, "command")
+)
+
+// observeCommand records one command. name is lower case, or "unknown".
+func observeCommand(name, code string, start time.Time) {
+	commandsTotal.With(name, code).Inc()
+	commandDuration.With(name).Since(start)
+}
@@ -0,0 +1,245 @@
+package resp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+const (
+	// readBufferSize also bounds the length of an inline command.
+	readBufferSize = 16 << 10
+	// maxArgs is the most arguments accepted in one command, as in Redis.
+	maxArgs = 1 << 20
+	// defaultMaxRequestSize bounds a command when no limit is set, as
+	// Redis' proto-max-bulk-len does.
+	defaultMaxRequestSize = 512 << 20
+	// maxUnauthenticatedRequestSize bounds a command until the client has
+	// authenticated, which leaves room for AUTH or HELLO with a token.
+	maxUnauthenticatedRequestSize = 64 << 10
+)
+
+// errProtocol is matched by every malformed command. The connection cannot
+// be resynchronised after one, so it is closed.
+var errProtocol = errors.New("Protocol error")
+
+func protocolErrorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errProtocol, fmt.Sprintf(format, args...))
+}
+
+// reader reads commands sent as arrays of bulk strings, as client libraries
+// do, or inline as space-separated words on one line, as typed into telnet.
+type reader struct {
+	r *bufio.Reader
+	// max bounds the total size of a command's arguments.
+	max int64
+}
+
+func newReader(r io.Reader, max int64) *reader {
+	rd := &reader{r: bufio.NewReaderSize(r, readBufferSize)}
+	rd.setMax(max)
+	return rd
+}
+
+// setMax bounds the total size of a command's arguments. Zero means the
+// default.
+func (r *reader) setMax(max int64) {
+	if max <= 0 {
+		max = defaultMaxRequestSize
+	}
+	r.max = max
+}
+
+// buffered reports whether more of a pipeline has already been received.
+func (r *reader) buffered() bool {
+	return r.r.Buffered() > 0
+}
+
+// readCommand returns the next command's arguments, the first being its
+// name. An empty line yields no arguments.
+func (r *reader) readCommand() ([][]byte, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 || line[0] != '*' {
+		fields := bytes.Fields(line)
+		args := make([][]byte, len(fields))
+		for i, f := range fields {
+			args[i] = bytes.Clone(f)
+		}
+		return args, nil
+	}
+
+	n, err := strconv.ParseInt(string(line[1:]), 10, 64)
+	if err != nil || n > maxArgs {
+		return nil, protocolErrorf("invalid multibulk length")
+	}
+	if n <= 0 {
+		return nil, nil
+	}
+	args := make([][]byte, 0, min(n, 1024))
+	total := int64(0)
+	for i := int64(0); i < n; i++ {
+		line, err := r.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, protocolErrorf("expected '$', got %q", line)
+		}
+		size, err := strconv.ParseInt(string(line[1:]), 10, 64)
+		if err != nil || size < 0 {
+			return nil, protocolErrorf("invalid bulk length")
+		}
+		if total += size; total > r.max {
+			return nil, protocolErrorf("request too large")
+		}
+		arg, err := r.readBulk(size)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, arg)
+	}
+	return args, nil
+}
+
+// readBulk reads a bulk string of size bytes and its CRLF. A large one is
+// read into a buffer that grows as its data arrives, so that a length
+// header alone does not commit the memory.
+func (r *reader) readBulk(size int64) ([]byte, error) {
+	var arg []byte
+	if size <= readBufferSize {
+		arg = make([]byte, size+2)
+		if _, err := io.ReadFull(r.r, arg); err != nil {
+			return nil, err
+		}
+	} else {
+		var buf bytes.Buffer
+		if _, err := io.CopyN(&buf, r.r, size+2); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+		arg = buf.Bytes()
+	}
+	if arg[size] != '\r' || arg[size+1] != '\n' {
+		return nil, protocolErrorf("bulk string not terminated by CRLF")
+	}
+	return arg[:size:size], nil
+}
+
+// readLine returns a line without its terminator. The slice is only valid
+// until the next read.
+func (r *reader) readLine() ([]byte, error) {
+	line, err := r.r.ReadSlice('\n')
+	if err == bufio.ErrBufferFull {
+		return nil, protocolErrorf("too big inline request")
+	}
+	if err != nil {
+		return nil, err
+	}
+	line = line[:len(line)-1]
+	if n := len(line); n > 0 && line[n-1] == '\r' {
+		line = line[:n-1]
+	}
+	return line, nil
+}
+
+var lineBreaks = strings.NewReplacer("\r", " ", "\n", " ")
+
+// writer writes replies in RESP2, or in RESP3 once a client has asked for
+// it with HELLO. Replies are buffered until flushed.
+type writer struct {
+	*bufio.Writer
+	proto int
+}
+
+func newWriter(w io.Writer) *writer {
+	return &writer{Writer: bufio.NewWriter(w), proto: 2}
+}
+
+func (w *writer) line(prefix byte, s string) {
+	w.WriteByte(prefix)
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) simple(s string) {
+	w.line('+', lineBreaks.Replace(s))
+}
+
+func (w *writer) error(s string) {
+	w.line('-', lineBreaks.Replace(s))
+}
+
+func (w *writer) integer(n int64) {
+	w.line(':', strconv.FormatInt(n, 10))
+}
+
+func (w *writer) array(n int) {
+	w.line('*', strconv.Itoa(n))
+}
+
+// mapHeader starts a map of n pairs, which RESP2 sends as a flat array.
+func (w *writer) mapHeader(n int) {
+	if w.proto >= 3 {
+		w.line('%', strconv.Itoa(n))
+		return
+	}
+	w.array(2 * n)
+}
+
+func (w *writer) null() {
+	if w.proto >= 3 {
+		w.WriteString("_\r\n")
+		return
+	}
+	w.WriteString("$-1\r\n")
+}
+
+func (w *writer) bulk(b []byte) {
+	w.line('$', strconv.Itoa(len(b)))
+	w.Write(b)
+	w.WriteString("\r\n")
+}
+
+func (w *writer) bulkString(s string) {
+	w.line('$', strconv.Itoa(len(s)))
+	w.WriteString(s)
+	w.WriteString("\r\n")
+}
+
+// data writes a stored value as a bulk string. Strings and binary values
+// are sent as they are, numbers in decimal and anything else as JSON.
+func (w *writer) data(v interface{}) error {
+	switch d := v.(type) {
+	case string:
+		w.bulkString(d)
+	case []byte:
+		w.bulk(d)
+	case *store.Chunks:
+		w.line('$', strconv.FormatInt(d.Size(), 10))
+		for _, p := range d.Parts() {
+			w.Write(p)
+		}
+		w.WriteString("\r\n")
+	case float64:
+		w.bulkString(strconv.FormatFloat(d, 'f', -1, 64))
+	default:
+		b, err := json.Marshal(d)
+		if err != nil {
+			return err
+		}
+		w.bulk(b)
+	}
+	return nil
+}
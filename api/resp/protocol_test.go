@@ -0,0 +1,103 @@
+package resp
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+func TestReadCommand(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		max   int64
+		args  []string
+		err   string
+	}{
+		{"inline", "SET k v\r\n", 0, []string{"SET", "k", "v"}, ""},
+		{"multibulk", "*2\r\n$3\r\nGET\r\n$1\r\nk\r\n", 0, []string{"GET", "k"}, ""},
+		{"large bulk", "*1\r\n$20000\r\n" + strings.Repeat("x", 20000) + "\r\n", 0, []string{strings.Repeat("x", 20000)}, ""},
+		{"too large", "*1\r\n$101\r\n", 100, nil, "request too large"},
+		{"missing CRLF", "*1\r\n$1\r\nkxy", 0, nil, "not terminated by CRLF"},
+		{"large bulk missing CRLF", "*1\r\n$20000\r\n" + strings.Repeat("x", 20002), 0, nil, "not terminated by CRLF"},
+		{"truncated large bulk", "*1\r\n$20000\r\nxx", 0, nil, "unexpected EOF"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, err := newReader(strings.NewReader(tt.input), tt.max).readCommand()
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("err = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fmt.Sprintf("%q", args) != fmt.Sprintf("%q", tt.args) {
+				t.Fatalf("args = %q, want %q", args, tt.args)
+			}
+		})
+	}
+}
+
+// tokenAuth accepts the bearer token "secret".
+type tokenAuth struct{}
+
+func (tokenAuth) Authenticate(r *http.Request) (*auth.Principal, error) {
+	if r.Header.Get("Authorization") != "Bearer secret" {
+		return nil, auth.ErrInvalidCredentials
+	}
+	return &auth.Principal{Name: "app"}, nil
+}
+
+func TestRequestSizeBeforeAuth(t *testing.T) {
+	s := NewServer(query.New(store.NewDatabases(0, 0)))
+	s.UseAuthenticator(tokenAuth{})
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.serve(ln)
+	defer ln.Close()
+
+	dial := func() (net.Conn, *bufio.Reader) {
+		nc, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		nc.SetDeadline(time.Now().Add(5 * time.Second))
+		return nc, bufio.NewReader(nc)
+	}
+	large := strings.Repeat("x", maxUnauthenticatedRequestSize)
+
+	// A length header over the limit is refused before any data is sent.
+	nc, r := dial()
+	defer nc.Close()
+	fmt.Fprintf(nc, "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$%d\r\n", len(large))
+	if line, _ := r.ReadString('\n'); !strings.Contains(line, "request too large") {
+		t.Fatalf("reply = %q, want a request too large error", line)
+	}
+	if _, err := r.ReadString('\n'); err != io.EOF {
+		t.Fatalf("connection not closed: %v", err)
+	}
+
+	// Once authenticated, the server's own limit applies.
+	nc, r = dial()
+	defer nc.Close()
+	fmt.Fprintf(nc, "AUTH secret\r\n*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$%d\r\n%s\r\n", len(large), large)
+	for _, want := range []string{"+OK\r\n", "+OK\r\n"} {
+		if line, err := r.ReadString('\n'); line != want {
+			t.Fatalf("reply = %q, %v; want %q", line, err, want)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+// Package resp serves the key space over RESP, the Redis protocol, so that
+// redis-cli and Redis client libraries can be used with gokv for simple
+// string workloads.
+//
+// Values are read and written as strings. A value set over RESP is stored
+// as a string if it is valid UTF-8 and as binary otherwise; values set
+// through the other APIs are sent as strings, numbers in decimal and
+// documents as JSON. Logical databases are selected by name with SELECT,
+// so SELECT 0 selects the default one.
+package resp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// shutdownPollInterval is how often Shutdown checks whether every client
+// has disconnected.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// ErrServerClosed is returned by Start and StartTLS after Shutdown.
+var ErrServerClosed = errors.New("resp: server closed")
+
+// Server accepts RESP2 and RESP3 connections. Each connection's commands
+// run in the order they are received, and replies to pipelined commands are
+// written together.
+type Server struct {
+	query     *query.Query
+	authn     auth.Authenticator
+	listening chan struct{}
+	cursors   *cursors
+
+	maxRequestSize int64
+
+	mu      sync.Mutex
+	ln      net.Listener
+	nextID  int64
+	clients map[*conn]struct{}
+	closing bool
+}
+
+func NewServer(query *query.Query) *Server {
+	return &Server{
+		query:     query,
+		listening: make(chan struct{}),
+		cursors:   newCursors(),
+		clients:   make(map[*conn]struct{}),
+	}
+}
+
+func (s *Server) Start(addr string) error {
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(ln)
+}
+
+// StartTLS is like Start but requires TLS using cfg, which must provide the
+// certificate.
+func (s *Server) StartTLS(addr string, cfg *tls.Config) error {
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.serve(tls.NewListener(ln, cfg))
+}
+
+func (s *Server) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	close(s.listening)
+	return ln, nil
+}
+
+// Listening is closed once the server has bound its address.
+func (s *Server) Listening() <-chan struct{} {
+	return s.listening
+}
+
+// UseAuthenticator requires clients to authenticate with AUTH, or HELLO
+// with AUTH, before running commands. The password is checked by a as a
+// bearer token, so it may be an API key or a JWT. A verified TLS client
+// certificate authenticates the connection from the start.
+func (s *Server) UseAuthenticator(a auth.Authenticator) {
+	s.authn = a
+}
+
+// SetMaxRequestSize bounds the total size of a command's arguments, in
+// bytes. Zero means the default of 512MiB. Clients sending larger commands
+// are disconnected.
+func (s *Server) SetMaxRequestSize(n int64) {
+	s.maxRequestSize = n
+}
+
+// Clients returns the number of open connections.
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+func (s *Server) serve(ln net.Listener) error {
+	s.mu.Lock()
+	if s.closing {
+		s.mu.Unlock()
+		ln.Close()
+		return ErrServerClosed
+	}
+	s.ln = ln
+	s.mu.Unlock()
+
+	for {
+		nc, err := ln.Accept()
+		if err != nil {
+			s.mu.Lock()
+			closing := s.closing
+			s.mu.Unlock()
+			if closing {
+				return ErrServerClosed
+			}
+			return err
+		}
+		go s.handle(nc)
+	}
+}
+
+// Shutdown stops accepting connections and lets every client finish the
+// commands it has already sent, then waits for them to disconnect.
+// Connections still open when ctx is done are closed.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	ln := s.ln
+	for c := range s.clients {
+		// Wakes connections waiting for a command; those running one
+		// stop before reading the next.
+		c.nc.SetReadDeadline(time.Now())
+	}
+	s.mu.Unlock()
+
+	var err error
+	if ln != nil {
+		err = ln.Close()
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for s.Clients() > 0 {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.clients {
+				c.nc.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return err
+}
+
+// track registers c and assigns its ID, unless the server is shutting
+// down.
+func (s *Server) track(c *conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.nextID++
+	c.id = s.nextID
+	s.clients[c] = struct{}{}
+	activeConnections.Inc()
+	return true
+}
+
+func (s *Server) untrack(c *conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, c)
+	activeConnections.Dec()
+}
+
+func (s *Server) handle(nc net.Conn) {
+	defer nc.Close()
+	c := s.newConn(nc)
+	if !s.track(c) {
+		return
+	}
+	defer s.untrack(c)
+
+	c.log = slog.With("conn_id", c.id, "remote", nc.RemoteAddr().String())
+	if tc, ok := nc.(*tls.Conn); ok {
+		if err := tc.Handshake(); err != nil {
+			c.log.Warn("resp tls handshake failed", "error", err)
+			return
+		}
+		state := tc.ConnectionState()
+		c.tls = &state
+	}
+	c.authenticateTLS()
+
+	c.log.Info("resp connected")
+	if err := c.serve(); err != nil {
+		c.log.Warn("resp disconnected", "error", err)
+		return
+	}
+	c.log.Info("resp disconnected")
+}
@@ -0,0 +1,225 @@
+package websocket
+
+import (
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// maxInFlight bounds the requests with an id running at once on one
+// connection.
+const maxInFlight = 64
+
+// client is one connection. Every write goes through the out queue to a
+// single writer goroutine, which also sends the pings.
+type client struct {
+	conn  *websocket.Conn
+	id    string
+	codec codec.Codec
+	log   *slog.Logger
+	seq   uint64
+	opts  Options
+
+	inflight chan struct{}
+	wg       sync.WaitGroup
+
+	out      chan interface{}
+	done     chan struct{}
+	doneOnce sync.Once
+	lastRead atomic.Int64
+
+	monitorMu sync.Mutex
+	monitor   func()
+}
+
+func newClient(conn *websocket.Conn, id string, enc codec.Codec, opts Options, log *slog.Logger) *client {
+	c := &client{
+		conn:     conn,
+		id:       id,
+		codec:    enc,
+		log:      log,
+		opts:     opts,
+		inflight: make(chan struct{}, maxInFlight),
+		out:      make(chan interface{}, opts.SendQueue),
+		done:     make(chan struct{}),
+	}
+	c.lastRead.Store(time.Now().UnixNano())
+	conn.SetReadLimit(opts.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(opts.PongTimeout))
+	})
+	return c
+}
+
+// read returns the next message, extending the read deadline.
+func (c *client) read() (int, []byte, error) {
+	messageType, p, err := c.conn.ReadMessage()
+	if err != nil {
+		return 0, nil, err
+	}
+	now := time.Now()
+	c.lastRead.Store(now.UnixNano())
+	c.conn.SetReadDeadline(now.Add(c.opts.PongTimeout))
+	return messageType, p, nil
+}
+
+// nextRequestID identifies a message that carries no "request_id" of its
+// own. Messages are read by a single goroutine.
+func (c *client) nextRequestID() string {
+	c.seq++
+	return c.id + "-" + strconv.FormatUint(c.seq, 10)
+}
+
+// observe records a handled message in the metrics and the access log.
+func (c *client) observe(id, action, code string, start time.Time) {
+	observeMessage(action, code, start)
+	c.log.Info("websocket request", "request_id", id, "action", action, "code", code, "duration", time.Since(start))
+}
+
+// send queues a response, waiting while the queue is full. It reports
+// false if the connection ended first.
+func (c *client) send(v interface{}) bool {
+	select {
+	case c.out <- v:
+		return true
+	case <-c.done:
+		return false
+	}
+}
+
+// push queues a message the client did not ask for, such as a MONITOR
+// event. If the queue is full the message is dropped, or the client
+// disconnected, according to the SlowConsumer option.
+func (c *client) push(v interface{}) {
+	select {
+	case c.out <- v:
+		return
+	case <-c.done:
+		return
+	default:
+	}
+	if c.opts.SlowConsumer == SlowConsumerDrop {
+		slowConsumers.With("dropped").Inc()
+		return
+	}
+	slowConsumers.With("disconnected").Inc()
+	c.log.Warn("disconnecting slow websocket consumer", "queue", c.opts.SendQueue)
+	c.close(websocket.CloseTryAgainLater, "slow consumer")
+	c.end()
+}
+
+// writeLoop writes queued messages and pings until the connection ends.
+func (c *client) writeLoop() {
+	ticker := time.NewTicker(c.opts.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case v := <-c.out:
+			if err := c.write(v); err != nil {
+				if err != websocket.ErrCloseSent {
+					c.log.Warn("websocket write failed", "error", err)
+				}
+				c.end()
+				return
+			}
+		case <-ticker.C:
+			if c.idle() {
+				c.log.Info("closing idle websocket connection", "idle_timeout", c.opts.IdleTimeout)
+				c.close(websocket.CloseNormalClosure, "idle timeout")
+				c.end()
+				return
+			}
+			if err := c.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.opts.WriteTimeout)); err != nil {
+				c.end()
+				return
+			}
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// write encodes v with the connection's codec, in a text frame for JSON and
+// a binary frame otherwise.
+func (c *client) write(v interface{}) error {
+	data, err := c.codec.Marshal(v)
+	if err != nil {
+		c.log.Error("websocket message encoding failed", "error", err)
+		return nil
+	}
+	messageType := websocket.TextMessage
+	if c.codec.Binary() {
+		messageType = websocket.BinaryMessage
+	}
+	c.conn.SetWriteDeadline(time.Now().Add(c.opts.WriteTimeout))
+	return c.conn.WriteMessage(messageType, data)
+}
+
+func (c *client) idle() bool {
+	if c.opts.IdleTimeout <= 0 {
+		return false
+	}
+	c.monitorMu.Lock()
+	monitoring := c.monitor != nil
+	c.monitorMu.Unlock()
+	return !monitoring && time.Since(time.Unix(0, c.lastRead.Load())) > c.opts.IdleTimeout
+}
+
+// end closes the connection, which fails the read loop and any pending
+// send.
+func (c *client) end() {
+	c.doneOnce.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// close sends a close frame. The connection itself is closed once the
+// client answers and the read loop ends.
+func (c *client) close(code int, text string) {
+	msg := websocket.FormatCloseMessage(code, text)
+	if err := c.conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(closeWriteWait)); err != nil {
+		c.log.Debug("websocket close frame failed", "error", err)
+	}
+}
+
+// stopMonitor ends the MONITOR stream, if any.
+func (c *client) stopMonitor() {
+	c.monitorMu.Lock()
+	stop := c.monitor
+	c.monitor = nil
+	c.monitorMu.Unlock()
+
+	if stop != nil {
+		stop()
+	}
+}
+
+// handleMonitor streams every command run on the server to c as
+// {"action": "monitor", "event": {...}} messages until an "unmonitor"
+// action or the connection closes.
+func (s *Server) handleMonitor(c *client, q *query.Query) (map[string]interface{}, error) {
+	c.monitorMu.Lock()
+	defer c.monitorMu.Unlock()
+
+	if c.monitor == nil {
+		events, stop, err := q.Monitor()
+		if err != nil {
+			return nil, err
+		}
+		c.monitor = stop
+		go func() {
+			for e := range events {
+				c.push(map[string]interface{}{"v": ProtocolVersion, "action": "monitor", "event": e})
+			}
+		}()
+	}
+	return map[string]interface{}{"action": "monitor", "status": "ok"}, nil
+}
@@ -0,0 +1,103 @@
+package websocket
+
+import (
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/umgbhalla/gokv/internal/codec"
+)
+
+// newTestClient returns the server side of a connection, without its write
+// loop, and the peer.
+func newTestClient(t *testing.T, opts Options) (*client, *websocket.Conn) {
+	t.Helper()
+	clients := make(chan *client, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := (&websocket.Upgrader{}).Upgrade(w, r, nil)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		clients <- newClient(conn, "test", codec.JSON, opts, slog.Default())
+	}))
+	t.Cleanup(ts.Close)
+	peer, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { peer.Close() })
+	c := <-clients
+	t.Cleanup(c.end)
+	return c, peer
+}
+
+func TestSlowConsumer(t *testing.T) {
+	t.Run(SlowConsumerDrop, func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.SendQueue = 1
+		c, _ := newTestClient(t, opts)
+		c.push("first")
+		c.push("second")
+		select {
+		case <-c.done:
+			t.Fatal("connection ended")
+		default:
+		}
+		if v := <-c.out; v != "first" {
+			t.Errorf("queued %v, want the first message", v)
+		}
+		if len(c.out) != 0 {
+			t.Error("second message queued")
+		}
+	})
+
+	t.Run(SlowConsumerDisconnect, func(t *testing.T) {
+		opts := DefaultOptions()
+		opts.SendQueue = 1
+		opts.SlowConsumer = SlowConsumerDisconnect
+		c, peer := newTestClient(t, opts)
+		c.push("first")
+		c.push("second")
+		select {
+		case <-c.done:
+		default:
+			t.Fatal("connection still open")
+		}
+		if code := closeCode(t, peer); code != websocket.CloseTryAgainLater {
+			t.Errorf("close code = %d, want %d", code, websocket.CloseTryAgainLater)
+		}
+	})
+}
+
+func TestIdleTimeout(t *testing.T) {
+	opts := DefaultOptions()
+	opts.PingInterval = 10 * time.Millisecond
+	opts.IdleTimeout = 50 * time.Millisecond
+	c, peer := newTestClient(t, opts)
+	go c.writeLoop()
+	if code := closeCode(t, peer); code != websocket.CloseNormalClosure {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseNormalClosure)
+	}
+}
+
+// closeCode reads from conn until the server closes it and returns the
+// close code.
+func closeCode(t *testing.T, conn *websocket.Conn) int {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		_, _, err := conn.ReadMessage()
+		if err == nil {
+			continue
+		}
+		if ce, ok := err.(*websocket.CloseError); ok {
+			return ce.Code
+		}
+		t.Fatalf("read: %v", err)
+	}
+}
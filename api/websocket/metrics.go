@@ -0,0 +1,33 @@
+package websocket
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+const (
+	codeOK         = "OK"
+	codeBadMessage = "BAD_MESSAGE"
+)
+
+var (
+	activeConnections = metrics.Default.NewGauge("gokv_websocket_connections",
+		"Open WebSocket connections.")
+	messagesTotal = metrics.Default.NewCounterVec("gokv_websocket_messages_total",
+		"WebSocket requests handled, by action and result code.", "action", "code")
+	messageDuration = metrics.Default.NewHistogramVec("gokv_websocket_message_duration_seconds",
+		"Time spent handling WebSocket requests.", nil, "action")
+	slowConsumers = metrics.Default.NewCounterVec("gokv_websocket_slow_consumer_total",
+		"Pushed messages dropped, or clients disconnected, because their outbound queue was full.", "outcome")
+)
+
+func observeMessage(action, code string, start time.Time) {
+	switch action {
+	case "get", "set", "delete", "query", "monitor", "unmonitor", "invalid":
+	default:
+		action = "unknown"
+	}
+	messagesTotal.With(action, code).Inc()
+	messageDuration.With(action).Since(start)
+}
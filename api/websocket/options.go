@@ -0,0 +1,74 @@
+package websocket
+
+import (
+	"fmt"
+	"time"
+)
+
+// What to do with a pushed message, such as a MONITOR event, when a
+// client's outbound queue is full.
+const (
+	SlowConsumerDrop       = "drop"
+	SlowConsumerDisconnect = "disconnect"
+)
+
+// Options controls keepalive, timeouts and buffering for every connection.
+type Options struct {
+	// PingInterval is how often the server pings the client. A client that
+	// sends nothing, not even a pong, for PongTimeout is disconnected.
+	PingInterval time.Duration
+	PongTimeout  time.Duration
+	// IdleTimeout disconnects clients that send no requests for that long,
+	// unless they are receiving a MONITOR stream. Zero disables it.
+	IdleTimeout time.Duration
+	// WriteTimeout bounds each write. A client that does not read its
+	// responses within it is disconnected.
+	WriteTimeout time.Duration
+	// MaxMessageSize is the largest message accepted, in bytes.
+	MaxMessageSize int64
+	// SendQueue is the number of outbound messages buffered per connection.
+	// Responses wait for room, which stops reading further requests; pushed
+	// messages are handled according to SlowConsumer.
+	SendQueue    int
+	SlowConsumer string
+}
+
+func DefaultOptions() Options {
+	return Options{
+		PingInterval:   30 * time.Second,
+		PongTimeout:    60 * time.Second,
+		WriteTimeout:   10 * time.Second,
+		MaxMessageSize: 1 << 20,
+		SendQueue:      256,
+		SlowConsumer:   SlowConsumerDrop,
+	}
+}
+
+func (o Options) Validate() error {
+	switch {
+	case o.PingInterval <= 0 || o.PongTimeout <= o.PingInterval:
+		return fmt.Errorf("ping interval must be positive and shorter than the pong timeout")
+	case o.IdleTimeout < 0:
+		return fmt.Errorf("idle timeout must not be negative")
+	case o.WriteTimeout <= 0:
+		return fmt.Errorf("write timeout must be positive")
+	case o.MaxMessageSize <= 0:
+		return fmt.Errorf("maximum message size must be positive")
+	case o.SendQueue <= 0:
+		return fmt.Errorf("send queue must be positive")
+	case o.SlowConsumer != SlowConsumerDrop && o.SlowConsumer != SlowConsumerDisconnect:
+		return fmt.Errorf("slow consumer policy must be %s or %s", SlowConsumerDrop, SlowConsumerDisconnect)
+	}
+	return nil
+}
+
+// SetOptions replaces DefaultOptions for connections accepted from now on.
+func (s *Server) SetOptions(o Options) error {
+	if err := o.Validate(); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.opts = o
+	return nil
+}
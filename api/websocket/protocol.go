@@ -0,0 +1,252 @@
+package websocket
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/query"
+)
+
+// ProtocolVersion is the version of the message envelope. Messages without
+// "v" are taken to be of this version. Every response carries it.
+const ProtocolVersion = 1
+
+// subprotocolPrefix is followed by the codec name in the subprotocols a
+// client may ask for: gokv.json, gokv.msgpack and gokv.cbor. Connections
+// that ask for none speak JSON.
+const subprotocolPrefix = "gokv."
+
+// negotiateSubprotocol returns the first subprotocol the client offered
+// that names a codec, and the codec.
+func negotiateSubprotocol(offered []string) (string, codec.Codec) {
+	for _, p := range offered {
+		if !strings.HasPrefix(p, subprotocolPrefix) {
+			continue
+		}
+		if c, err := codec.ByName(strings.TrimPrefix(p, subprotocolPrefix)); err == nil {
+			return p, c
+		}
+	}
+	return "", codec.JSON
+}
+
+// maxIDLen bounds the client-supplied id echoed in responses.
+const maxIDLen = 256
+
+// maxTTLSeconds is the longest TTL, in seconds, a time.Duration holds.
+const maxTTLSeconds = float64(math.MaxInt64 / int64(time.Second))
+
+// request is the message envelope:
+//
+//	{"v": 1, "id": "42", "action": "set", "db": "1", "key": "k", "value": ..., "ttl": 60}
+//
+// Requests with an id may be answered out of order; the id is echoed in the
+// response to match them up. Requests without one are answered in order.
+//
+// Connections that negotiated the gokv.msgpack or gokv.cbor subprotocol send
+// the same envelope as a MessagePack or CBOR map in binary frames, and their
+// values may be byte strings.
+type request struct {
+	V         int             `json:"v"`
+	ID        string          `json:"id"`
+	RequestID string          `json:"request_id"`
+	Action    string          `json:"action"`
+	DB        *string         `json:"db"`
+	Key       *string         `json:"key"`
+	Value     json.RawMessage `json:"value"`
+	TTL       *float64        `json:"ttl"`
+	Query     *string         `json:"query"`
+
+	// value is Value decoded, and hasValue whether it was sent at all.
+	value    interface{}
+	hasValue bool
+}
+
+var (
+	// errBadMessage is wrapped by every message that does not match the
+	// schema.
+	errBadMessage = errors.New("bad message")
+	errInternal   = errors.New("internal error")
+)
+
+// errorCode is the code reported for err: BAD_MESSAGE for messages that do
+// not match the schema, otherwise the query error code.
+func errorCode(err error) string {
+	if errors.Is(err, errBadMessage) {
+		return codeBadMessage
+	}
+	return query.ErrorCode(err)
+}
+
+func badMessage(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", errBadMessage, fmt.Sprintf(format, args...))
+}
+
+// decodeRequest parses message, encoded with c, strictly: unknown fields and
+// fields of the wrong type are rejected. The id is returned whenever it could
+// be read, so that even a rejected request can be answered under it.
+func decodeRequest(message []byte, c codec.Codec) (*request, error) {
+	var req *request
+	var err error
+	if c == codec.JSON {
+		req, err = decodeJSONRequest(message)
+	} else {
+		req, err = decodeBinaryRequest(message, c)
+	}
+	if err != nil {
+		return req, err
+	}
+	if err := req.validate(); err != nil {
+		return req, err
+	}
+	return req, nil
+}
+
+func decodeJSONRequest(message []byte) (*request, error) {
+	dec := json.NewDecoder(bytes.NewReader(message))
+	dec.DisallowUnknownFields()
+	var req request
+	if err := dec.Decode(&req); err != nil {
+		return partialRequest(message), describeJSONError(err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return &req, badMessage("unexpected data after the message")
+	}
+	if req.Value != nil {
+		// Value is already known to be valid JSON.
+		json.Unmarshal(req.Value, &req.value)
+		req.hasValue = true
+	}
+	return &req, nil
+}
+
+// decodeBinaryRequest decodes a MessagePack or CBOR map. Everything but the
+// value, which may hold bytes JSON cannot carry, is checked by the same rules
+// as a JSON message.
+func decodeBinaryRequest(message []byte, c codec.Codec) (*request, error) {
+	var decoded interface{}
+	if err := c.Unmarshal(message, &decoded); err != nil {
+		return &request{}, badMessage("invalid %s: %v", c.Name(), err)
+	}
+	fields, ok := decoded.(map[string]interface{})
+	if !ok {
+		return &request{}, badMessage("message must be a map")
+	}
+	value, hasValue := fields["value"]
+	delete(fields, "value")
+
+	envelope, err := json.Marshal(fields)
+	if err != nil {
+		return &request{}, badMessage("%v", err)
+	}
+	req, err := decodeJSONRequest(envelope)
+	if err != nil {
+		return req, err
+	}
+	req.value, req.hasValue = value, hasValue
+	return req, nil
+}
+
+// partialRequest recovers the id of a message that failed to decode.
+func partialRequest(message []byte) *request {
+	var partial struct {
+		ID json.RawMessage `json:"id"`
+	}
+	req := &request{}
+	if json.Unmarshal(message, &partial) == nil {
+		var id string
+		if json.Unmarshal(partial.ID, &id) == nil && len(id) <= maxIDLen {
+			req.ID = id
+		}
+	}
+	return req
+}
+
+func describeJSONError(err error) error {
+	var typeErr *json.UnmarshalTypeError
+	var syntaxErr *json.SyntaxError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return badMessage("message must be a JSON object")
+	case errors.As(err, &typeErr):
+		return badMessage("field %q must be of type %s", typeErr.Field, jsonTypeName(typeErr.Type.String()))
+	case errors.As(err, &syntaxErr), errors.Is(err, io.EOF), errors.Is(err, io.ErrUnexpectedEOF):
+		return badMessage("invalid JSON")
+	}
+	// Unknown fields are reported as `json: unknown field "x"`.
+	return badMessage("%s", strings.TrimPrefix(err.Error(), "json: "))
+}
+
+func jsonTypeName(goType string) string {
+	switch goType {
+	case "string", "*string":
+		return "string"
+	case "int", "float64", "*float64":
+		return "number"
+	}
+	return goType
+}
+
+// validate checks the fields each action requires and rejects those it
+// does not use.
+func (r *request) validate() error {
+	if len(r.ID) > maxIDLen {
+		return badMessage("id is longer than %d characters", maxIDLen)
+	}
+	if r.V == 0 {
+		r.V = ProtocolVersion
+	}
+	if r.V != ProtocolVersion {
+		return badMessage("unsupported protocol version %d, expected %d", r.V, ProtocolVersion)
+	}
+
+	var required, allowed []string
+	switch r.Action {
+	case "":
+		return badMessage("missing action")
+	case "get", "delete":
+		required = []string{"key"}
+	case "set":
+		required, allowed = []string{"key", "value"}, []string{"ttl"}
+	case "query":
+		required = []string{"query"}
+	case "monitor", "unmonitor":
+	default:
+		return badMessage("unknown action %q", r.Action)
+	}
+
+	present := map[string]bool{
+		"key":   r.Key != nil,
+		"value": r.hasValue,
+		"ttl":   r.TTL != nil,
+		"query": r.Query != nil,
+	}
+	for _, field := range required {
+		if !present[field] {
+			return badMessage("%s requires %q", r.Action, field)
+		}
+		delete(present, field)
+	}
+	for _, field := range allowed {
+		delete(present, field)
+	}
+	for _, field := range []string{"key", "value", "ttl", "query"} {
+		if present[field] {
+			return badMessage("%s does not take %q", r.Action, field)
+		}
+	}
+	if r.TTL != nil && *r.TTL < 0 {
+		return badMessage("ttl must not be negative")
+	}
+	if r.TTL != nil && !(*r.TTL <= maxTTLSeconds) {
+		return badMessage("ttl must be at most %.0f seconds", maxTTLSeconds)
+	}
+	return nil
+}
@@ -2,148 +2,392 @@ package websocket
 
 import (
 	"context"
-	"encoding/json"
-	"log"
+	"crypto/tls"
+	"log/slog"
+	"net"
 	"net/http"
+	"runtime/debug"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/logging"
 	"github.com/umgbhalla/gokv/internal/query"
-	"github.com/umgbhalla/gokv/internal/store"
 )
 
+// shutdownPollInterval is how often Shutdown checks whether every client
+// has disconnected.
+const shutdownPollInterval = 50 * time.Millisecond
+
+// closeWriteWait bounds the time spent sending a close frame.
+const closeWriteWait = time.Second
+
+// Server speaks the WebSocket protocol on /ws. It can listen on its own
+// with Start, or be mounted on another router as an http.Handler.
 type Server struct {
-	store    *store.Store
-	query    *query.Query
-	upgrader websocket.Upgrader
-	clients  map[*websocket.Conn]bool
+	query     *query.Query
+	upgrader  websocket.Upgrader
+	authn     auth.Authenticator
+	server    *http.Server
+	listening chan struct{}
+
+	mu      sync.Mutex
+	opts    Options
+	clients map[*client]struct{}
+	closing bool
 }
 
-func NewServer(store *store.Store, query *query.Query) *Server {
+func NewServer(query *query.Query) *Server {
 	return &Server{
-		store: store,
 		query: query,
 		upgrader: websocket.Upgrader{
 			ReadBufferSize:  1024,
 			WriteBufferSize: 1024,
-			CheckOrigin: func(r *http.Request) bool {
-				return true
-			},
+			CheckOrigin:     auth.CheckOrigin(nil),
 		},
-		clients: make(map[*websocket.Conn]bool),
+		listening: make(chan struct{}),
+		opts:      DefaultOptions(),
+		clients:   make(map[*client]struct{}),
 	}
 }
 
 func (s *Server) Start(addr string) error {
-	http.HandleFunc("/ws", s.handleWebSocket)
-	return http.ListenAndServe(addr, nil)
+	s.server = s.newHTTPServer(addr, nil)
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.server.Serve(ln)
+}
+
+// StartTLS is like Start but accepts wss:// connections using cfg, which
+// must provide the certificate.
+func (s *Server) StartTLS(addr string, cfg *tls.Config) error {
+	s.server = s.newHTTPServer(addr, cfg)
+	ln, err := s.listen(addr)
+	if err != nil {
+		return err
+	}
+	return s.server.ServeTLS(ln, "", "")
+}
+
+func (s *Server) listen(addr string) (net.Listener, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	close(s.listening)
+	return ln, nil
+}
+
+// Listening is closed once the server has bound its address.
+func (s *Server) Listening() <-chan struct{} {
+	return s.listening
+}
+
+// Clients returns the number of open connections.
+func (s *Server) Clients() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.clients)
+}
+
+func (s *Server) newHTTPServer(addr string, cfg *tls.Config) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle("/ws", s)
+	return &http.Server{Addr: addr, Handler: mux, TLSConfig: cfg}
 }
 
+// Shutdown stops accepting connections and sends every client a close
+// frame, then waits for them to disconnect. Connections still open when ctx
+// is done are closed.
 func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.closing = true
+	clients := make([]*client, 0, len(s.clients))
+	for c := range s.clients {
+		clients = append(clients, c)
+	}
+	s.mu.Unlock()
 
-	for conn := range s.clients {
-		conn.Close()
+	// Hijacked WebSocket connections are not tracked by the http.Server.
+	var err error
+	if s.server != nil {
+		err = s.server.Shutdown(ctx)
+	}
+	for _, c := range clients {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+	}
+
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+	for s.Clients() > 0 {
+		select {
+		case <-ctx.Done():
+			s.mu.Lock()
+			for c := range s.clients {
+				c.conn.Close()
+			}
+			s.mu.Unlock()
+			return ctx.Err()
+		case <-ticker.C:
+		}
 	}
-	return nil
+	return err
+}
+
+// track registers c, unless the server is shutting down.
+func (s *Server) track(c *client) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closing {
+		return false
+	}
+	s.clients[c] = struct{}{}
+	activeConnections.Inc()
+	return true
+}
+
+func (s *Server) untrack(c *client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.clients, c)
+	activeConnections.Dec()
+}
+
+// UseAuthenticator requires connections to be authenticated by a before the
+// upgrade.
+func (s *Server) UseAuthenticator(a auth.Authenticator) {
+	s.authn = a
+}
+
+// SetAllowedOrigins lists the cross-origin pages allowed to connect, in
+// addition to same-origin ones. "*" allows any origin.
+func (s *Server) SetAllowedOrigins(origins []string) {
+	s.upgrader.CheckOrigin = auth.CheckOrigin(origins)
 }
 
-func (s *Server) handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+// ServeHTTP upgrades r and serves the connection until it closes.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	closing := s.closing
+	s.mu.Unlock()
+	if closing {
+		http.Error(w, "server shutting down", http.StatusServiceUnavailable)
+		return
+	}
+
+	if s.authn != nil {
+		// Browsers cannot set headers on the upgrade request, so a token
+		// may also be passed as the access_token query parameter.
+		if token := r.URL.Query().Get("access_token"); token != "" && r.Header.Get("Authorization") == "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		p, err := s.authn.Authenticate(r)
+		if err != nil {
+			auth.Unauthorized(w, err)
+			return
+		}
+		r = r.WithContext(auth.NewContext(r.Context(), p))
+	}
+
+	// The connection's ID is echoed in the upgrade response. Messages are
+	// identified by their own "request_id" field, or by the connection's ID
+	// and a sequence number. When mounted on the HTTP router the ID has
+	// already been assigned.
+	id := logging.RequestID(r.Context())
+	if id == "" {
+		id = r.Header.Get(logging.RequestIDHeader)
+	}
+	if !logging.ValidRequestID(id) {
+		id = logging.NewRequestID()
+	}
+	header := http.Header{logging.RequestIDHeader: {id}}
+	subprotocol, enc := negotiateSubprotocol(websocket.Subprotocols(r))
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+	conn, err := s.upgrader.Upgrade(w, r, header)
 	if err != nil {
-		log.Println("WebSocket upgrade failed:", err)
+		slog.Warn("websocket upgrade failed", "request_id", id, "remote", r.RemoteAddr, "error", err)
 		return
 	}
 	defer conn.Close()
 
-	s.clients[conn] = true
-	defer delete(s.clients, conn)
+	principal, _ := auth.FromContext(r.Context())
+	logger := slog.With("conn_id", id, "remote", conn.RemoteAddr().String(), "encoding", enc.Name())
+	if principal != nil {
+		logger = logger.With("principal", principal.Name)
+	}
+	s.mu.Lock()
+	opts := s.opts
+	s.mu.Unlock()
+	c := newClient(conn, id, enc, opts, logger)
+	if !s.track(c) {
+		c.close(websocket.CloseGoingAway, "server shutting down")
+		return
+	}
+	defer s.untrack(c)
+	defer c.end()
+	defer c.stopMonitor()
+	defer c.wg.Wait()
+	go c.writeLoop()
+
+	c.log.Info("websocket connected")
+	session := s.query.WithPrincipal(principal).WithClient(conn.RemoteAddr().String()).NewSession()
 
 	for {
-		messageType, p, err := conn.ReadMessage()
+		_, p, err := c.read()
 		if err != nil {
-			log.Println("WebSocket read error:", err)
+			if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway, websocket.CloseNoStatusReceived) {
+				c.log.Info("websocket disconnected")
+			} else {
+				c.log.Warn("websocket disconnected", "error", err)
+			}
 			return
 		}
-		if messageType == websocket.TextMessage {
-			s.handleMessage(conn, p)
-		}
+		s.dispatch(c, session, p)
 	}
 }
 
-func (s *Server) handleMessage(conn *websocket.Conn, message []byte) {
-	var request map[string]interface{}
-	if err := json.Unmarshal(message, &request); err != nil {
-		s.sendError(conn, "Invalid JSON")
+// dispatch decodes message and handles it in the read loop, in order, or,
+// when it carries an id, concurrently with the connection's other requests.
+// Once maxInFlight requests are running, reading pauses until one ends.
+func (s *Server) dispatch(c *client, session *query.Session, message []byte) {
+	start := time.Now()
+	rid := c.nextRequestID()
+	req, err := decodeRequest(message, c.codec)
+	if logging.ValidRequestID(req.RequestID) {
+		rid = req.RequestID
+	}
+	if err != nil {
+		action := req.Action
+		if action == "" {
+			action = "invalid"
+		}
+		s.reply(c, req, rid, nil, err)
+		c.observe(rid, action, codeBadMessage, start)
 		return
 	}
 
-	action, ok := request["action"].(string)
-	if !ok {
-		s.sendError(conn, "Missing or invalid 'action' field")
+	if req.ID == "" {
+		s.handleRequest(c, session, req, rid, start)
 		return
 	}
+	c.inflight <- struct{}{}
+	c.wg.Add(1)
+	go func() {
+		defer c.wg.Done()
+		defer func() { <-c.inflight }()
+		s.handleRequest(c, session, req, rid, start)
+	}()
+}
+
+// handleRequest runs req and answers it. A panic fails only this request.
+func (s *Server) handleRequest(c *client, session *query.Session, req *request, rid string, start time.Time) {
+	code := codeOK
+	defer func() { c.observe(rid, req.Action, code, start) }()
+	defer func() {
+		if p := recover(); p != nil {
+			c.log.Error("websocket request panicked", "request_id", rid, "panic", p, "stack", string(debug.Stack()))
+			code = query.CodeInternal
+			s.reply(c, req, rid, nil, errInternal)
+		}
+	}()
 
-	switch action {
+	response, err := s.run(c, session, req)
+	if err != nil {
+		code = errorCode(err)
+	}
+	s.reply(c, req, rid, response, err)
+}
+
+func (s *Server) run(c *client, session *query.Session, req *request) (map[string]interface{}, error) {
+	// A "db" field runs this one request against another database without
+	// changing the connection's selection.
+	if req.DB != nil {
+		q, err := session.Query().Select(*req.DB)
+		if err != nil {
+			return nil, err
+		}
+		session = q.NewSession()
+	}
+
+	switch req.Action {
 	case "get":
-		s.handleGet(conn, request["key"].(string))
+		return s.handleGet(session.Query(), *req.Key)
 	case "set":
-		s.handleSet(conn, request["key"].(string), request["value"], request["ttl"])
+		return s.handleSet(session.Query(), *req.Key, req.value, req.TTL)
 	case "delete":
-		s.handleDelete(conn, request["key"].(string))
+		return s.handleDelete(session.Query(), *req.Key)
 	case "query":
-		s.handleQuery(conn, request["query"].(string))
-	default:
-		s.sendError(conn, "Unknown action")
+		return s.handleQuery(session, *req.Query)
+	case "monitor":
+		return s.handleMonitor(c, session.Query())
+	case "unmonitor":
+		c.stopMonitor()
+		return map[string]interface{}{"action": "unmonitor", "status": "ok"}, nil
 	}
+	// decodeRequest has rejected every other action.
+	return nil, badMessage("unknown action %q", req.Action)
 }
 
-func (s *Server) handleGet(conn *websocket.Conn, key string) {
-	value, ok := s.store.Get(key)
-	if !ok {
-		s.sendError(conn, "Key not found")
-		return
+// The handlers below return the response on success and the error
+// otherwise.
+
+func (s *Server) handleGet(q *query.Query, key string) (map[string]interface{}, error) {
+	value, err := q.Get(key)
+	if err != nil {
+		return nil, err
 	}
-	s.sendResponse(conn, map[string]interface{}{"action": "get", "key": key, "value": value})
+	return map[string]interface{}{"action": "get", "key": key, "value": value}, nil
 }
 
-func (s *Server) handleSet(conn *websocket.Conn, key string, value interface{}, ttl interface{}) {
+func (s *Server) handleSet(q *query.Query, key string, value interface{}, ttl *float64) (map[string]interface{}, error) {
 	var duration time.Duration
 	if ttl != nil {
-		if ttlFloat, ok := ttl.(float64); ok {
-			duration = time.Duration(ttlFloat) * time.Second
-		}
+		// Scaled as a float so that fractions of a second are kept.
+		duration = time.Duration(*ttl * float64(time.Second))
 	}
 
-	if err := s.store.Set(key, value, duration); err != nil {
-		s.sendError(conn, "Error setting value")
-		return
+	if err := q.Set(key, value, duration); err != nil {
+		return nil, err
 	}
-	s.sendResponse(conn, map[string]interface{}{"action": "set", "key": key, "status": "ok"})
+	return map[string]interface{}{"action": "set", "key": key, "status": "ok"}, nil
 }
 
-func (s *Server) handleDelete(conn *websocket.Conn, key string) {
-	if err := s.store.Delete(key); err != nil {
-		s.sendError(conn, "Error deleting key")
-		return
+func (s *Server) handleDelete(q *query.Query, key string) (map[string]interface{}, error) {
+	if err := q.Delete(key); err != nil {
+		return nil, err
 	}
-	s.sendResponse(conn, map[string]interface{}{"action": "delete", "key": key, "status": "ok"})
+	return map[string]interface{}{"action": "delete", "key": key, "status": "ok"}, nil
 }
 
-func (s *Server) handleQuery(conn *websocket.Conn, queryString string) {
-	result, err := s.query.Execute(queryString)
+func (s *Server) handleQuery(session *query.Session, queryString string) (map[string]interface{}, error) {
+	result, err := session.Execute(queryString)
 	if err != nil {
-		s.sendError(conn, "Error executing query")
-		return
+		return nil, err
 	}
-	s.sendResponse(conn, map[string]interface{}{"action": "query", "result": result})
+	return map[string]interface{}{"action": "query", "result": result}, nil
 }
 
-func (s *Server) sendError(conn *websocket.Conn, message string) {
-	s.sendResponse(conn, map[string]interface{}{"error": message})
+// reply answers req with response or, if err is set, with the error and
+// its code.
+func (s *Server) reply(c *client, req *request, rid string, response map[string]interface{}, err error) {
+	if err != nil {
+		response = map[string]interface{}{"error": err.Error(), "code": errorCode(err)}
+	}
+	response["v"] = ProtocolVersion
+	response["request_id"] = rid
+	if req.ID != "" {
+		response["id"] = req.ID
+	}
+	s.sendResponse(c, response)
 }
 
-func (s *Server) sendResponse(conn *websocket.Conn, response interface{}) {
-	if err := conn.WriteJSON(response); err != nil {
-		log.Println("WebSocket write error:", err)
+func (s *Server) sendResponse(c *client, response interface{}) {
+	if !c.send(response) {
+		c.log.Debug("websocket response dropped, connection closed")
 	}
 }
@@ -0,0 +1,170 @@
+package websocket
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// dial serves s on a test server and connects to it.
+func dial(t *testing.T, s *Server) *websocket.Conn {
+	t.Helper()
+	ts := httptest.NewServer(s)
+	t.Cleanup(ts.Close)
+	conn, _, err := websocket.DefaultDialer.Dial("ws"+strings.TrimPrefix(ts.URL, "http"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// receive reads the next response.
+func receive(t *testing.T, conn *websocket.Conn) map[string]interface{} {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var response map[string]interface{}
+	if err := conn.ReadJSON(&response); err != nil {
+		t.Fatal(err)
+	}
+	return response
+}
+
+// roundTrip sends message and returns the response.
+func roundTrip(t *testing.T, conn *websocket.Conn, message string) map[string]interface{} {
+	t.Helper()
+	if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+		t.Fatal(err)
+	}
+	return receive(t, conn)
+}
+
+func TestSetTTL(t *testing.T) {
+	tests := []struct {
+		ttl  string
+		code string
+		// expires reports whether the value is stored with an expiry.
+		expires bool
+	}{
+		{"0", "", false},
+		{"0.5", "", true},
+		{"10", "", true},
+		{"-1", codeBadMessage, false},
+		{"1e300", codeBadMessage, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ttl, func(t *testing.T) {
+			dbs := store.NewDatabases(0, 0)
+			conn := dial(t, NewServer(query.New(dbs)))
+			response := roundTrip(t, conn, `{"action":"set","key":"k","value":1,"ttl":`+tt.ttl+`}`)
+			if code, _ := response["code"].(string); code != tt.code {
+				t.Fatalf("code = %q, want %q: %v", code, tt.code, response)
+			}
+			v, ok := dbs.Default().GetValue("k")
+			if ok != (tt.code == "") {
+				t.Fatalf("stored = %v", ok)
+			}
+			if expires := !v.ExpiresAt.IsZero(); expires != tt.expires {
+				t.Errorf("expires = %v, want %v", expires, tt.expires)
+			}
+		})
+	}
+}
+
+func TestBadMessages(t *testing.T) {
+	tests := []struct {
+		name, message, id string
+	}{
+		{"invalid JSON", `{"id":"a","action":"get"`, ""},
+		{"not an object", `["get"]`, ""},
+		{"wrong type", `{"id":"b","action":"get","key":1}`, "b"},
+		{"unknown field", `{"id":"c","action":"get","key":"k","bogus":1}`, "c"},
+		{"unknown action", `{"id":"d","action":"frob"}`, "d"},
+		{"missing field", `{"id":"e","action":"set","key":"k"}`, "e"},
+		{"extra field", `{"id":"f","action":"get","key":"k","ttl":1}`, "f"},
+		{"unsupported version", `{"v":2,"id":"g","action":"get","key":"k"}`, "g"},
+	}
+	conn := dial(t, NewServer(query.New(store.NewDatabases(0, 0))))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := roundTrip(t, conn, tt.message)
+			if response["code"] != codeBadMessage {
+				t.Errorf("code = %v, want %s", response["code"], codeBadMessage)
+			}
+			if id, _ := response["id"].(string); id != tt.id {
+				t.Errorf("id = %q, want %q", id, tt.id)
+			}
+		})
+	}
+
+	// The connection survives bad messages.
+	response := roundTrip(t, conn, `{"action":"set","key":"k","value":1}`)
+	if response["status"] != "ok" {
+		t.Fatalf("set after bad messages: %v", response)
+	}
+}
+
+func TestPipelinedIDs(t *testing.T) {
+	const n = 20
+	dbs := store.NewDatabases(0, 0)
+	for i := 0; i < n; i++ {
+		dbs.Default().Set(fmt.Sprint("k", i), float64(i), 0)
+	}
+	conn := dial(t, NewServer(query.New(dbs)))
+	for i := 0; i < n; i++ {
+		message := fmt.Sprintf(`{"id":"r%d","action":"get","key":"k%d"}`, i, i)
+		if err := conn.WriteMessage(websocket.TextMessage, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Responses may come in any order, but each carries the id of its
+	// request.
+	seen := make(map[string]bool)
+	for i := 0; i < n; i++ {
+		response := receive(t, conn)
+		id, _ := response["id"].(string)
+		var value float64
+		if _, err := fmt.Sscanf(id, "r%v", &value); err != nil {
+			t.Fatalf("unexpected id in %v", response)
+		}
+		if response["value"] != value {
+			t.Errorf("%s: value = %v, want %v", id, response["value"], value)
+		}
+		if seen[id] {
+			t.Errorf("%s answered twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	s := NewServer(query.New(store.NewDatabases(0, 0)))
+	conn := dial(t, s)
+	// The connection is registered once it has answered.
+	roundTrip(t, conn, `{"action":"get","key":"k"}`)
+
+	done := make(chan error, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		done <- s.Shutdown(ctx)
+	}()
+	// Reading answers the close frame, which lets Shutdown finish.
+	if code := closeCode(t, conn); code != websocket.CloseGoingAway {
+		t.Errorf("close code = %d, want %d", code, websocket.CloseGoingAway)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if n := s.Clients(); n != 0 {
+		t.Errorf("%d clients after shutdown", n)
+	}
+}
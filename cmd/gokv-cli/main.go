@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"encoding/json"
 	"fmt"
 	"os"
 	"strings"
@@ -12,10 +13,41 @@ import (
 
 func main() {
 	// Initialize the GoKV client
-	gokv := client.New("http://localhost:8080")
+	baseURL := os.Getenv("GOKV_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:8080"
+	}
+	root := client.New(baseURL)
+	if caFile := os.Getenv("GOKV_CA_CERT"); caFile != "" {
+		var err error
+		if root, err = root.WithCACert(caFile); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading CA certificate:", err)
+			os.Exit(1)
+		}
+	}
+	if certFile := os.Getenv("GOKV_CLIENT_CERT"); certFile != "" {
+		var err error
+		if root, err = root.WithClientCert(certFile, os.Getenv("GOKV_CLIENT_KEY")); err != nil {
+			fmt.Fprintln(os.Stderr, "Error loading client certificate:", err)
+			os.Exit(1)
+		}
+	}
+	if key := os.Getenv("GOKV_API_KEY"); key != "" {
+		root = root.WithAPIKey(key)
+	}
+	if token := os.Getenv("GOKV_TOKEN"); token != "" {
+		root = root.WithToken(token)
+	}
+	gokv := root
 
 	fmt.Println("GoKV CLI")
-	fmt.Println("Commands: GET <key>, SET <key> <value> [ttl], DELETE <key>, EXIT")
+	fmt.Println("Commands: GET <key>, SET <key> <value> [ttl], DELETE <key>, SELECT <db>, EXIT")
+	fmt.Println("Queries:  KEYS <glob>, KEYS REGEX <re>")
+	fmt.Println("          SCAN <prefix> [MATCH <glob> | REGEX <re>] [WHERE <expr>] [ORDER BY <path> [ASC|DESC]] [LIMIT <n>] [CURSOR <c>] [COUNT <n>], INDEX CREATE|DROP <path>, INDEX LIST")
+	fmt.Println("          DELPREFIX <prefix>, DELMATCH <glob>, EXPIRE <key> <ttl>, EXPIREPREFIX <prefix> <ttl>, RENAME|COPY <src> <dst>, RENAMEPREFIX <from> <to>, JOB <id>, JOBS")
+	fmt.Println("          COUNT <prefix> | SUM|AVG|MIN|MAX <prefix> <path> [WHERE <expr>] [GROUP BY <path>]")
+	fmt.Println("          ACL WHOAMI, ACL LIST, ACL GETUSER <name>, ACL DELUSER <name>, INFO [section]")
+	fmt.Println("          SLOWLOG GET [n], SLOWLOG LEN, SLOWLOG RESET")
 
 	scanner := bufio.NewScanner(os.Stdin)
 	for {
@@ -24,6 +56,11 @@ func main() {
 			break
 		}
 		command := scanner.Text()
+		if parts := strings.Fields(command); len(parts) == 2 && strings.EqualFold(parts[0], "SELECT") {
+			gokv = root.DB(parts[1])
+			fmt.Println("OK")
+			continue
+		}
 		if err := executeCommand(gokv, command); err != nil {
 			fmt.Printf("Error: %v\n", err)
 		}
@@ -60,6 +97,9 @@ func executeCommand(gokv *client.Client, command string) error {
 			return fmt.Errorf("usage: DELETE <key>")
 		}
 		return executeDelete(gokv, parts[1])
+	case "SCAN", "KEYS", "INDEX", "DATABASES", "ACL", "INFO", "SLOWLOG", "COUNT", "SUM", "AVG", "MIN", "MAX",
+		"DELPREFIX", "DELMATCH", "EXPIRE", "EXPIREPREFIX", "RENAME", "COPY", "RENAMEPREFIX", "JOB", "JOBS":
+		return executeQuery(gokv, command)
 	case "EXIT":
 		fmt.Println("Goodbye!")
 		os.Exit(0)
@@ -95,3 +135,16 @@ func executeDelete(gokv *client.Client, key string) error {
 	fmt.Println("OK")
 	return nil
 }
+
+func executeQuery(gokv *client.Client, queryString string) error {
+	result, err := gokv.Query(queryString)
+	if err != nil {
+		return err
+	}
+	out, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	return nil
+}
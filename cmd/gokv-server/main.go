@@ -2,19 +2,31 @@ package main
 
 import (
 	"context"
-	"log"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
-	"time"
 
 	"github.com/go-openapi/runtime/middleware"
+	grpcServer "github.com/umgbhalla/gokv/api/grpc"
 	httpServer "github.com/umgbhalla/gokv/api/http"
+	mcServer "github.com/umgbhalla/gokv/api/memcached"
+	respServer "github.com/umgbhalla/gokv/api/resp"
 	wsServer "github.com/umgbhalla/gokv/api/websocket"
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/config"
+	"github.com/umgbhalla/gokv/internal/health"
+	"github.com/umgbhalla/gokv/internal/logging"
+	"github.com/umgbhalla/gokv/internal/metrics"
 	"github.com/umgbhalla/gokv/internal/persistence"
 	"github.com/umgbhalla/gokv/internal/query"
 	"github.com/umgbhalla/gokv/internal/store"
+	"github.com/umgbhalla/gokv/internal/version"
 )
 
 // @title GoKV API
@@ -24,28 +36,164 @@ import (
 // @BasePath /
 
 func main() {
-	logFile, err := os.OpenFile("gokv.log", os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+	loader := config.NewLoader(flag.CommandLine)
+	printConfig := flag.Bool("print-config", false, "print the effective configuration as YAML and exit")
+	flag.Parse()
+
+	cfg, err := loader.Load()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:", err)
+		os.Exit(2)
+	}
+	if *printConfig {
+		if err := cfg.Print(os.Stdout); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	logFile, err := logging.Setup(cfg.Logging())
 	if err != nil {
-		log.Fatalf("Error opening log file: %v", err)
+		fmt.Fprintln(os.Stderr, "Error setting up logging:", err)
+		os.Exit(1)
 	}
 	defer logFile.Close()
-	log.SetOutput(logFile)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
 
-	log.Println("Starting GoKV server...")
+	slog.Info("starting gokv server", "version", version.Version, "config", loader.File())
+
+	dbs := store.NewDatabases(cfg.Store.MaxDatabases, cfg.Store.SweepInterval)
+	dbs.RegisterMetrics(metrics.Default)
+	kvQuery := query.New(dbs)
+	kvQuery.SetLimits(cfg.QueryLimits())
+	applyReloadable(kvQuery, cfg)
 
-	kvStore := store.New()
-	kvQuery := query.New(kvStore)
+	components := []string{"persistence", "http", "websocket"}
+	if cfg.RESP.Addr != "" {
+		components = append(components, "resp")
+	}
+	if cfg.Memcached.Addr != "" {
+		components = append(components, "memcached")
+	}
+	if cfg.GRPC.Addr != "" {
+		components = append(components, "grpc")
+	}
+	readiness := health.NewReadiness(components...)
 
-	persister := persistence.New(kvStore, "data.json", 30*time.Second)
+	persister := persistence.New(dbs, cfg.Persistence.File, cfg.Persistence.Interval)
+	// Serving without the snapshot would let the next save overwrite it.
 	if err := persister.Load(); err != nil {
-		log.Printf("Error loading data: %v", err)
+		fatal("loading snapshot failed", err)
 	}
+	readiness.MarkReady("persistence")
 	go persister.Start()
 
-	httpSrv := httpServer.NewServer(kvStore, kvQuery)
+	httpSrv := httpServer.NewServer(kvQuery)
+	httpSrv.SetMaxRequestSize(int64(cfg.Limits.MaxRequestSize))
+	httpSrv.SetChunking(int64(cfg.Store.ChunkThreshold), cfg.Store.ChunkSize)
 
-	wsSrv := wsServer.NewServer(kvStore, kvQuery)
+	wsSrv := wsServer.NewServer(kvQuery)
+	if err := wsSrv.SetOptions(websocketOptions(cfg.WebSocket)); err != nil {
+		fatal("configuring websocket server failed", err)
+	}
+	httpSrv.MountWebSocket(wsSrv)
+
+	respSrv := respServer.NewServer(kvQuery)
+	respSrv.SetMaxRequestSize(int64(cfg.Limits.MaxRequestSize))
+
+	mcSrv := mcServer.NewServer(kvQuery)
+	mcSrv.SetMaxItemSize(int64(cfg.Limits.MaxRequestSize))
+
+	grpcSrv := grpcServer.NewServer(kvQuery)
+	grpcSrv.SetMaxRequestSize(cfg.Limits.MaxRequestSize)
+
+	httpSrv.SetReadiness(readiness)
+	kvQuery.AddInfoSection("persistence", func() interface{} { return persister.Status() })
+	kvQuery.AddInfoSection("clients", func() interface{} {
+		return map[string]int{"websocket": wsSrv.Clients(), "resp": respSrv.Clients(), "memcached": mcSrv.Clients(), "grpc": grpcSrv.Clients()}
+	})
+	go func() {
+		<-httpSrv.Listening()
+		readiness.MarkReady("http")
+	}()
+	go func() {
+		// Without its own listener the WebSocket API is up with the HTTP one.
+		if cfg.WebSocket.Addr != "" {
+			<-wsSrv.Listening()
+		} else {
+			<-httpSrv.Listening()
+		}
+		readiness.MarkReady("websocket")
+	}()
+	if cfg.RESP.Addr != "" {
+		go func() {
+			<-respSrv.Listening()
+			readiness.MarkReady("resp")
+		}()
+	}
+	if cfg.Memcached.Addr != "" {
+		go func() {
+			<-mcSrv.Listening()
+			readiness.MarkReady("memcached")
+		}()
+	}
+	if cfg.GRPC.Addr != "" {
+		go func() {
+			<-grpcSrv.Listening()
+			if grpcSrv.Addr() != nil {
+				readiness.MarkReady("grpc")
+			}
+		}()
+	}
+
+	tlsCfg := cfg.TLSFiles()
+	var serverTLS *tls.Config
+	if tlsCfg.Enabled() {
+		serverTLS, err = tlsCfg.Server()
+		if err != nil {
+			fatal("setting up tls failed", err)
+		}
+	}
+
+	var authCfg auth.Config
+	if cfg.Auth.Config != "" {
+		authCfg, err = auth.LoadConfig(cfg.Auth.Config)
+		if err != nil {
+			fatal("loading auth config failed", err)
+		}
+	}
+	// Verified client certificates identify the caller ahead of any API key
+	// or token.
+	var authn auth.Chain
+	if tlsCfg.MutualTLS() {
+		authn = append(authn, auth.NewClientCert(authCfg.ClientCerts))
+	}
+	if cfg.Auth.Config != "" {
+		configured, err := authCfg.Authenticator()
+		if err != nil {
+			fatal("setting up authentication failed", err)
+		}
+		if configured != nil {
+			authn = append(authn, configured)
+		}
+		wsSrv.SetAllowedOrigins(authCfg.AllowedOrigins)
+		if authCfg.ACLFile != "" {
+			acl, err := query.LoadACL(authCfg.ACLFile)
+			if err != nil {
+				fatal("loading acl failed", err)
+			}
+			kvQuery.SetACL(acl)
+		}
+	}
+	if len(authn) > 0 {
+		httpSrv.UseAuthenticator(authn)
+		wsSrv.UseAuthenticator(authn)
+		respSrv.UseAuthenticator(authn)
+		mcSrv.UseAuthenticator(authn)
+		grpcSrv.UseAuthenticator(authn)
+	} else {
+		slog.Warn("no -auth-config or -tls-client-ca given, authentication is disabled")
+	}
 
 	opts := middleware.SwaggerUIOpts{SpecURL: "/swagger.json"}
 	sh := middleware.SwaggerUI(opts, nil)
@@ -53,41 +201,171 @@ func main() {
 	httpSrv.Router().Handle("/swagger.json", http.FileServer(http.Dir("./docs")))
 
 	go func() {
-		log.Printf("Starting HTTP server on :8080")
-		if err := httpSrv.Start(":8080"); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("HTTP server error: %v", err)
+		slog.Info("starting http server", "addr", cfg.HTTP.Addr, "tls", serverTLS != nil)
+		start := httpSrv.Start
+		if serverTLS != nil {
+			start = func(addr string) error { return httpSrv.StartTLS(addr, serverTLS) }
 		}
-	}()
-
-	go func() {
-		log.Printf("Starting WebSocket server on :8081")
-		if err := wsSrv.Start(":8081"); err != nil {
-			log.Fatalf("WebSocket server error: %v", err)
+		if err := start(cfg.HTTP.Addr); err != nil && err != http.ErrServerClosed {
+			fatal("http server failed", err)
 		}
 	}()
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	if cfg.WebSocket.Addr != "" {
+		go func() {
+			slog.Info("starting websocket server", "addr", cfg.WebSocket.Addr, "tls", serverTLS != nil)
+			start := wsSrv.Start
+			if serverTLS != nil {
+				start = func(addr string) error { return wsSrv.StartTLS(addr, serverTLS) }
+			}
+			if err := start(cfg.WebSocket.Addr); err != nil && err != http.ErrServerClosed {
+				fatal("websocket server failed", err)
+			}
+		}()
+	}
 
-	log.Println("Shutting down...")
+	if cfg.RESP.Addr != "" {
+		go func() {
+			slog.Info("starting resp server", "addr", cfg.RESP.Addr, "tls", serverTLS != nil)
+			start := respSrv.Start
+			if serverTLS != nil {
+				start = func(addr string) error { return respSrv.StartTLS(addr, serverTLS) }
+			}
+			if err := start(cfg.RESP.Addr); err != nil && err != respServer.ErrServerClosed {
+				fatal("resp server failed", err)
+			}
+		}()
+	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancel()
+	if cfg.Memcached.Addr != "" {
+		go func() {
+			slog.Info("starting memcached server", "addr", cfg.Memcached.Addr, "tls", serverTLS != nil)
+			start := mcSrv.Start
+			if serverTLS != nil {
+				start = func(addr string) error { return mcSrv.StartTLS(addr, serverTLS) }
+			}
+			if err := start(cfg.Memcached.Addr); err != nil && err != mcServer.ErrServerClosed {
+				fatal("memcached server failed", err)
+			}
+		}()
+	}
 
-	if err := httpSrv.Shutdown(ctx); err != nil {
-		log.Printf("HTTP server shutdown error: %v", err)
+	if cfg.GRPC.Addr != "" {
+		go func() {
+			slog.Info("starting grpc server", "addr", cfg.GRPC.Addr, "tls", serverTLS != nil)
+			start := grpcSrv.Start
+			if serverTLS != nil {
+				start = func(addr string) error { return grpcSrv.StartTLS(addr, serverTLS) }
+			}
+			if err := start(cfg.GRPC.Addr); err != nil && err != grpcServer.ErrServerClosed {
+				fatal("grpc server failed", err)
+			}
+		}()
 	}
 
-	if err := wsSrv.Shutdown(ctx); err != nil {
-		log.Printf("WebSocket server shutdown error: %v", err)
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+	for sig := range sigChan {
+		if sig != syscall.SIGHUP {
+			break
+		}
+		cfg = reload(loader, cfg, kvQuery)
 	}
 
+	slog.Info("shutting down")
+
+	// In-flight HTTP requests drain while WebSocket clients are sent close
+	// frames, RESP and memcached clients finish their pipelines and gRPC
+	// calls and open transactions complete; all share the deadline, after
+	// which the snapshot is written regardless.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	wg.Add(5)
+	go func() {
+		defer wg.Done()
+		if err := httpSrv.Shutdown(ctx); err != nil {
+			slog.Error("http server shutdown failed", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := wsSrv.Shutdown(ctx); err != nil {
+			slog.Error("websocket server shutdown failed", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := respSrv.Shutdown(ctx); err != nil {
+			slog.Error("resp server shutdown failed", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := mcSrv.Shutdown(ctx); err != nil {
+			slog.Error("memcached server shutdown failed", "error", err)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		if err := grpcSrv.Shutdown(ctx); err != nil {
+			slog.Error("grpc server shutdown failed", "error", err)
+		}
+	}()
+	wg.Wait()
+
 	persister.Stop()
 
 	if err := persister.Save(); err != nil {
-		log.Printf("Error saving final state: %v", err)
+		slog.Error("saving final snapshot failed", "error", err)
+	}
+
+	slog.Info("shutdown complete")
+}
+
+// websocketOptions returns the per-connection options of the WebSocket
+// server.
+func websocketOptions(c config.WebSocketConfig) wsServer.Options {
+	return wsServer.Options{
+		PingInterval:   c.PingInterval,
+		PongTimeout:    c.PongTimeout,
+		IdleTimeout:    c.IdleTimeout,
+		WriteTimeout:   c.WriteTimeout,
+		MaxMessageSize: int64(c.MaxMessageSize),
+		SendQueue:      c.SendQueue,
+		SlowConsumer:   c.SlowConsumer,
 	}
+}
+
+// applyReloadable applies the settings that can change while running.
+func applyReloadable(q *query.Query, cfg *config.Config) {
+	if level, err := logging.ParseLevel(cfg.Log.Level); err == nil {
+		logging.SetLevel(level)
+	}
+	q.ConfigureSlowlog(cfg.Slowlog.Threshold, cfg.Slowlog.MaxLen)
+	q.SetRedactedPrefixes(cfg.Monitor.Redact)
+}
+
+// reload rereads the configuration on SIGHUP and applies what it can. An
+// invalid configuration is ignored and the current one kept.
+func reload(loader *config.Loader, current *config.Config, q *query.Query) *config.Config {
+	next, err := loader.Load()
+	if err != nil {
+		slog.Error("reloading configuration failed, keeping the current one", "error", err)
+		return current
+	}
+	if changed := current.RestartRequired(next); len(changed) > 0 {
+		slog.Warn("configuration changes that require a restart were not applied", "sections", changed)
+	}
+	applied := current.Reloaded(next)
+	applyReloadable(q, applied)
+	slog.Info("configuration reloaded", "config", loader.File())
+	return applied
+}
 
-	log.Println("Shutdown complete")
+// fatal logs err and exits. Deferred calls do not run.
+func fatal(msg string, err error) {
+	slog.Error(msg, "error", err)
+	os.Exit(1)
 }
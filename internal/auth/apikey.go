@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"net/http"
+)
+
+// APIKey is a static credential from the configuration.
+type APIKey struct {
+	Name  string   `json:"name"`
+	Key   string   `json:"key"`
+	Roles []string `json:"roles,omitempty"`
+}
+
+// APIKeys authenticates requests by the X-API-Key header or a bearer token
+// equal to one of the configured keys. Keys are held only as SHA-256 digests,
+// so lookups do not leak timing about the key text.
+type APIKeys struct {
+	keys map[[sha256.Size]byte]*Principal
+}
+
+func NewAPIKeys(keys []APIKey) *APIKeys {
+	a := &APIKeys{keys: make(map[[sha256.Size]byte]*Principal, len(keys))}
+	for _, k := range keys {
+		a.keys[sha256.Sum256([]byte(k.Key))] = &Principal{Name: k.Name, Method: MethodAPIKey, Roles: k.Roles}
+	}
+	return a
+}
+
+func (a *APIKeys) Authenticate(r *http.Request) (*Principal, error) {
+	key := r.Header.Get(APIKeyHeader)
+	if key == "" {
+		key = bearerToken(r)
+	}
+	if key == "" {
+		return nil, ErrNoCredentials
+	}
+	p, ok := a.keys[sha256.Sum256([]byte(key))]
+	if !ok {
+		if r.Header.Get(APIKeyHeader) == "" {
+			// A bearer token that is not a known key may be a JWT.
+			return nil, ErrNoCredentials
+		}
+		return nil, ErrInvalidCredentials
+	}
+	return p, nil
+}
@@ -0,0 +1,85 @@
+// Package auth authenticates HTTP and WebSocket clients with static API keys
+// or JWTs and carries the resulting Principal in the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+var (
+	// ErrNoCredentials means the request carried no credentials the
+	// authenticator understands.
+	ErrNoCredentials = errors.New("no credentials")
+	// ErrInvalidCredentials means credentials were present but rejected.
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
+const (
+	MethodAPIKey = "apikey"
+	MethodJWT    = "jwt"
+)
+
+// APIKeyHeader carries a static API key. Keys may also be sent as a bearer
+// token.
+const APIKeyHeader = "X-API-Key"
+
+// Principal is an authenticated client.
+type Principal struct {
+	Name   string   `json:"name"`
+	Method string   `json:"method"`
+	Roles  []string `json:"roles,omitempty"`
+}
+
+func (p *Principal) HasRole(role string) bool {
+	for _, r := range p.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Authenticator identifies the client behind a request. It returns
+// ErrNoCredentials when the request carries nothing it recognises, so that
+// authenticators can be chained.
+type Authenticator interface {
+	Authenticate(r *http.Request) (*Principal, error)
+}
+
+// Chain tries each authenticator in turn and returns the first principal
+// found. A rejected credential stops the chain.
+type Chain []Authenticator
+
+func (c Chain) Authenticate(r *http.Request) (*Principal, error) {
+	for _, a := range c {
+		p, err := a.Authenticate(r)
+		if errors.Is(err, ErrNoCredentials) {
+			continue
+		}
+		return p, err
+	}
+	return nil, ErrNoCredentials
+}
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal stored by Middleware, if any.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+	return p, ok
+}
+
+func bearerToken(r *http.Request) string {
+	h := r.Header.Get("Authorization")
+	if len(h) > 7 && strings.EqualFold(h[:7], "Bearer ") {
+		return strings.TrimSpace(h[7:])
+	}
+	return ""
+}
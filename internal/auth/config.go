@@ -0,0 +1,60 @@
+package auth
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Config enables authentication. With neither API keys nor a JWKS file
+// configured, every request is let through.
+type Config struct {
+	APIKeys []APIKey   `json:"api_keys,omitempty"`
+	JWT     *JWTConfig `json:"jwt,omitempty"`
+	// ClientCerts grants roles to TLS client certificates by common name.
+	// Other certificates authenticate without roles.
+	ClientCerts []ClientCertRoles `json:"client_certs,omitempty"`
+	// AllowedOrigins lists the origins allowed to open WebSocket
+	// connections. When empty, only same-origin requests are accepted.
+	AllowedOrigins []string `json:"allowed_origins,omitempty"`
+	// ACLFile holds the access control rules for authenticated principals.
+	// Without it, every authenticated principal may run every command.
+	ACLFile string `json:"acl_file,omitempty"`
+}
+
+func LoadConfig(filename string) (Config, error) {
+	var cfg Config
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return cfg, err
+	}
+	if err := json.Unmarshal(raw, &cfg); err != nil {
+		return cfg, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	return cfg, nil
+}
+
+// Enabled reports whether the configuration asks for authentication.
+func (c Config) Enabled() bool {
+	return len(c.APIKeys) > 0 || c.JWT != nil
+}
+
+// Authenticator builds the authenticator chain for c. It returns nil when
+// authentication is disabled.
+func (c Config) Authenticator() (Authenticator, error) {
+	if !c.Enabled() {
+		return nil, nil
+	}
+	var chain Chain
+	if len(c.APIKeys) > 0 {
+		chain = append(chain, NewAPIKeys(c.APIKeys))
+	}
+	if c.JWT != nil {
+		j, err := NewJWT(*c.JWT)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, j)
+	}
+	return chain, nil
+}
@@ -0,0 +1,168 @@
+package auth
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTConfig selects how bearer tokens are verified. Keys come from a local
+// JWKS file; HS256 keys are "oct" entries and RS256 keys "RSA" entries.
+type JWTConfig struct {
+	JWKSFile string `json:"jwks_file"`
+	Issuer   string `json:"issuer,omitempty"`
+	Audience string `json:"audience,omitempty"`
+	// RolesClaim names the claim holding the principal's roles, either a
+	// list of strings or a space-separated string. It defaults to "roles".
+	RolesClaim string `json:"roles_claim,omitempty"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type verificationKey struct {
+	alg string
+	key interface{}
+}
+
+// JWT authenticates requests carrying a bearer token signed with HS256 or
+// RS256. The principal is named after the "sub" claim.
+type JWT struct {
+	keys       map[string]verificationKey
+	rolesClaim string
+	parser     *jwt.Parser
+}
+
+func NewJWT(cfg JWTConfig) (*JWT, error) {
+	keys, err := loadJWKS(cfg.JWKSFile)
+	if err != nil {
+		return nil, err
+	}
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods([]string{"HS256", "RS256"}),
+		jwt.WithExpirationRequired(),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+	rolesClaim := cfg.RolesClaim
+	if rolesClaim == "" {
+		rolesClaim = "roles"
+	}
+	return &JWT{keys: keys, rolesClaim: rolesClaim, parser: jwt.NewParser(opts...)}, nil
+}
+
+func loadJWKS(filename string) (map[string]verificationKey, error) {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	keys := make(map[string]verificationKey, len(set.Keys))
+	for _, k := range set.Keys {
+		vk, err := k.verificationKey()
+		if err != nil {
+			return nil, fmt.Errorf("key %q in %s: %w", k.Kid, filename, err)
+		}
+		keys[k.Kid] = vk
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%s has no keys", filename)
+	}
+	return keys, nil
+}
+
+func (k jwk) verificationKey() (verificationKey, error) {
+	switch k.Kty {
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil || len(secret) == 0 {
+			return verificationKey{}, errors.New("invalid symmetric key")
+		}
+		return verificationKey{alg: "HS256", key: secret}, nil
+	case "RSA":
+		n, errN := base64.RawURLEncoding.DecodeString(k.N)
+		e, errE := base64.RawURLEncoding.DecodeString(k.E)
+		if errN != nil || errE != nil || len(n) == 0 || len(e) == 0 {
+			return verificationKey{}, errors.New("invalid RSA key")
+		}
+		pub := &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}
+		return verificationKey{alg: "RS256", key: pub}, nil
+	}
+	return verificationKey{}, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// keyFor picks the key named by the token's kid header, or the only key
+// when there is one and the token names none. The key type must agree with
+// the token's algorithm, so an RSA public key is never used as an HMAC
+// secret.
+func (a *JWT) keyFor(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	vk, ok := a.keys[kid]
+	if !ok && kid == "" && len(a.keys) == 1 {
+		for _, only := range a.keys {
+			vk, ok = only, true
+		}
+	}
+	if !ok {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+	if token.Method.Alg() != vk.alg {
+		return nil, fmt.Errorf("key %q is not a %s key", kid, token.Method.Alg())
+	}
+	return vk.key, nil
+}
+
+func (a *JWT) Authenticate(r *http.Request) (*Principal, error) {
+	raw := bearerToken(r)
+	if raw == "" {
+		return nil, ErrNoCredentials
+	}
+	claims := jwt.MapClaims{}
+	if _, err := a.parser.ParseWithClaims(raw, claims, a.keyFor); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	sub, err := claims.GetSubject()
+	if err != nil || sub == "" {
+		return nil, fmt.Errorf("%w: token has no subject", ErrInvalidCredentials)
+	}
+	return &Principal{Name: sub, Method: MethodJWT, Roles: stringList(claims[a.rolesClaim])}, nil
+}
+
+func stringList(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []interface{}:
+		var out []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				out = append(out, s)
+			}
+		}
+		return out
+	}
+	return nil
+}
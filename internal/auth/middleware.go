@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// CodeUnauthenticated is the error code sent with 401 responses.
+const CodeUnauthenticated = "UNAUTHENTICATED"
+
+// Middleware rejects requests that a does not authenticate with 401 and
+// stores the principal of the rest in the request context. A nil a lets
+// every request through.
+func Middleware(a Authenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if a == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p, err := a.Authenticate(r)
+			if err != nil {
+				Unauthorized(w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), p)))
+		})
+	}
+}
+
+func Unauthorized(w http.ResponseWriter, err error) {
+	message := "authentication required"
+	if !errors.Is(err, ErrNoCredentials) {
+		message = ErrInvalidCredentials.Error()
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="gokv"`)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "code": CodeUnauthenticated})
+}
+
+// CheckOrigin returns a WebSocket origin check that accepts requests without
+// an Origin header, same-origin requests, and the listed origins. "*"
+// allows any origin.
+func CheckOrigin(allowed []string) func(r *http.Request) bool {
+	return func(r *http.Request) bool {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			return true
+		}
+		for _, a := range allowed {
+			if a == "*" || strings.EqualFold(a, origin) {
+				return true
+			}
+		}
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(u.Host, r.Host)
+	}
+}
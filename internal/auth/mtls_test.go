@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"slices"
+	"testing"
+)
+
+func requestWithCert(subject pkix.Name) *http.Request {
+	cert := &x509.Certificate{Subject: subject}
+	return &http.Request{TLS: &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}}
+}
+
+func TestClientCertRoles(t *testing.T) {
+	c := NewClientCert([]ClientCertRoles{{CommonName: "deployer", Roles: []string{"ops"}}})
+
+	tests := []struct {
+		name    string
+		subject pkix.Name
+		roles   []string
+	}{
+		{"configured", pkix.Name{CommonName: "deployer"}, []string{"ops"}},
+		{"configured, subject OU ignored", pkix.Name{CommonName: "deployer", OrganizationalUnit: []string{"admin"}}, []string{"ops"}},
+		{"unconfigured OU", pkix.Name{CommonName: "mallory", OrganizationalUnit: []string{"admin"}}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := c.Authenticate(requestWithCert(tt.subject))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if p.Name != tt.subject.CommonName || !slices.Equal(p.Roles, tt.roles) {
+				t.Errorf("principal = %+v, want %s with roles %v", p, tt.subject.CommonName, tt.roles)
+			}
+		})
+	}
+
+	if _, err := c.Authenticate(&http.Request{}); err != ErrNoCredentials {
+		t.Errorf("without TLS: %v, want ErrNoCredentials", err)
+	}
+	if _, err := c.Authenticate(requestWithCert(pkix.Name{})); err != ErrInvalidCredentials {
+		t.Errorf("without common name: %v, want ErrInvalidCredentials", err)
+	}
+}
@@ -0,0 +1,218 @@
+// Package codec encodes requests and responses as JSON, MessagePack or CBOR
+// and negotiates between them.
+//
+// Whatever the encoding, decoded values are normalized to the data model the
+// store works with: nil, bool, float64, string, []byte, []interface{} and
+// map[string]interface{}. []byte only arrives through the binary encodings,
+// which carry it natively; JSON encodes it as a base64 string.
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec is one encoding. Decoding into an *interface{} normalizes the
+// result; other targets are decoded using their json struct tags.
+type Codec interface {
+	// Name identifies the codec in configuration and in the WebSocket
+	// subprotocol gokv.<name>: json, msgpack or cbor.
+	Name() string
+	ContentType() string
+	// Binary reports whether encoded messages are binary rather than text.
+	Binary() bool
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+	Decode(r io.Reader, v interface{}) error
+}
+
+var (
+	JSON        Codec = jsonCodec{}
+	MessagePack Codec = msgpackCodec{}
+	CBOR        Codec = cborCodec{}
+)
+
+// All lists the codecs in order of preference.
+var All = []Codec{JSON, MessagePack, CBOR}
+
+// ByName returns the codec called name.
+func ByName(name string) (Codec, error) {
+	for _, c := range All {
+		if c.Name() == name {
+			return c, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown encoding %q", name)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string        { return "json" }
+func (jsonCodec) ContentType() string { return "application/json" }
+func (jsonCodec) Binary() bool        { return false }
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Decode reads a single value; JSON already decodes to the data model.
+func (jsonCodec) Decode(r io.Reader, v interface{}) error {
+	return json.NewDecoder(r).Decode(v)
+}
+
+type msgpackCodec struct{}
+
+func (msgpackCodec) Name() string        { return "msgpack" }
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+func (msgpackCodec) Binary() bool        { return true }
+
+func (msgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	enc.UseCompactFloats(true)
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func (c msgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	return c.Decode(bytes.NewReader(data), v)
+}
+
+func (msgpackCodec) Decode(r io.Reader, v interface{}) error {
+	dec := msgpack.NewDecoder(r)
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	return normalizeTarget(v)
+}
+
+var (
+	cborEnc, _ = cbor.EncOptions{
+		Time:          cbor.TimeRFC3339Nano,
+		ShortestFloat: cbor.ShortestFloat16,
+	}.EncMode()
+	cborDec, _ = cbor.DecOptions{}.DecMode()
+)
+
+type cborCodec struct{}
+
+func (cborCodec) Name() string        { return "cbor" }
+func (cborCodec) ContentType() string { return "application/cbor" }
+func (cborCodec) Binary() bool        { return true }
+
+func (cborCodec) Marshal(v interface{}) ([]byte, error) {
+	return cborEnc.Marshal(v)
+}
+
+func (cborCodec) Unmarshal(data []byte, v interface{}) error {
+	if err := cborDec.Unmarshal(data, v); err != nil {
+		return err
+	}
+	return normalizeTarget(v)
+}
+
+func (cborCodec) Decode(r io.Reader, v interface{}) error {
+	if err := cborDec.NewDecoder(r).Decode(v); err != nil {
+		return err
+	}
+	return normalizeTarget(v)
+}
+
+func normalizeTarget(v interface{}) error {
+	p, ok := v.(*interface{})
+	if !ok {
+		return nil
+	}
+	n, err := Normalize(*p)
+	if err != nil {
+		return err
+	}
+	*p = n
+	return nil
+}
+
+// Normalize converts a value decoded by any codec to the store's data model.
+// Integers become float64, as they do in JSON, and timestamps become RFC 3339
+// strings. Maps must have string keys.
+func Normalize(v interface{}) (interface{}, error) {
+	switch t := v.(type) {
+	case nil, bool, float64, string, []byte:
+		return t, nil
+	case float32:
+		return float64(t), nil
+	case int:
+		return float64(t), nil
+	case int8:
+		return float64(t), nil
+	case int16:
+		return float64(t), nil
+	case int32:
+		return float64(t), nil
+	case int64:
+		return float64(t), nil
+	case uint:
+		return float64(t), nil
+	case uint8:
+		return float64(t), nil
+	case uint16:
+		return float64(t), nil
+	case uint32:
+		return float64(t), nil
+	case uint64:
+		return float64(t), nil
+	case big.Int:
+		f, _ := new(big.Float).SetInt(&t).Float64()
+		return f, nil
+	case time.Time:
+		return t.Format(time.RFC3339Nano), nil
+	case []interface{}:
+		for i, item := range t {
+			n, err := Normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			t[i] = n
+		}
+		return t, nil
+	case map[string]interface{}:
+		for k, item := range t {
+			n, err := Normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			t[k] = n
+		}
+		return t, nil
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(t))
+		for k, item := range t {
+			key, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("map keys must be strings, not %T", k)
+			}
+			n, err := Normalize(item)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = n
+		}
+		return m, nil
+	}
+	return nil, fmt.Errorf("unsupported value of type %T", v)
+}
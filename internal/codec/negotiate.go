@@ -0,0 +1,94 @@
+package codec
+
+import (
+	"mime"
+	"strconv"
+	"strings"
+)
+
+// contentTypes maps every media type accepted for a codec to it. Responses
+// use the codec's ContentType.
+var contentTypes = map[string]Codec{
+	"application/json":        JSON,
+	"application/msgpack":     MessagePack,
+	"application/x-msgpack":   MessagePack,
+	"application/vnd.msgpack": MessagePack,
+	"application/cbor":        CBOR,
+}
+
+// ForContentType returns the codec for a Content-Type header. An empty
+// header means JSON, as do structured syntax suffixes such as
+// application/merge-patch+json.
+func ForContentType(header string) (Codec, bool) {
+	if strings.TrimSpace(header) == "" {
+		return JSON, true
+	}
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return nil, false
+	}
+	if c, ok := contentTypes[mediaType]; ok {
+		return c, true
+	}
+	switch {
+	case strings.HasSuffix(mediaType, "+json"):
+		return JSON, true
+	case strings.HasSuffix(mediaType, "+cbor"):
+		return CBOR, true
+	}
+	return nil, false
+}
+
+// Negotiate picks the codec for a response from an Accept header, honouring
+// q-values and preferring an exact media type over a wildcard. An empty
+// header accepts JSON. It reports false if no codec is acceptable.
+func Negotiate(accept string) (Codec, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return JSON, true
+	}
+
+	var best Codec
+	bestQ, bestSpecificity := 0.0, -1
+	for _, c := range All {
+		q, specificity := acceptance(accept, c)
+		if q > bestQ || (q == bestQ && q > 0 && specificity > bestSpecificity) {
+			best, bestQ, bestSpecificity = c, q, specificity
+		}
+	}
+	return best, best != nil
+}
+
+// acceptance returns the q-value the most specific matching range in accept
+// gives c, and how specific that range is: 0 for */*, 1 for application/*
+// and 2 for a media type.
+func acceptance(accept string, c Codec) (float64, int) {
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		s := -1
+		switch {
+		case mediaType == "*/*":
+			s = 0
+		case mediaType == "application/*":
+			s = 1
+		case contentTypes[mediaType] == c, mediaType == "application/problem+json" && c == JSON:
+			s = 2
+		}
+		if s < 0 || s < specificity {
+			continue
+		}
+		rangeQ := 1.0
+		if raw, ok := params["q"]; ok {
+			if f, err := strconv.ParseFloat(raw, 64); err == nil {
+				rangeQ = f
+			}
+		}
+		if s > specificity || rangeQ > q {
+			q, specificity = rangeQ, s
+		}
+	}
+	return q, specificity
+}
@@ -0,0 +1,352 @@
+// Package config loads the server configuration from a YAML or TOML file,
+// GOKV_* environment variables and command-line flags, in increasing order
+// of precedence. A variable that is set but empty empties its setting, so
+// GOKV_WEBSOCKET_ADDR= turns off the separate WebSocket listener.
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v3"
+
+	"github.com/umgbhalla/gokv/internal/logging"
+	"github.com/umgbhalla/gokv/internal/query"
+	"github.com/umgbhalla/gokv/internal/store"
+	"github.com/umgbhalla/gokv/internal/tlsconfig"
+)
+
+// EnvPrefix prefixes the environment variable for each setting, with dots
+// replaced by underscores: GOKV_HTTP_ADDR sets http.addr.
+const EnvPrefix = "GOKV"
+
+type Config struct {
+	// ShutdownTimeout bounds draining HTTP requests and closing WebSocket
+	// connections before the final snapshot.
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout" yaml:"shutdown_timeout"`
+
+	HTTP        HTTPConfig        `mapstructure:"http" yaml:"http"`
+	WebSocket   WebSocketConfig   `mapstructure:"websocket" yaml:"websocket"`
+	RESP        RESPConfig        `mapstructure:"resp" yaml:"resp"`
+	Memcached   MemcachedConfig   `mapstructure:"memcached" yaml:"memcached"`
+	GRPC        GRPCConfig        `mapstructure:"grpc" yaml:"grpc"`
+	Store       StoreConfig       `mapstructure:"store" yaml:"store"`
+	Limits      LimitsConfig      `mapstructure:"limits" yaml:"limits"`
+	Persistence PersistenceConfig `mapstructure:"persistence" yaml:"persistence"`
+	Log         LogConfig         `mapstructure:"log" yaml:"log"`
+	TLS         TLSConfig         `mapstructure:"tls" yaml:"tls"`
+	Auth        AuthConfig        `mapstructure:"auth" yaml:"auth"`
+	Slowlog     SlowlogConfig     `mapstructure:"slowlog" yaml:"slowlog"`
+	Monitor     MonitorConfig     `mapstructure:"monitor" yaml:"monitor"`
+}
+
+type HTTPConfig struct {
+	Addr string `mapstructure:"addr" yaml:"addr"`
+}
+
+// WebSocketConfig.Addr is an additional listener for the WebSocket API,
+// which is always served on /ws of the HTTP API. Empty means none. The
+// other settings are the per-connection options of the WebSocket server,
+// described on its Options type.
+type WebSocketConfig struct {
+	Addr           string        `mapstructure:"addr" yaml:"addr"`
+	PingInterval   time.Duration `mapstructure:"ping_interval" yaml:"ping_interval"`
+	PongTimeout    time.Duration `mapstructure:"pong_timeout" yaml:"pong_timeout"`
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout" yaml:"idle_timeout"`
+	WriteTimeout   time.Duration `mapstructure:"write_timeout" yaml:"write_timeout"`
+	MaxMessageSize int           `mapstructure:"max_message_size" yaml:"max_message_size"`
+	SendQueue      int           `mapstructure:"send_queue" yaml:"send_queue"`
+	SlowConsumer   string        `mapstructure:"slow_consumer" yaml:"slow_consumer"`
+}
+
+// RESPConfig.Addr is the listener for the Redis protocol. Empty means none.
+type RESPConfig struct {
+	Addr string `mapstructure:"addr" yaml:"addr"`
+}
+
+// MemcachedConfig.Addr is the listener for the memcached text protocol.
+// Empty means none.
+type MemcachedConfig struct {
+	Addr string `mapstructure:"addr" yaml:"addr"`
+}
+
+// GRPCConfig.Addr is the listener for the gRPC API. Empty means none.
+type GRPCConfig struct {
+	Addr string `mapstructure:"addr" yaml:"addr"`
+}
+
+// StoreConfig.ChunkThreshold is the size in bytes over which binary values
+// are stored in pieces of ChunkSize bytes; zero disables chunking.
+type StoreConfig struct {
+	MaxDatabases   int           `mapstructure:"max_databases" yaml:"max_databases"`
+	SweepInterval  time.Duration `mapstructure:"sweep_interval" yaml:"sweep_interval"`
+	ChunkThreshold int           `mapstructure:"chunk_threshold" yaml:"chunk_threshold"`
+	ChunkSize      int           `mapstructure:"chunk_size" yaml:"chunk_size"`
+}
+
+// LimitsConfig bounds keys, values and HTTP request bodies, in bytes. Zero
+// means no limit.
+type LimitsConfig struct {
+	MaxKeySize     int `mapstructure:"max_key_size" yaml:"max_key_size"`
+	MaxValueSize   int `mapstructure:"max_value_size" yaml:"max_value_size"`
+	MaxRequestSize int `mapstructure:"max_request_size" yaml:"max_request_size"`
+}
+
+type PersistenceConfig struct {
+	File     string        `mapstructure:"file" yaml:"file"`
+	Interval time.Duration `mapstructure:"interval" yaml:"interval"`
+}
+
+type LogConfig struct {
+	Level  string `mapstructure:"level" yaml:"level"`
+	Format string `mapstructure:"format" yaml:"format"`
+	File   string `mapstructure:"file" yaml:"file"`
+}
+
+type TLSConfig struct {
+	Cert       string `mapstructure:"cert" yaml:"cert"`
+	Key        string `mapstructure:"key" yaml:"key"`
+	ClientCA   string `mapstructure:"client_ca" yaml:"client_ca"`
+	ClientAuth string `mapstructure:"client_auth" yaml:"client_auth"`
+}
+
+type AuthConfig struct {
+	// Config is the JSON file with API keys, JWT settings, allowed
+	// WebSocket origins and the ACL file.
+	Config string `mapstructure:"config" yaml:"config"`
+}
+
+type SlowlogConfig struct {
+	Threshold time.Duration `mapstructure:"threshold" yaml:"threshold"`
+	MaxLen    int           `mapstructure:"max_len" yaml:"max_len"`
+}
+
+type MonitorConfig struct {
+	Redact []string `mapstructure:"redact" yaml:"redact"`
+}
+
+// Logging returns the settings for logging.Setup.
+func (c *Config) Logging() logging.Config {
+	return logging.Config{Level: c.Log.Level, Format: c.Log.Format, Output: c.Log.File}
+}
+
+// TLSFiles returns the settings for tlsconfig.
+func (c *Config) TLSFiles() tlsconfig.Config {
+	return tlsconfig.Config{CertFile: c.TLS.Cert, KeyFile: c.TLS.Key, ClientCAFile: c.TLS.ClientCA, ClientAuth: c.TLS.ClientAuth}
+}
+
+// QueryLimits returns the key and value limits.
+func (c *Config) QueryLimits() query.Limits {
+	return query.Limits{MaxKeySize: c.Limits.MaxKeySize, MaxValueSize: int64(c.Limits.MaxValueSize)}
+}
+
+// setting is one configuration key with its default and, if it can be set
+// on the command line, its flag.
+type setting struct {
+	key   string
+	value interface{}
+	flag  string
+	usage string
+}
+
+// settings lists every key. Flags that existed before the configuration
+// file keep their names.
+var settings = []setting{
+	{"shutdown_timeout", 10 * time.Second, "shutdown-timeout", "time allowed for draining connections on shutdown"},
+	{"http.addr", ":8080", "http-addr", "address of the HTTP API"},
+	{"websocket.addr", ":8081", "ws-addr", "separate address for the WebSocket API, which is also served on /ws of the HTTP API; empty for none"},
+	{"websocket.ping_interval", 30 * time.Second, "ws-ping-interval", "how often WebSocket clients are pinged"},
+	{"websocket.pong_timeout", 60 * time.Second, "ws-pong-timeout", "disconnect WebSocket clients silent for this long"},
+	{"websocket.idle_timeout", time.Duration(0), "ws-idle-timeout", "disconnect WebSocket clients sending no requests for this long; 0 disables it"},
+	{"websocket.write_timeout", 10 * time.Second, "ws-write-timeout", "time allowed for each WebSocket write"},
+	{"websocket.max_message_size", 1 << 20, "ws-max-message-size", "largest WebSocket message accepted, in bytes"},
+	{"websocket.send_queue", 256, "ws-send-queue", "outbound WebSocket messages buffered per connection"},
+	{"websocket.slow_consumer", "drop", "ws-slow-consumer", "when a WebSocket client's queue is full: drop pushed messages or disconnect"},
+	{"resp.addr", "", "resp-addr", "address of the Redis protocol (RESP) listener, such as :6379; empty for none"},
+	{"memcached.addr", "", "memcached-addr", "address of the memcached text protocol listener, such as :11211; empty for none"},
+	{"grpc.addr", "", "grpc-addr", "address of the gRPC API, such as :9090; empty for none"},
+	{"store.max_databases", store.DefaultMaxDatabases, "max-databases", "number of logical databases clients may create"},
+	{"store.sweep_interval", store.DefaultSweepInterval, "sweep-interval", "how often expired keys are removed"},
+	{"store.chunk_threshold", 0, "chunk-threshold", "store binary values larger than this many bytes in chunks; 0 disables chunking"},
+	{"store.chunk_size", store.DefaultChunkSize, "chunk-size", "size in bytes of the chunks of large binary values"},
+	{"limits.max_key_size", 1024, "max-key-size", "longest key accepted, in bytes; 0 for no limit"},
+	{"limits.max_value_size", 16 << 20, "max-value-size", "largest value accepted, in bytes; 0 for no limit"},
+	{"limits.max_request_size", 32 << 20, "max-request-size", "largest HTTP request body accepted, in bytes; 0 for no limit"},
+	{"persistence.file", "data.json", "data-file", "snapshot file"},
+	{"persistence.interval", 30 * time.Second, "save-interval", "how often a snapshot is written"},
+	{"log.level", "info", "log-level", "minimum level logged: debug, info, warn or error"},
+	{"log.format", "text", "log-format", "log format: text or json"},
+	{"log.file", "gokv.log", "log-file", "log destination: a file path, stderr or stdout"},
+	{"tls.cert", "", "tls-cert", "PEM certificate file; enables TLS on every listener"},
+	{"tls.key", "", "tls-key", "PEM private key file for -tls-cert"},
+	{"tls.client_ca", "", "tls-client-ca", "PEM CA file; enables mutual TLS"},
+	{"tls.client_auth", "", "tls-client-auth", "client certificate policy with -tls-client-ca: require or optional"},
+	{"auth.config", "", "auth-config", "JSON file with API keys, JWT settings and allowed WebSocket origins"},
+	{"slowlog.threshold", query.DefaultSlowlogThreshold, "slowlog-threshold", "log commands slower than this to the slowlog; negative disables it"},
+	{"slowlog.max_len", query.DefaultSlowlogMaxLen, "slowlog-max-len", "number of slowlog entries kept"},
+	{"monitor.redact", []string{}, "monitor-redact", "comma-separated key prefixes whose arguments are hidden from the slowlog and MONITOR"},
+}
+
+// Loader reads the configuration. Calling Load again, as on SIGHUP, rereads
+// the file and environment while flags given at startup keep precedence.
+type Loader struct {
+	fs   *flag.FlagSet
+	file *string
+}
+
+// NewLoader defines -config and a flag for every setting on fs, which the
+// caller parses before calling Load.
+func NewLoader(fs *flag.FlagSet) *Loader {
+	l := &Loader{fs: fs}
+	l.file = fs.String("config", os.Getenv(EnvPrefix+"_CONFIG"), "YAML or TOML configuration file")
+	for _, s := range settings {
+		switch v := s.value.(type) {
+		case string:
+			fs.String(s.flag, v, s.usage)
+		case int:
+			fs.Int(s.flag, v, s.usage)
+		case time.Duration:
+			fs.Duration(s.flag, v, s.usage)
+		case []string:
+			fs.String(s.flag, strings.Join(v, ","), s.usage)
+		}
+	}
+	return l
+}
+
+// File returns the configuration file in use, if any.
+func (l *Loader) File() string {
+	return *l.file
+}
+
+// Load returns the validated configuration.
+func (l *Loader) Load() (*Config, error) {
+	v := viper.New()
+	for _, s := range settings {
+		v.SetDefault(s.key, s.value)
+	}
+	if *l.file != "" {
+		v.SetConfigFile(*l.file)
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("reading %s: %w", *l.file, err)
+		}
+	}
+	v.SetEnvPrefix(EnvPrefix)
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AllowEmptyEnv(true)
+	v.AutomaticEnv()
+
+	flags := make(map[string]string, len(settings))
+	for _, s := range settings {
+		flags[s.flag] = s.key
+	}
+	l.fs.Visit(func(f *flag.Flag) {
+		if key, ok := flags[f.Name]; ok {
+			v.Set(key, f.Value.(flag.Getter).Get())
+		}
+	})
+
+	var c Config
+	err := v.Unmarshal(&c, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	)))
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Validate reports every invalid setting at once.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	check(c.HTTP.Addr != "", "http.addr is required")
+	check(c.HTTP.Addr != c.WebSocket.Addr, "http.addr and websocket.addr must differ")
+	check(c.RESP.Addr == "" || (c.RESP.Addr != c.HTTP.Addr && c.RESP.Addr != c.WebSocket.Addr),
+		"resp.addr must differ from http.addr and websocket.addr")
+	check(c.Memcached.Addr == "" || (c.Memcached.Addr != c.HTTP.Addr && c.Memcached.Addr != c.WebSocket.Addr && c.Memcached.Addr != c.RESP.Addr),
+		"memcached.addr must differ from http.addr, websocket.addr and resp.addr")
+	check(c.GRPC.Addr == "" || (c.GRPC.Addr != c.HTTP.Addr && c.GRPC.Addr != c.WebSocket.Addr && c.GRPC.Addr != c.RESP.Addr && c.GRPC.Addr != c.Memcached.Addr),
+		"grpc.addr must differ from http.addr, websocket.addr, resp.addr and memcached.addr")
+	check(c.ShutdownTimeout > 0, "shutdown_timeout must be positive")
+	ws := c.WebSocket
+	check(ws.PingInterval > 0 && ws.PingInterval < ws.PongTimeout,
+		"websocket.ping_interval must be positive and shorter than websocket.pong_timeout")
+	check(ws.IdleTimeout >= 0, "websocket.idle_timeout must not be negative")
+	check(ws.WriteTimeout > 0, "websocket.write_timeout must be positive")
+	check(ws.MaxMessageSize > 0, "websocket.max_message_size must be positive")
+	check(ws.SendQueue > 0, "websocket.send_queue must be positive")
+	check(ws.SlowConsumer == "drop" || ws.SlowConsumer == "disconnect", "websocket.slow_consumer must be drop or disconnect")
+	check(c.Store.MaxDatabases > 0, "store.max_databases must be positive")
+	check(c.Store.SweepInterval > 0, "store.sweep_interval must be positive")
+	check(c.Store.ChunkThreshold >= 0, "store.chunk_threshold must not be negative")
+	check(c.Store.ChunkSize > 0, "store.chunk_size must be positive")
+	check(c.Limits.MaxKeySize >= 0, "limits.max_key_size must not be negative")
+	check(c.Limits.MaxValueSize >= 0, "limits.max_value_size must not be negative")
+	check(c.Limits.MaxRequestSize >= 0, "limits.max_request_size must not be negative")
+	check(c.Limits.MaxRequestSize == 0 || (c.Limits.MaxValueSize > 0 && c.Limits.MaxValueSize <= c.Limits.MaxRequestSize),
+		"limits.max_value_size must be set and no larger than limits.max_request_size")
+	check(c.Persistence.File != "", "persistence.file is required")
+	check(c.Persistence.Interval > 0, "persistence.interval must be positive")
+	_, err := logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level must be debug, info, warn or error")
+	check(c.Log.Format == "text" || c.Log.Format == "json", "log.format must be text or json")
+	check((c.TLS.Cert == "") == (c.TLS.Key == ""), "tls.cert and tls.key must be given together")
+	check(c.TLS.ClientCA == "" || c.TLS.Cert != "", "tls.client_ca requires tls.cert")
+	switch c.TLS.ClientAuth {
+	case "", "optional", "require":
+	default:
+		check(false, "tls.client_auth must be optional or require")
+	}
+	check(c.Slowlog.MaxLen >= 0, "slowlog.max_len must not be negative")
+	return errors.Join(errs...)
+}
+
+// Print writes c as YAML.
+func (c *Config) Print(w io.Writer) error {
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(c); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+// Reloaded returns c with the settings that are applied on reload taken
+// from next: the log level, the slowlog and MONITOR redaction.
+func (c *Config) Reloaded(next *Config) *Config {
+	r := *c
+	r.Log.Level = next.Log.Level
+	r.Slowlog = next.Slowlog
+	r.Monitor = next.Monitor
+	return &r
+}
+
+// RestartRequired lists the sections in which next differs from c in
+// settings that only take effect at startup.
+func (c *Config) RestartRequired(next *Config) []string {
+	var changed []string
+	a, b := reflect.ValueOf(*c.Reloaded(next)), reflect.ValueOf(*next)
+	for i := 0; i < a.NumField(); i++ {
+		if !reflect.DeepEqual(a.Field(i).Interface(), b.Field(i).Interface()) {
+			changed = append(changed, a.Type().Field(i).Tag.Get("mapstructure"))
+		}
+	}
+	return changed
+}
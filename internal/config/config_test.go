@@ -0,0 +1,134 @@
+package config
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// load parses args as the command line and loads the configuration.
+func load(t *testing.T, args ...string) (*Config, *Loader) {
+	t.Helper()
+	fs := flag.NewFlagSet("gokv-server", flag.ContinueOnError)
+	l := NewLoader(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	c, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c, l
+}
+
+func writeFile(t *testing.T, name, content string) {
+	t.Helper()
+	if err := os.WriteFile(name, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "gokv.yaml")
+	writeFile(t, file, `
+http:
+  addr: ":1000"
+resp:
+  addr: ":2000"
+log:
+  level: warn
+websocket:
+  ping_interval: 5s
+`)
+	t.Setenv("GOKV_RESP_ADDR", ":3000")
+	t.Setenv("GOKV_LOG_LEVEL", "error")
+	c, l := load(t, "-config", file, "-log-level", "debug")
+
+	tests := []struct {
+		setting   string
+		got, want interface{}
+	}{
+		{"persistence.file (default)", c.Persistence.File, "data.json"},
+		{"http.addr (file)", c.HTTP.Addr, ":1000"},
+		{"websocket.ping_interval (file)", c.WebSocket.PingInterval, 5 * time.Second},
+		{"resp.addr (environment over file)", c.RESP.Addr, ":3000"},
+		{"log.level (flag over environment)", c.Log.Level, "debug"},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%s = %v, want %v", tt.setting, tt.got, tt.want)
+		}
+	}
+
+	// Loading again rereads the file, and flags keep precedence.
+	writeFile(t, file, `
+http:
+  addr: ":1001"
+log:
+  level: warn
+`)
+	c, err := l.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.HTTP.Addr != ":1001" || c.Log.Level != "debug" {
+		t.Errorf("reloaded http.addr = %s, log.level = %s", c.HTTP.Addr, c.Log.Level)
+	}
+}
+
+func TestEmptyEnvironmentVariable(t *testing.T) {
+	c, _ := load(t)
+	if c.WebSocket.Addr == "" {
+		t.Fatal("websocket.addr has no default")
+	}
+	t.Setenv("GOKV_WEBSOCKET_ADDR", "")
+	if c, _ := load(t); c.WebSocket.Addr != "" {
+		t.Errorf("websocket.addr = %q, want it turned off", c.WebSocket.Addr)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	defaults, _ := load(t)
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		// err is part of the message, or empty if c is valid.
+		err string
+	}{
+		{"defaults", func(c *Config) {}, ""},
+		{"no http.addr", func(c *Config) { c.HTTP.Addr = "" }, "http.addr is required"},
+		{"shared address", func(c *Config) { c.GRPC.Addr = c.HTTP.Addr }, "grpc.addr must differ"},
+		{"no websocket listener", func(c *Config) { c.WebSocket.Addr = "" }, ""},
+		{"ping after pong timeout", func(c *Config) { c.WebSocket.PingInterval = time.Hour }, "websocket.ping_interval"},
+		{"negative idle timeout", func(c *Config) { c.WebSocket.IdleTimeout = -time.Second }, "websocket.idle_timeout"},
+		{"no send queue", func(c *Config) { c.WebSocket.SendQueue = 0 }, "websocket.send_queue"},
+		{"slow consumer policy", func(c *Config) { c.WebSocket.SlowConsumer = "block" }, "websocket.slow_consumer"},
+		{"value over request size", func(c *Config) { c.Limits.MaxValueSize = c.Limits.MaxRequestSize + 1 }, "limits.max_value_size"},
+		{"log level", func(c *Config) { c.Log.Level = "loud" }, "log.level"},
+		{"tls key alone", func(c *Config) { c.TLS.Key = "key.pem" }, "tls.cert and tls.key"},
+		{"client auth", func(c *Config) { c.TLS.ClientAuth = "always" }, "tls.client_auth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := *defaults
+			tt.change(&c)
+			err := c.Validate()
+			switch {
+			case tt.err == "" && err != nil:
+				t.Errorf("unexpected error: %v", err)
+			case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+				t.Errorf("error = %v, want %q", err, tt.err)
+			}
+		})
+	}
+
+	// Every problem is reported at once.
+	c := *defaults
+	c.HTTP.Addr, c.Log.Format = "", "xml"
+	if err := c.Validate(); err == nil || !strings.Contains(err.Error(), "http.addr") || !strings.Contains(err.Error(), "log.format") {
+		t.Errorf("error = %v, want both problems", err)
+	}
+}
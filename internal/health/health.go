@@ -0,0 +1,48 @@
+// Package health tracks whether the server's components have started, for
+// liveness and readiness probes.
+package health
+
+import (
+	"sort"
+	"sync"
+)
+
+// Readiness is ready once every component it was created with has been
+// marked ready.
+type Readiness struct {
+	mu      sync.RWMutex
+	pending map[string]bool
+}
+
+func NewReadiness(components ...string) *Readiness {
+	r := &Readiness{pending: make(map[string]bool, len(components))}
+	for _, c := range components {
+		r.pending[c] = true
+	}
+	return r
+}
+
+func (r *Readiness) MarkReady(component string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.pending, component)
+}
+
+// Pending lists, in order, the components that are not ready yet.
+func (r *Readiness) Pending() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	pending := make([]string, 0, len(r.pending))
+	for c := range r.pending {
+		pending = append(pending, c)
+	}
+	sort.Strings(pending)
+	return pending
+}
+
+func (r *Readiness) Ready() bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.pending) == 0
+}
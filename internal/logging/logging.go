@@ -0,0 +1,120 @@
+// Package logging configures the process-wide log/slog logger and carries
+// request IDs through contexts.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+// Config selects how the server logs. Output is a file path, or "stderr" or
+// "stdout"; an empty Output means stderr.
+type Config struct {
+	Level  string
+	Format string
+	Output string
+}
+
+// level is shared by every handler Setup installs, so SetLevel takes effect
+// without replacing the logger.
+var level = new(slog.LevelVar)
+
+// ParseLevel accepts debug, info, warn and error, in any case.
+func ParseLevel(s string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(s)); err != nil {
+		return 0, fmt.Errorf("unknown log level %q", s)
+	}
+	return l, nil
+}
+
+// SetLevel changes the minimum level logged.
+func SetLevel(l slog.Level) {
+	level.Set(l)
+}
+
+// Setup makes cfg's logger the slog default, which the standard log package
+// also writes through. The returned closer closes the log file, if any.
+func Setup(cfg Config) (io.Closer, error) {
+	if cfg.Level != "" {
+		l, err := ParseLevel(cfg.Level)
+		if err != nil {
+			return nil, err
+		}
+		level.Set(l)
+	}
+
+	var w io.Writer
+	var closer io.Closer = io.NopCloser(nil)
+	switch cfg.Output {
+	case "", "stderr":
+		w = os.Stderr
+	case "stdout":
+		w = os.Stdout
+	default:
+		f, err := os.OpenFile(cfg.Output, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
+		if err != nil {
+			return nil, err
+		}
+		w, closer = f, f
+	}
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(cfg.Format) {
+	case "", "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		closer.Close()
+		return nil, fmt.Errorf("unknown log format %q", cfg.Format)
+	}
+	slog.SetDefault(slog.New(h))
+	return closer, nil
+}
+
+// RequestIDHeader carries the request ID on HTTP requests and responses.
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLen bounds IDs supplied by clients, which are logged verbatim.
+const maxRequestIDLen = 128
+
+type requestIDKey struct{}
+
+// NewRequestID returns a random 16 character hex ID.
+func NewRequestID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+// ValidRequestID reports whether a client supplied id may be used as is:
+// printable ASCII without spaces, and not too long.
+func ValidRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the ID stored by WithRequestID, or "".
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,391 @@
+// Package metrics is a small in-process metrics registry that renders the
+// Prometheus text exposition format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets are latency buckets in seconds, from 100µs to 10s.
+var DefaultBuckets = []float64{.0001, .00025, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Default is the registry served by Handler.
+var Default = NewRegistry()
+
+type collector interface {
+	write(w *bufio.Writer)
+}
+
+// Registry holds metrics in the order they were registered.
+type Registry struct {
+	mu         sync.Mutex
+	names      map[string]bool
+	collectors []collector
+}
+
+func NewRegistry() *Registry {
+	return &Registry{names: make(map[string]bool)}
+}
+
+func (r *Registry) register(name string, c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.names[name] {
+		panic("metrics: duplicate metric " + name)
+	}
+	r.names[name] = true
+	r.collectors = append(r.collectors, c)
+}
+
+// WriteText writes every metric in the Prometheus text format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := append([]collector(nil), r.collectors...)
+	r.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	for _, c := range collectors {
+		c.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		r.WriteText(w)
+	})
+}
+
+func Handler() http.Handler {
+	return Default.Handler()
+}
+
+func writeHeader(w *bufio.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func writeSample(w *bufio.Writer, name, labels string, value float64) {
+	w.WriteString(name)
+	if labels != "" {
+		w.WriteString("{" + labels + "}")
+	}
+	w.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// formatLabels renders names and values as name="value" pairs.
+func formatLabels(names, values []string) string {
+	if len(names) != len(values) {
+		panic(fmt.Sprintf("metrics: got %d label values for %d labels", len(values), len(names)))
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + escapeLabel(values[i]) + `"`
+	}
+	return strings.Join(pairs, ",")
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+// vec holds one child per distinct combination of label values.
+type vec[T any] struct {
+	mu       sync.Mutex
+	labels   []string
+	children map[string]T
+	create   func() T
+}
+
+func (v *vec[T]) with(values []string) T {
+	key := formatLabels(v.labels, values)
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	c, ok := v.children[key]
+	if !ok {
+		c = v.create()
+		v.children[key] = c
+	}
+	return c
+}
+
+// each visits the children in label order, so output is stable.
+func (v *vec[T]) each(fn func(labels string, c T)) {
+	v.mu.Lock()
+	keys := make([]string, 0, len(v.children))
+	for k := range v.children {
+		keys = append(keys, k)
+	}
+	children := make(map[string]T, len(v.children))
+	for k, c := range v.children {
+		children[k] = c
+	}
+	v.mu.Unlock()
+
+	sort.Strings(keys)
+	for _, k := range keys {
+		fn(k, children[k])
+	}
+}
+
+// atomicFloat is a float64 updated with compare-and-swap.
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(delta float64) {
+	for {
+		old := f.bits.Load()
+		next := math.Float64bits(math.Float64frombits(old) + delta)
+		if f.bits.CompareAndSwap(old, next) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter only goes up.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+func (c *Counter) Add(delta float64) {
+	if delta < 0 {
+		panic("metrics: counter cannot decrease")
+	}
+	c.v.Add(delta)
+}
+
+type CounterVec struct {
+	name, help string
+	vec        vec[*Counter]
+}
+
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, vec: vec[*Counter]{
+		labels:   labels,
+		children: make(map[string]*Counter),
+		create:   func() *Counter { return &Counter{} },
+	}}
+	r.register(name, c)
+	return c
+}
+
+func (r *Registry) NewCounter(name, help string) *Counter {
+	return r.NewCounterVec(name, help).With()
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.vec.with(values)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	writeHeader(w, c.name, c.help, "counter")
+	c.vec.each(func(labels string, child *Counter) {
+		writeSample(w, c.name, labels, child.v.Load())
+	})
+}
+
+// Gauge can go up and down.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+
+func (g *Gauge) Add(delta float64) {
+	g.v.Add(delta)
+}
+
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+type GaugeVec struct {
+	name, help string
+	vec        vec[*Gauge]
+}
+
+func (r *Registry) NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{name: name, help: help, vec: vec[*Gauge]{
+		labels:   labels,
+		children: make(map[string]*Gauge),
+		create:   func() *Gauge { return &Gauge{} },
+	}}
+	r.register(name, g)
+	return g
+}
+
+func (r *Registry) NewGauge(name, help string) *Gauge {
+	return r.NewGaugeVec(name, help).With()
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.vec.with(values)
+}
+
+func (g *GaugeVec) write(w *bufio.Writer) {
+	writeHeader(w, g.name, g.help, "gauge")
+	g.vec.each(func(labels string, child *Gauge) {
+		writeSample(w, g.name, labels, child.v.Load())
+	})
+}
+
+// funcMetric reads its samples when scraped, keyed by the value of a single
+// label, or by "" when it has none.
+type funcMetric struct {
+	name, help, typ, label string
+	fn                     func() map[string]float64
+}
+
+// NewGaugeFunc registers a gauge whose value is read from fn on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "gauge", fn: func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	}})
+}
+
+// NewCounterFunc registers a counter whose value is read from fn on every
+// scrape, for totals kept elsewhere.
+func (r *Registry) NewCounterFunc(name, help string, fn func() float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "counter", fn: func() map[string]float64 {
+		return map[string]float64{"": fn()}
+	}})
+}
+
+// NewGaugeVecFunc registers a gauge with one label whose values are read
+// from fn on every scrape.
+func (r *Registry) NewGaugeVecFunc(name, help, label string, fn func() map[string]float64) {
+	r.register(name, &funcMetric{name: name, help: help, typ: "gauge", label: label, fn: fn})
+}
+
+func (m *funcMetric) write(w *bufio.Writer) {
+	writeHeader(w, m.name, m.help, m.typ)
+	samples := m.fn()
+	keys := make([]string, 0, len(samples))
+	for k := range samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		labels := ""
+		if m.label != "" {
+			labels = formatLabels([]string{m.label}, []string{k})
+		}
+		writeSample(w, m.name, labels, samples[k])
+	}
+}
+
+// Histogram counts observations into cumulative buckets.
+type Histogram struct {
+	buckets []float64
+	counts  []atomic.Uint64
+	count   atomic.Uint64
+	sum     atomicFloat
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]atomic.Uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	i := sort.SearchFloat64s(h.buckets, v)
+	if i < len(h.buckets) {
+		h.counts[i].Add(1)
+	}
+	h.count.Add(1)
+	h.sum.Add(v)
+}
+
+// Since observes the seconds elapsed since start.
+func (h *Histogram) Since(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+type HistogramVec struct {
+	name, help string
+	vec        vec[*Histogram]
+}
+
+// NewHistogramVec registers a histogram. Buckets are upper bounds in
+// increasing order; nil means DefaultBuckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefaultBuckets
+	}
+	h := &HistogramVec{name: name, help: help, vec: vec[*Histogram]{
+		labels:   labels,
+		children: make(map[string]*Histogram),
+		create:   func() *Histogram { return newHistogram(buckets) },
+	}}
+	r.register(name, h)
+	return h
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64) *Histogram {
+	return r.NewHistogramVec(name, help, buckets).With()
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.vec.with(values)
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	writeHeader(w, h.name, h.help, "histogram")
+	h.vec.each(func(labels string, child *Histogram) {
+		sep := ""
+		if labels != "" {
+			sep = ","
+		}
+		var cumulative uint64
+		for i, upper := range child.buckets {
+			cumulative += child.counts[i].Load()
+			writeSample(w, h.name+"_bucket", labels+sep+`le="`+formatFloat(upper)+`"`, float64(cumulative))
+		}
+		count := child.count.Load()
+		writeSample(w, h.name+"_bucket", labels+sep+`le="+Inf"`, float64(count))
+		writeSample(w, h.name+"_sum", labels, child.sum.Load())
+		writeSample(w, h.name+"_count", labels, float64(count))
+	})
+}
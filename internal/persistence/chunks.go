@@ -0,0 +1,97 @@
+package persistence
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// chunkDir holds the pieces of chunked values next to the snapshot, one
+// file per piece named by its SHA-256. Pieces are shared by every snapshot
+// and value that contains them, so unchanged values are not rewritten.
+func (p *Persistence) chunkDir() string {
+	return p.filename + ".chunks"
+}
+
+// writeChunks makes sure every piece of c is on disk and returns their
+// names, adding them to written.
+func (p *Persistence) writeChunks(c *store.Chunks, written map[string]bool) ([]string, error) {
+	names, ok := p.chunkNames[c]
+	if !ok {
+		for _, part := range c.Parts() {
+			sum := sha256.Sum256(part)
+			names = append(names, hex.EncodeToString(sum[:]))
+		}
+	}
+	p.nextChunkNames[c] = names
+
+	if err := os.MkdirAll(p.chunkDir(), 0755); err != nil {
+		return nil, err
+	}
+	for i, name := range names {
+		if written[name] {
+			continue
+		}
+		path := filepath.Join(p.chunkDir(), name)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			if err := writeFileAtomic(path, c.Parts()[i]); err != nil {
+				return nil, err
+			}
+		}
+		written[name] = true
+	}
+	return names, nil
+}
+
+func (p *Persistence) readChunks(names []string) (*store.Chunks, error) {
+	parts := make([][]byte, len(names))
+	for i, name := range names {
+		part, err := os.ReadFile(filepath.Join(p.chunkDir(), name))
+		if err != nil {
+			return nil, err
+		}
+		if sum := sha256.Sum256(part); hex.EncodeToString(sum[:]) != name {
+			return nil, fmt.Errorf("chunk %s is corrupt", name)
+		}
+		parts[i] = part
+	}
+	return store.NewChunks(parts), nil
+}
+
+// pruneChunks removes the pieces no longer referenced by the snapshot.
+func (p *Persistence) pruneChunks(keep map[string]bool) error {
+	entries, err := os.ReadDir(p.chunkDir())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if !keep[e.Name()] {
+			if err := os.Remove(filepath.Join(p.chunkDir(), e.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeFileAtomic replaces path with data, writing it to a file in the
+// same directory first so that path is never left partly written.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
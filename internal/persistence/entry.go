@@ -0,0 +1,103 @@
+package persistence
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// entry is a value as written to a snapshot. JSON has no byte strings, so
+// a []byte value is kept in Bytes, and any other value holding bytes is
+// kept CBOR-encoded in CBOR. A chunked value lists its pieces, which are
+// stored in their own files, in Chunks. Everything else is in Data.
+type entry struct {
+	Data        interface{} `json:",omitempty"`
+	Bytes       *[]byte     `json:",omitempty"`
+	CBOR        []byte      `json:",omitempty"`
+	Chunks      []string    `json:",omitempty"`
+	ContentType string      `json:",omitempty"`
+	Flags       uint32      `json:",omitempty"`
+	ExpiresAt   time.Time
+	Version     uint64 `json:",omitempty"`
+	ModifiedAt  time.Time
+}
+
+// newEntry converts v, writing the pieces of a chunked value and adding
+// their names to written.
+func (p *Persistence) newEntry(v store.Value, written map[string]bool) (entry, error) {
+	e := entry{
+		ContentType: v.ContentType,
+		Flags:       v.Flags,
+		ExpiresAt:   v.ExpiresAt,
+		Version:     v.Version,
+		ModifiedAt:  v.ModifiedAt,
+	}
+	switch data := v.Data.(type) {
+	case []byte:
+		e.Bytes = &data
+	case *store.Chunks:
+		names, err := p.writeChunks(data, written)
+		if err != nil {
+			return entry{}, err
+		}
+		e.Chunks = names
+	default:
+		if !holdsBytes(data) {
+			e.Data = data
+			break
+		}
+		encoded, err := codec.CBOR.Marshal(data)
+		if err != nil {
+			return entry{}, err
+		}
+		e.CBOR = encoded
+	}
+	return e, nil
+}
+
+func (p *Persistence) value(e entry) (store.Value, error) {
+	v := store.Value{
+		Data:        e.Data,
+		ContentType: e.ContentType,
+		Flags:       e.Flags,
+		ExpiresAt:   e.ExpiresAt,
+		Version:     e.Version,
+		ModifiedAt:  e.ModifiedAt,
+	}
+	switch {
+	case e.Bytes != nil:
+		v.Data = *e.Bytes
+	case e.Chunks != nil:
+		chunks, err := p.readChunks(e.Chunks)
+		if err != nil {
+			return store.Value{}, err
+		}
+		v.Data = chunks
+	case e.CBOR != nil:
+		if err := codec.CBOR.Unmarshal(e.CBOR, &v.Data); err != nil {
+			return store.Value{}, err
+		}
+	}
+	return v, nil
+}
+
+func holdsBytes(data interface{}) bool {
+	switch d := data.(type) {
+	case []byte:
+		return true
+	case []interface{}:
+		for _, item := range d {
+			if holdsBytes(item) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for _, item := range d {
+			if holdsBytes(item) {
+				return true
+			}
+		}
+	}
+	return false
+}
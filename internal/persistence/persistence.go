@@ -4,29 +4,61 @@ package persistence
 
 import (
 	"encoding/json"
+	"fmt"
+	"log/slog"
 	"os"
 	"sync"
 	"time"
 
+	"github.com/umgbhalla/gokv/internal/metrics"
 	"github.com/umgbhalla/gokv/internal/store"
 )
 
 
 type Persistence struct {
-	store    *store.Store
+	dbs      *store.Databases
 	filename string
 	interval time.Duration
 	stopChan chan struct{}
 	wg       sync.WaitGroup
+
+	mu     sync.Mutex
+	status Status
+
+	// saveMu serializes saves. chunkNames caches the piece names of the
+	// chunked values in the last snapshot; nextChunkNames collects them for
+	// the one being written.
+	saveMu         sync.Mutex
+	chunkNames     map[*store.Chunks][]string
+	nextChunkNames map[*store.Chunks][]string
+}
+
+// Status reports the outcome of the last load and save.
+type Status struct {
+	File                string     `json:"file"`
+	Loaded              bool       `json:"loaded"`
+	LoadError           string     `json:"load_error,omitempty"`
+	LastSave            *time.Time `json:"last_save,omitempty"`
+	LastSaveSeconds     float64    `json:"last_save_seconds"`
+	LastSaveError       string     `json:"last_save_error,omitempty"`
+	LastSuccessfulSave  *time.Time `json:"last_successful_save,omitempty"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+}
+
+func (p *Persistence) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
 }
 
 
-func New(s *store.Store, filename string, interval time.Duration) *Persistence {
+func New(dbs *store.Databases, filename string, interval time.Duration) *Persistence {
 	return &Persistence{
-		store:    s,
+		dbs:      dbs,
 		filename: filename,
 		interval: interval,
 		stopChan: make(chan struct{}),
+		status:   Status{File: filename},
 	}
 }
 
@@ -42,8 +74,7 @@ func (p *Persistence) Start() {
 			select {
 			case <-ticker.C:
 				if err := p.Save(); err != nil {
-					// TODO: Implement proper error handling
-					println("Error saving data:", err.Error())
+					slog.Error("snapshot failed", "file", p.filename, "error", err)
 				}
 			case <-p.stopChan:
 				return
@@ -52,17 +83,94 @@ func (p *Persistence) Start() {
 	}()
 }
 
+// snapshot is the on-disk format. Version 1 files were a bare map of the
+// single keyspace and are loaded into the default database. Version 2 files
+// stored values as they are in memory, which lost binary data.
+type snapshot struct {
+	Version   int                          `json:"version"`
+	Databases map[string]map[string]entry `json:"databases"`
+}
+
+const snapshotVersion = 3
+
+var (
+	snapshotDuration = metrics.Default.NewHistogram("gokv_snapshot_duration_seconds",
+		"Time taken to write a snapshot.", []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60})
+	snapshotFailures = metrics.Default.NewCounter("gokv_snapshot_failures_total",
+		"Snapshots that could not be written.")
+	snapshotLastSuccess = metrics.Default.NewGauge("gokv_snapshot_last_success_timestamp_seconds",
+		"Unix time of the last snapshot written successfully.")
+)
+
 func (p *Persistence) Save() error {
-	data := p.store.GetAll()
+	start := time.Now()
+	err := p.save()
+	now := time.Now()
+	snapshotDuration.Since(start)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.LastSave = &now
+	p.status.LastSaveSeconds = now.Sub(start).Seconds()
+	if err != nil {
+		snapshotFailures.Inc()
+		p.status.LastSaveError = err.Error()
+		p.status.ConsecutiveFailures++
+		return err
+	}
+	snapshotLastSuccess.Set(float64(now.Unix()))
+	p.status.LastSaveError = ""
+	p.status.LastSuccessfulSave = &now
+	p.status.ConsecutiveFailures = 0
+	return nil
+}
+
+func (p *Persistence) save() error {
+	p.saveMu.Lock()
+	defer p.saveMu.Unlock()
+
+	p.nextChunkNames = make(map[*store.Chunks][]string)
+	written := make(map[string]bool)
+	data := snapshot{Version: snapshotVersion, Databases: make(map[string]map[string]entry)}
+	for db, values := range p.dbs.Snapshot() {
+		entries := make(map[string]entry, len(values))
+		for key, v := range values {
+			e, err := p.newEntry(v, written)
+			if err != nil {
+				return fmt.Errorf("database %s, key %q: %w", db, key, err)
+			}
+			entries[key] = e
+		}
+		data.Databases[db] = entries
+	}
 	jsonData, err := json.Marshal(data)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(p.filename, jsonData, 0644)
+	// A save cut short must not leave a truncated snapshot, which the
+	// server would refuse to start from.
+	if err := writeFileAtomic(p.filename, jsonData); err != nil {
+		return err
+	}
+	p.chunkNames = p.nextChunkNames
+	return p.pruneChunks(written)
 }
 
+// Load restores the snapshot, if there is one. Its outcome is recorded in
+// Status.
 func (p *Persistence) Load() error {
+	err := p.load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.status.Loaded = err == nil
+	if err != nil {
+		p.status.LoadError = err.Error()
+	}
+	return err
+}
+
+func (p *Persistence) load() error {
 	jsonData, err := os.ReadFile(p.filename)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -73,13 +181,45 @@ func (p *Persistence) Load() error {
 		return err
 	}
 
-	var data map[string]store.Value
-	if err := json.Unmarshal(jsonData, &data); err != nil {
+	var probe map[string]json.RawMessage
+	if err := json.Unmarshal(jsonData, &probe); err != nil {
 		return err
 	}
+	var version int
+	if err := json.Unmarshal(probe["version"], &version); err != nil || version < 2 {
+		var data map[string]store.Value
+		if err := json.Unmarshal(jsonData, &data); err != nil {
+			return err
+		}
+		return p.dbs.Restore(map[string]map[string]store.Value{store.DefaultDB: data})
+	}
+	if version == 2 {
+		var data struct {
+			Databases map[string]map[string]store.Value `json:"databases"`
+		}
+		if err := json.Unmarshal(jsonData, &data); err != nil {
+			return err
+		}
+		return p.dbs.Restore(data.Databases)
+	}
 
-	p.store.SetAll(data)
-	return nil
+	var data snapshot
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return err
+	}
+	restored := make(map[string]map[string]store.Value, len(data.Databases))
+	for db, entries := range data.Databases {
+		values := make(map[string]store.Value, len(entries))
+		for key, e := range entries {
+			v, err := p.value(e)
+			if err != nil {
+				return fmt.Errorf("database %s, key %q: %w", db, key, err)
+			}
+			values[key] = v
+		}
+		restored[db] = values
+	}
+	return p.dbs.Restore(restored)
 }
 
 func (p *Persistence) Stop() {
@@ -0,0 +1,195 @@
+package persistence
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+func TestFailedSaveKeepsSnapshot(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.json")
+	dbs := store.NewDatabases(0, 0)
+	dbs.Default().Set("k", "old", 0)
+	p := New(dbs, file, time.Hour)
+	if err := p.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The temporary file cannot be written, so the save fails before
+	// touching the snapshot.
+	if err := os.Mkdir(file+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	dbs.Default().Set("k", "new", 0)
+	if err := p.Save(); err == nil {
+		t.Fatal("save succeeded")
+	}
+
+	loaded := store.NewDatabases(0, 0)
+	if err := New(loaded, file, time.Hour).Load(); err != nil {
+		t.Fatalf("load after a failed save: %v", err)
+	}
+	if v, _ := loaded.Default().Get("k"); v != "old" {
+		t.Fatalf("k = %v, want the last saved value", v)
+	}
+}
+
+// modified is the revision time of the values in the tests.
+var modified = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// roundTrip saves values to file and loads them into new databases.
+func roundTrip(t *testing.T, file string, values map[string]map[string]store.Value) *store.Databases {
+	t.Helper()
+	dbs := store.NewDatabases(0, 0)
+	if err := dbs.Restore(values); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(dbs, file, time.Hour).Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded := store.NewDatabases(0, 0)
+	if err := New(loaded, file, time.Hour).Load(); err != nil {
+		t.Fatal(err)
+	}
+	return loaded
+}
+
+// checkValues reports the values of dbs that differ from want. Chunked
+// values are compared by content.
+func checkValues(t *testing.T, dbs *store.Databases, want map[string]map[string]store.Value) {
+	t.Helper()
+	for db, values := range want {
+		s, err := dbs.Open(db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, w := range values {
+			got, ok := s.GetValue(key)
+			if !ok {
+				t.Errorf("%s/%s missing", db, key)
+				continue
+			}
+			if wc, ok := w.Data.(*store.Chunks); ok {
+				gc, ok := got.Data.(*store.Chunks)
+				if !ok || !bytes.Equal(gc.Bytes(), wc.Bytes()) || len(gc.Parts()) != len(wc.Parts()) {
+					t.Errorf("%s/%s = %#v, want the chunks back", db, key, got.Data)
+				}
+				got.Data, w.Data = nil, nil
+			}
+			if !reflect.DeepEqual(got.Data, w.Data) {
+				t.Errorf("%s/%s data = %#v, want %#v", db, key, got.Data, w.Data)
+			}
+			if got.ContentType != w.ContentType || got.Flags != w.Flags || got.Version != w.Version ||
+				!got.ExpiresAt.Equal(w.ExpiresAt) || !got.ModifiedAt.Equal(w.ModifiedAt) {
+				t.Errorf("%s/%s = %+v, want %+v", db, key, got, w)
+			}
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	values := map[string]map[string]store.Value{
+		store.DefaultDB: {
+			"string": {Data: "hello", Version: 1, ModifiedAt: modified},
+			"doc": {Data: map[string]interface{}{"n": 1.5, "tags": []interface{}{"a", true, nil}},
+				ExpiresAt: modified.Add(100 * 365 * 24 * time.Hour), Version: 2, ModifiedAt: modified},
+			"binary": {Data: []byte{0, 1, 0xff}, ContentType: "application/octet-stream", Flags: 7, Version: 3, ModifiedAt: modified},
+			"empty":  {Data: []byte{}, Version: 4, ModifiedAt: modified},
+			// A document holding bytes is kept as CBOR.
+			"mixed": {Data: map[string]interface{}{"raw": []byte("\x00bytes"), "list": []interface{}{[]byte{1}}}, Version: 5, ModifiedAt: modified},
+		},
+		"other": {
+			"string": {Data: "other", Version: 1, ModifiedAt: modified},
+		},
+	}
+	loaded := roundTrip(t, filepath.Join(t.TempDir(), "dump.json"), values)
+	checkValues(t, loaded, values)
+}
+
+func TestLoadLegacySnapshots(t *testing.T) {
+	greeting := store.Value{Data: "hello", Version: 1, ModifiedAt: modified}
+	user := store.Value{
+		Data:       map[string]interface{}{"name": "Ada", "age": 36.0},
+		ExpiresAt:  time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC),
+		Version:    2,
+		ModifiedAt: modified.Add(time.Second),
+	}
+	tests := []struct {
+		file string
+		want map[string]map[string]store.Value
+	}{
+		{"snapshot-v1.json", map[string]map[string]store.Value{
+			store.DefaultDB: {"greeting": greeting, "user:1": user},
+		}},
+		{"snapshot-v2.json", map[string]map[string]store.Value{
+			store.DefaultDB: {"greeting": greeting, "user:1": user},
+			"sessions":      {"s:1": {Data: []interface{}{"a", "b"}, Version: 3, ModifiedAt: modified.Add(2 * time.Second)}},
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			dbs := store.NewDatabases(0, 0)
+			if err := New(dbs, filepath.Join("testdata", tt.file), time.Hour).Load(); err != nil {
+				t.Fatal(err)
+			}
+			checkValues(t, dbs, tt.want)
+
+			// The next save upgrades the snapshot to the current version.
+			upgraded := filepath.Join(t.TempDir(), "dump.json")
+			checkValues(t, roundTrip(t, upgraded, dbs.Snapshot()), tt.want)
+		})
+	}
+}
+
+func TestChunkedRoundTrip(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.json")
+	chunks := store.NewChunks([][]byte{[]byte("first "), []byte("second "), []byte("first ")})
+	values := map[string]map[string]store.Value{
+		store.DefaultDB: {"chunked": {Data: chunks, ContentType: "image/png", Version: 1, ModifiedAt: modified}},
+		"other":         {"chunked": {Data: chunks, Version: 1, ModifiedAt: modified}},
+	}
+	loaded := roundTrip(t, file, values)
+	checkValues(t, loaded, values)
+
+	// Pieces are stored once, by content, however many values hold them.
+	chunkFiles, err := os.ReadDir(file + ".chunks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunkFiles) != 2 {
+		t.Errorf("%d chunk files, want 2", len(chunkFiles))
+	}
+
+	// Saving again after the chunked values are gone removes their pieces.
+	loaded.Default().Delete("chunked")
+	other, _ := loaded.Open("other")
+	other.Delete("chunked")
+	if err := New(loaded, file, time.Hour).Save(); err != nil {
+		t.Fatal(err)
+	}
+	if chunkFiles, _ := os.ReadDir(file + ".chunks"); len(chunkFiles) != 0 {
+		t.Errorf("%d chunk files left", len(chunkFiles))
+	}
+}
+
+func TestCorruptChunk(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.json")
+	chunks := store.NewChunks([][]byte{[]byte("piece")})
+	roundTrip(t, file, map[string]map[string]store.Value{store.DefaultDB: {"k": {Data: chunks}}})
+
+	chunkFiles, err := os.ReadDir(file + ".chunks")
+	if err != nil || len(chunkFiles) != 1 {
+		t.Fatalf("chunk files: %v, %v", chunkFiles, err)
+	}
+	if err := os.WriteFile(filepath.Join(file+".chunks", chunkFiles[0].Name()), []byte("other"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := New(store.NewDatabases(0, 0), file, time.Hour).Load(); err == nil {
+		t.Fatal("loaded a corrupt chunk")
+	}
+}
@@ -0,0 +1,450 @@
+package query
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+)
+
+// AdminRole exempts a principal from ACL checks, so that an administrator
+// can always manage the rules.
+const AdminRole = "admin"
+
+// Command categories usable in ACL rules in place of command names.
+const (
+	CategoryRead  = "@read"
+	CategoryWrite = "@write"
+	CategoryAdmin = "@admin"
+	CategoryAll   = "@all"
+)
+
+var commandCategories = map[string]string{
+	"GET":          CategoryRead,
+	"SCAN":         CategoryRead,
+	"KEYS":         CategoryRead,
+	"COUNT":        CategoryRead,
+	"SUM":          CategoryRead,
+	"AVG":          CategoryRead,
+	"MIN":          CategoryRead,
+	"MAX":          CategoryRead,
+	"DATABASES":    CategoryRead,
+	"JOB":          CategoryRead,
+	"JOBS":         CategoryRead,
+	"WATCH":        CategoryRead,
+	"SET":          CategoryWrite,
+	"DELETE":       CategoryWrite,
+	"DELPREFIX":    CategoryWrite,
+	"DELMATCH":     CategoryWrite,
+	"EXPIRE":       CategoryWrite,
+	"EXPIREPREFIX": CategoryWrite,
+	"RENAME":       CategoryWrite,
+	"COPY":         CategoryWrite,
+	"RENAMEPREFIX": CategoryWrite,
+	"TXN":          CategoryWrite,
+	"INDEX":        CategoryAdmin,
+	"ACL":          CategoryAdmin,
+	"INFO":         CategoryAdmin,
+	"SLOWLOG":      CategoryAdmin,
+	"MONITOR":      CategoryAdmin,
+}
+
+var (
+	ErrPermissionDenied = errors.New("permission denied")
+	ErrACLDisabled      = errors.New("access control is not configured")
+	ErrACLUserNotFound  = errors.New("acl user not found")
+)
+
+// ACLRule allows, or with Deny refuses, the listed commands on keys matching
+// one of the glob patterns in Keys. Commands are command names or one of the
+// categories @read, @write, @admin and @all. A rule without key patterns
+// covers every key.
+type ACLRule struct {
+	Commands []string `json:"commands"`
+	Keys     []string `json:"keys,omitempty"`
+	Deny     bool     `json:"deny,omitempty"`
+}
+
+// RolePrefix starts the name of an ACLUser holding the rules for a role
+// rather than for a principal: "role:ops" applies to every principal with
+// the role ops. Principal names come from outside, so the prefix keeps a
+// principal named like a role from getting its rules.
+const RolePrefix = "role:"
+
+// ACLUser holds the rules for the principal of that name or, if the name
+// starts with RolePrefix, for a role.
+type ACLUser struct {
+	Name  string    `json:"name"`
+	Rules []ACLRule `json:"rules"`
+}
+
+type aclRule struct {
+	commands map[string]bool
+	keys     []*Matcher
+	deny     bool
+}
+
+func compileRule(r ACLRule) (aclRule, error) {
+	if len(r.Commands) == 0 {
+		return aclRule{}, errors.New("rule lists no commands")
+	}
+	c := aclRule{commands: make(map[string]bool, len(r.Commands)), deny: r.Deny}
+	for _, cmd := range r.Commands {
+		switch cmd = strings.ToUpper(cmd); cmd {
+		case "*", "@ALL":
+			cmd = CategoryAll
+		case "@READ", "@WRITE", "@ADMIN":
+			cmd = strings.ToLower(cmd)
+		default:
+			if _, ok := commandCategories[cmd]; !ok {
+				return aclRule{}, fmt.Errorf("unknown command %q", cmd)
+			}
+		}
+		c.commands[cmd] = true
+	}
+	for _, pattern := range r.Keys {
+		m, err := CompileGlob(pattern)
+		if err != nil {
+			return aclRule{}, err
+		}
+		c.keys = append(c.keys, m)
+	}
+	return c, nil
+}
+
+func (r aclRule) coversCommand(command string) bool {
+	return r.commands[command] || r.commands[commandCategories[command]] || r.commands[CategoryAll]
+}
+
+func (r aclRule) coversKey(key string) bool {
+	if len(r.keys) == 0 {
+		return true
+	}
+	for _, m := range r.keys {
+		if m.Match(key) {
+			return true
+		}
+	}
+	return false
+}
+
+// ACL holds per-user rules and saves them to a file on every change.
+// Principals without any rules are refused everything.
+type ACL struct {
+	mu       sync.RWMutex
+	filename string
+	users    map[string]ACLUser
+	rules    map[string][]aclRule
+}
+
+type aclFile struct {
+	Users []ACLUser `json:"users"`
+}
+
+// LoadACL reads the rules saved in filename. A missing file yields an empty
+// ACL that will be saved there.
+func LoadACL(filename string) (*ACL, error) {
+	a := &ACL{filename: filename, users: make(map[string]ACLUser), rules: make(map[string][]aclRule)}
+	raw, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return a, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var f aclFile
+	if err := json.Unmarshal(raw, &f); err != nil {
+		return nil, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	for _, u := range f.Users {
+		if err := a.put(u); err != nil {
+			return nil, fmt.Errorf("user %q in %s: %w", u.Name, filename, err)
+		}
+	}
+	return a, nil
+}
+
+func (a *ACL) put(u ACLUser) error {
+	if u.Name == "" || u.Name == RolePrefix {
+		return errors.New("user has no name")
+	}
+	compiled := make([]aclRule, 0, len(u.Rules))
+	for _, r := range u.Rules {
+		c, err := compileRule(r)
+		if err != nil {
+			return err
+		}
+		compiled = append(compiled, c)
+	}
+	a.users[u.Name] = u
+	a.rules[u.Name] = compiled
+	return nil
+}
+
+// save writes the rules to a temporary file and renames it into place, so
+// a crash never leaves a truncated file behind.
+func (a *ACL) save() error {
+	f := aclFile{Users: a.list()}
+	raw, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(a.filename), filepath.Base(a.filename)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(raw); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), a.filename)
+}
+
+func (a *ACL) list() []ACLUser {
+	users := make([]ACLUser, 0, len(a.users))
+	for _, u := range a.users {
+		users = append(users, u)
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Name < users[j].Name })
+	return users
+}
+
+func (a *ACL) Users() []ACLUser {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.list()
+}
+
+func (a *ACL) User(name string) (ACLUser, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	u, ok := a.users[name]
+	return u, ok
+}
+
+// SetUser creates or replaces the rules for u.Name. Invalid rules are
+// reported as parse errors and leave the ACL unchanged.
+func (a *ACL) SetUser(u ACLUser) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	previous, existed := a.users[u.Name]
+	if err := a.put(u); err != nil {
+		return parseErrorf("%s", err)
+	}
+	if err := a.save(); err != nil {
+		if existed {
+			a.put(previous)
+		} else {
+			delete(a.users, u.Name)
+			delete(a.rules, u.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+func (a *ACL) DeleteUser(name string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	u, ok := a.users[name]
+	if !ok {
+		return ErrACLUserNotFound
+	}
+	delete(a.users, name)
+	delete(a.rules, name)
+	if err := a.save(); err != nil {
+		a.put(u)
+		return err
+	}
+	return nil
+}
+
+// rulesFor gathers the rules for p's name and each of its roles. A
+// principal whose name starts with RolePrefix only has its roles' rules.
+func (a *ACL) rulesFor(p *auth.Principal) []aclRule {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	var rules []aclRule
+	if !strings.HasPrefix(p.Name, RolePrefix) {
+		rules = append(rules, a.rules[p.Name]...)
+	}
+	for _, role := range p.Roles {
+		rules = append(rules, a.rules[RolePrefix+role]...)
+	}
+	return rules
+}
+
+// allowsCommand reports whether command may run on at least some keys.
+func allowsCommand(rules []aclRule, command string) bool {
+	allowed := false
+	for _, r := range rules {
+		if !r.coversCommand(command) {
+			continue
+		}
+		if r.deny && len(r.keys) == 0 {
+			return false
+		}
+		if !r.deny {
+			allowed = true
+		}
+	}
+	return allowed
+}
+
+func allowsKey(rules []aclRule, command, key string) bool {
+	allowed := false
+	for _, r := range rules {
+		if !r.coversCommand(command) || !r.coversKey(key) {
+			continue
+		}
+		if r.deny {
+			return false
+		}
+		allowed = true
+	}
+	return allowed
+}
+
+// authorize checks that q's principal may run command on every one of keys,
+// or on some keys when none are given.
+func (q *Query) authorize(command string, keys ...string) error {
+	if q.acl == nil || q.principal == nil || q.principal.HasRole(AdminRole) {
+		return nil
+	}
+	rules := q.acl.rulesFor(q.principal)
+	if !allowsCommand(rules, command) {
+		return ErrPermissionDenied
+	}
+	for _, key := range keys {
+		if !allowsKey(rules, command, key) {
+			return ErrPermissionDenied
+		}
+	}
+	return nil
+}
+
+// restrict checks that q's principal may run command at all and returns a
+// Query whose scans skip the keys it may not run command on.
+func (q *Query) restrict(command string) (*Query, error) {
+	if err := q.authorize(command); err != nil {
+		return nil, err
+	}
+	if q.acl == nil || q.principal == nil || q.principal.HasRole(AdminRole) {
+		return q, nil
+	}
+	rules := q.acl.rulesFor(q.principal)
+	r := *q
+	r.guard = func(key string) bool {
+		return allowsKey(rules, command, key)
+	}
+	return &r, nil
+}
+
+// permits reports whether the command q was restricted to may touch key.
+func (q *Query) permits(key string) bool {
+	return q.guard == nil || q.guard(key)
+}
+
+// SetACL enables access control. Only queries made with WithPrincipal are
+// checked; it must be called before any are.
+func (q *Query) SetACL(acl *ACL) {
+	q.acl = acl
+}
+
+// WithPrincipal returns a Query that runs commands on behalf of p. A nil p,
+// as when authentication is disabled, is not subject to the ACL.
+func (q *Query) WithPrincipal(p *auth.Principal) *Query {
+	r := *q
+	r.principal = p
+	r.guard = nil
+	return &r
+}
+
+// Principal returns the principal q runs commands for, if any.
+func (q *Query) Principal() *auth.Principal {
+	return q.principal
+}
+
+func (q *Query) ACLUsers() ([]ACLUser, error) {
+	if err := q.authorizeACL(); err != nil {
+		return nil, err
+	}
+	return q.acl.Users(), nil
+}
+
+func (q *Query) ACLUser(name string) (ACLUser, error) {
+	if err := q.authorizeACL(); err != nil {
+		return ACLUser{}, err
+	}
+	u, ok := q.acl.User(name)
+	if !ok {
+		return ACLUser{}, ErrACLUserNotFound
+	}
+	return u, nil
+}
+
+func (q *Query) SetACLUser(u ACLUser) error {
+	if err := q.authorizeACL(); err != nil {
+		return err
+	}
+	return q.acl.SetUser(u)
+}
+
+func (q *Query) DeleteACLUser(name string) error {
+	if err := q.authorizeACL(); err != nil {
+		return err
+	}
+	return q.acl.DeleteUser(name)
+}
+
+func (q *Query) authorizeACL() error {
+	if q.acl == nil {
+		return ErrACLDisabled
+	}
+	return q.authorize("ACL")
+}
+
+// executeACL handles ACL WHOAMI, ACL LIST, ACL GETUSER <name> and
+// ACL DELUSER <name>. Rules are set through SetACLUser.
+func (q *Query) executeACL(p *parser) (interface{}, error) {
+	switch {
+	case p.acceptKeyword("WHOAMI"):
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.principal, nil
+	case p.acceptKeyword("LIST"):
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.ACLUsers()
+	case p.atKeyword("GETUSER"), p.atKeyword("DELUSER"):
+		del := p.atKeyword("DELUSER")
+		p.next()
+		name, err := p.argument("user name")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		if del {
+			return nil, q.DeleteACLUser(name)
+		}
+		return q.ACLUser(name)
+	}
+	return nil, p.errorf(p.peek(), "expected WHOAMI, LIST, GETUSER or DELUSER")
+}
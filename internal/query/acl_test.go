@@ -0,0 +1,258 @@
+package query
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/umgbhalla/gokv/internal/auth"
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// newACLQuery returns a query enforcing an ACL with the given users, saved
+// under a temporary directory.
+func newACLQuery(t *testing.T, users ...ACLUser) *Query {
+	t.Helper()
+	acl, err := LoadACL(filepath.Join(t.TempDir(), "acl.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, u := range users {
+		if err := acl.SetUser(u); err != nil {
+			t.Fatalf("SetUser(%q): %v", u.Name, err)
+		}
+	}
+	q := New(store.NewDatabases(0, 0))
+	q.SetACL(acl)
+	return q
+}
+
+func TestAuthorize(t *testing.T) {
+	q := newACLQuery(t,
+		ACLUser{Name: "reader", Rules: []ACLRule{
+			{Commands: []string{"@read"}, Keys: []string{"user:*"}},
+		}},
+		ACLUser{Name: "role:ops", Rules: []ACLRule{
+			{Commands: []string{"SET", "DELETE"}, Keys: []string{"job:*"}},
+		}},
+	)
+
+	tests := []struct {
+		name    string
+		p       *auth.Principal
+		command string
+		keys    []string
+		allowed bool
+	}{
+		{"anonymous", nil, "SET", []string{"any"}, true},
+		{"admin", &auth.Principal{Name: "root", Roles: []string{AdminRole}}, "ACL", nil, true},
+		{"no rules", &auth.Principal{Name: "stranger"}, "GET", []string{"user:1"}, false},
+		{"no rules, no keys", &auth.Principal{Name: "stranger"}, "SCAN", nil, false},
+		{"category", &auth.Principal{Name: "reader"}, "GET", []string{"user:1"}, true},
+		{"category, other key", &auth.Principal{Name: "reader"}, "GET", []string{"acct:1"}, false},
+		{"category, other command", &auth.Principal{Name: "reader"}, "SET", []string{"user:1"}, false},
+		{"some keys", &auth.Principal{Name: "reader"}, "SCAN", nil, true},
+		{"every key", &auth.Principal{Name: "reader"}, "GET", []string{"user:1", "acct:1"}, false},
+		{"role", &auth.Principal{Name: "alice", Roles: []string{"ops"}}, "DELETE", []string{"job:7"}, true},
+		{"role, other command", &auth.Principal{Name: "alice", Roles: []string{"ops"}}, "GET", []string{"job:7"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.WithPrincipal(tt.p).authorize(tt.command, tt.keys...)
+			if tt.allowed && err != nil {
+				t.Fatalf("authorize(%s, %v) = %v, want nil", tt.command, tt.keys, err)
+			}
+			if !tt.allowed && !errors.Is(err, ErrPermissionDenied) {
+				t.Fatalf("authorize(%s, %v) = %v, want ErrPermissionDenied", tt.command, tt.keys, err)
+			}
+		})
+	}
+}
+
+// TestRoleNameCollision checks that a principal named like a role, which
+// callers such as certificate or token issuers choose, does not get the
+// role's rules.
+func TestRoleNameCollision(t *testing.T) {
+	q := newACLQuery(t,
+		ACLUser{Name: "role:writers", Rules: []ACLRule{{Commands: []string{"@write"}}}},
+		ACLUser{Name: "writers", Rules: []ACLRule{{Commands: []string{"GET"}}}},
+	)
+
+	tests := []struct {
+		name    string
+		p       *auth.Principal
+		command string
+		allowed bool
+	}{
+		{"user rules", &auth.Principal{Name: "writers"}, "GET", true},
+		{"named like the role", &auth.Principal{Name: "writers"}, "SET", false},
+		{"named with the prefix", &auth.Principal{Name: "role:writers"}, "SET", false},
+		{"holding the role", &auth.Principal{Name: "alice", Roles: []string{"writers"}}, "SET", true},
+		{"holding the role, not the user", &auth.Principal{Name: "alice", Roles: []string{"writers"}}, "GET", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := q.WithPrincipal(tt.p).authorize(tt.command, "k")
+			if tt.allowed != (err == nil) {
+				t.Fatalf("authorize(%s) = %v, want allowed %v", tt.command, err, tt.allowed)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithoutACL(t *testing.T) {
+	q := New(store.NewDatabases(0, 0)).WithPrincipal(&auth.Principal{Name: "stranger"})
+	if err := q.authorize("DELETE", "any"); err != nil {
+		t.Fatalf("authorize without an ACL = %v, want nil", err)
+	}
+}
+
+func TestDenyOverridesAllow(t *testing.T) {
+	allow := ACLRule{Commands: []string{"@all"}}
+	denyKeys := ACLRule{Commands: []string{"DELETE"}, Keys: []string{"locked:*"}, Deny: true}
+	denyAll := ACLRule{Commands: []string{"@admin"}, Deny: true}
+
+	// Deny wins however the rules are ordered, and whether it comes from
+	// the user's own rules or from a role.
+	orders := map[string][]ACLUser{
+		"allow first": {{Name: "bob", Rules: []ACLRule{allow, denyKeys, denyAll}}},
+		"deny first":  {{Name: "bob", Rules: []ACLRule{denyKeys, denyAll, allow}}},
+		"deny by role": {
+			{Name: "bob", Rules: []ACLRule{allow}},
+			{Name: "role:restricted", Rules: []ACLRule{denyKeys, denyAll}},
+		},
+	}
+	for name, users := range orders {
+		t.Run(name, func(t *testing.T) {
+			q := newACLQuery(t, users...).WithPrincipal(&auth.Principal{Name: "bob", Roles: []string{"restricted"}})
+			if err := q.authorize("DELETE", "open:1"); err != nil {
+				t.Errorf("DELETE open:1 = %v, want nil", err)
+			}
+			if err := q.authorize("DELETE", "locked:1"); !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("DELETE locked:1 = %v, want ErrPermissionDenied", err)
+			}
+			if err := q.authorize("SET", "locked:1"); err != nil {
+				t.Errorf("SET locked:1 = %v, want nil", err)
+			}
+			// A deny without key patterns refuses the command outright.
+			if err := q.authorize("INFO"); !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("INFO = %v, want ErrPermissionDenied", err)
+			}
+			if _, err := q.restrict("SLOWLOG"); !errors.Is(err, ErrPermissionDenied) {
+				t.Errorf("restrict(SLOWLOG) = %v, want ErrPermissionDenied", err)
+			}
+		})
+	}
+}
+
+func TestRestrict(t *testing.T) {
+	q := newACLQuery(t, ACLUser{Name: "reader", Rules: []ACLRule{
+		{Commands: []string{"SCAN"}, Keys: []string{"pub:*"}},
+		{Commands: []string{"SCAN"}, Keys: []string{"pub:secret*"}, Deny: true},
+	}})
+
+	if _, err := q.WithPrincipal(&auth.Principal{Name: "reader"}).restrict("GET"); !errors.Is(err, ErrPermissionDenied) {
+		t.Fatalf("restrict(GET) = %v, want ErrPermissionDenied", err)
+	}
+	r, err := q.WithPrincipal(&auth.Principal{Name: "reader"}).restrict("SCAN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]bool{"pub:1": true, "pub:secret": false, "priv:1": false} {
+		if got := r.permits(key); got != want {
+			t.Errorf("permits(%q) = %v, want %v", key, got, want)
+		}
+	}
+
+	admin, err := q.WithPrincipal(&auth.Principal{Name: "root", Roles: []string{AdminRole}}).restrict("SCAN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if admin.guard != nil {
+		t.Error("restrict for an admin set a guard")
+	}
+}
+
+func TestGuardedScans(t *testing.T) {
+	q := newACLQuery(t, ACLUser{Name: "reader", Rules: []ACLRule{
+		{Commands: []string{"@read"}, Keys: []string{"pub:*"}},
+		{Commands: []string{"@read"}, Keys: []string{"pub:secret*"}, Deny: true},
+	}})
+	for _, key := range []string{"pub:1", "pub:2", "pub:secret", "priv:1"} {
+		if err := q.Set(key, 1.0, 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	reader := q.WithPrincipal(&auth.Principal{Name: "reader"})
+	want := []string{"pub:1", "pub:2"}
+
+	t.Run("SCAN", func(t *testing.T) {
+		result, err := reader.Execute("SCAN p")
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for key := range result.(map[string]interface{}) {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		assertKeys(t, keys, want)
+	})
+
+	t.Run("ScanMatch", func(t *testing.T) {
+		m, err := CompileGlob("*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, err := reader.ScanMatch("", m, "", 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var keys []string
+		for _, e := range page.Entries {
+			keys = append(keys, e.Key)
+		}
+		assertKeys(t, keys, want)
+	})
+
+	t.Run("KEYS", func(t *testing.T) {
+		m, err := CompileGlob("*")
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys, err := reader.Keys(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertKeys(t, keys, want)
+	})
+
+	t.Run("COUNT", func(t *testing.T) {
+		result, err := reader.Execute("COUNT pub")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != 2 {
+			t.Errorf("COUNT pub = %v, want 2", result)
+		}
+	})
+
+	t.Run("GET hidden key", func(t *testing.T) {
+		if _, err := reader.Get("pub:secret"); !errors.Is(err, ErrPermissionDenied) {
+			t.Errorf("GET pub:secret = %v, want ErrPermissionDenied", err)
+		}
+	})
+}
+
+func assertKeys(t *testing.T, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("keys = %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("keys = %v, want %v", got, want)
+		}
+	}
+}
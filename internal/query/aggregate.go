@@ -0,0 +1,145 @@
+package query
+
+import "sort"
+
+// Group is one bucket of a GROUP BY aggregation.
+type Group struct {
+	Group interface{} `json:"group"`
+	Value interface{} `json:"value"`
+}
+
+type aggregateStmt struct {
+	filter
+	fn      string
+	field   *Path
+	groupBy *Path
+}
+
+// parseAggregate parses
+//
+//	COUNT <prefix> [MATCH <glob> | REGEX <re>] [WHERE <expr>] [GROUP BY <path>]
+//	SUM|AVG|MIN|MAX <prefix> <path> [MATCH <glob> | REGEX <re>] [WHERE <expr>] [GROUP BY <path>]
+func parseAggregate(fn string, p *parser) (*aggregateStmt, error) {
+	stmt := &aggregateStmt{fn: fn}
+	prefix, err := p.rawArgument("prefix")
+	if err != nil {
+		return nil, err
+	}
+	stmt.prefix = prefix
+	if fn != "COUNT" {
+		if stmt.field, err = p.path(); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseFilterClauses(p, &stmt.filter); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("GROUP") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.groupBy, err = p.path(); err != nil {
+			return nil, err
+		}
+	}
+	return stmt, p.expectEOF()
+}
+
+type accumulator struct {
+	count int
+	n     int
+	sum   float64
+	min   float64
+	max   float64
+}
+
+func (a *accumulator) add(v interface{}, numeric bool) {
+	a.count++
+	if !numeric {
+		return
+	}
+	f, ok := toFloat(v)
+	if !ok {
+		return
+	}
+	if a.n == 0 || f < a.min {
+		a.min = f
+	}
+	if a.n == 0 || f > a.max {
+		a.max = f
+	}
+	a.n++
+	a.sum += f
+}
+
+func (a *accumulator) result(fn string) interface{} {
+	switch fn {
+	case "COUNT":
+		return a.count
+	case "SUM":
+		return a.sum
+	}
+	if a.n == 0 {
+		return nil
+	}
+	switch fn {
+	case "AVG":
+		return a.sum / float64(a.n)
+	case "MIN":
+		return a.min
+	}
+	return a.max
+}
+
+// executeAggregate folds matching entries as they are visited rather than
+// collecting them first. Only numeric values contribute to SUM, AVG, MIN and
+// MAX; COUNT counts every matching key.
+func (q *Query) executeAggregate(stmt *aggregateStmt) (interface{}, error) {
+	numeric := stmt.fn != "COUNT"
+	if stmt.groupBy == nil {
+		acc := &accumulator{}
+		q.each(stmt.filter, func(row scanRow) bool {
+			var v interface{}
+			if numeric {
+				v, _ = stmt.field.Lookup(row.document())
+			}
+			acc.add(v, numeric)
+			return true
+		})
+		return acc.result(stmt.fn), nil
+	}
+
+	type bucket struct {
+		group interface{}
+		acc   accumulator
+	}
+	buckets := make(map[string]*bucket)
+	q.each(stmt.filter, func(row scanRow) bool {
+		doc := row.document()
+		group, _ := stmt.groupBy.Lookup(doc)
+		term, ok := indexTerm(group)
+		if !ok {
+			return true
+		}
+		b, ok := buckets[term]
+		if !ok {
+			b = &bucket{group: group}
+			buckets[term] = b
+		}
+		var v interface{}
+		if numeric {
+			v, _ = stmt.field.Lookup(doc)
+		}
+		b.acc.add(v, numeric)
+		return true
+	})
+
+	groups := make([]Group, 0, len(buckets))
+	for _, b := range buckets {
+		groups = append(groups, Group{Group: b.group, Value: b.acc.result(stmt.fn)})
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return orderValues(groups[i].Group, groups[j].Group) < 0
+	})
+	return groups, nil
+}
@@ -0,0 +1,362 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// AsyncThreshold is the number of keys above which a bulk operation runs in
+// the background and returns a Job instead of waiting for completion.
+const AsyncThreshold = 10000
+
+const maxFinishedJobs = 100
+
+var ErrJobNotFound = errors.New("job not found")
+
+const (
+	JobRunning = "running"
+	JobDone    = "done"
+)
+
+// Job reports the progress of a background bulk operation.
+type Job struct {
+	ID         string     `json:"id"`
+	Op         string     `json:"op"`
+	Status     string     `json:"status"`
+	Total      int64      `json:"total"`
+	Done       int64      `json:"done"`
+	Affected   int64      `json:"affected"`
+	StartedAt  time.Time  `json:"started_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+type job struct {
+	id        string
+	op        string
+	total     int64
+	done      atomic.Int64
+	affected  atomic.Int64
+	startedAt time.Time
+	finished  atomic.Pointer[time.Time]
+}
+
+func (j *job) snapshot() Job {
+	snap := Job{
+		ID:        j.id,
+		Op:        j.op,
+		Status:    JobRunning,
+		Total:     j.total,
+		Done:      j.done.Load(),
+		Affected:  j.affected.Load(),
+		StartedAt: j.startedAt,
+	}
+	if t := j.finished.Load(); t != nil {
+		snap.Status = JobDone
+		snap.FinishedAt = t
+	}
+	return snap
+}
+
+type jobs struct {
+	mu     sync.Mutex
+	nextID int64
+	byID   map[string]*job
+	order  []string
+}
+
+func newJobs() *jobs {
+	return &jobs{byID: make(map[string]*job)}
+}
+
+func (js *jobs) register(j *job) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	js.nextID++
+	j.id = fmt.Sprintf("job-%d", js.nextID)
+	js.byID[j.id] = j
+	js.order = append(js.order, j.id)
+
+	// Forget the oldest finished jobs once there are too many. Running
+	// jobs are kept however old they are.
+	excess := -maxFinishedJobs
+	for _, id := range js.order {
+		if js.byID[id].finished.Load() != nil {
+			excess++
+		}
+	}
+	if excess <= 0 {
+		return
+	}
+	kept := js.order[:0]
+	for _, id := range js.order {
+		if excess > 0 && js.byID[id].finished.Load() != nil {
+			delete(js.byID, id)
+			excess--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	js.order = kept
+}
+
+func (js *jobs) get(id string) (Job, bool) {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	j, ok := js.byID[id]
+	if !ok {
+		return Job{}, false
+	}
+	return j.snapshot(), true
+}
+
+func (js *jobs) list() []Job {
+	js.mu.Lock()
+	defer js.mu.Unlock()
+
+	result := make([]Job, 0, len(js.order))
+	for _, id := range js.order {
+		result = append(result, js.byID[id].snapshot())
+	}
+	return result
+}
+
+func (q *Query) Job(id string) (Job, error) {
+	if err := q.authorize("JOB"); err != nil {
+		return Job{}, err
+	}
+	j, ok := q.jobs.get(id)
+	if !ok {
+		return Job{}, ErrJobNotFound
+	}
+	return j, nil
+}
+
+func (q *Query) Jobs() ([]Job, error) {
+	if err := q.authorize("JOBS"); err != nil {
+		return nil, err
+	}
+	return q.jobs.list(), nil
+}
+
+// runBulk applies step to each key, one atomic store operation at a time.
+// Small batches run inline and return the number of keys affected; large
+// ones, or any when async is set, run in the background and return a Job.
+func (q *Query) runBulk(op string, keys []string, async bool, step func(key string) bool) interface{} {
+	j := &job{op: op, total: int64(len(keys)), startedAt: time.Now()}
+	run := func() {
+		for _, key := range keys {
+			if step(key) {
+				j.affected.Add(1)
+			}
+			j.done.Add(1)
+		}
+		now := time.Now()
+		j.finished.Store(&now)
+	}
+	if !async && len(keys) <= AsyncThreshold {
+		run()
+		return j.affected.Load()
+	}
+	q.jobs.register(j)
+	go run()
+	return j.snapshot()
+}
+
+func (q *Query) collectKeys(f filter) []string {
+	var keys []string
+	q.each(f, func(row scanRow) bool {
+		keys = append(keys, row.key)
+		return true
+	})
+	return keys
+}
+
+// The bulk operations only touch keys the ACL lets q's principal run the
+// command on; others are left alone rather than failing the whole batch.
+
+func (q *Query) DeletePrefix(prefix string, async bool) (interface{}, error) {
+	q, err := q.restrict("DELPREFIX")
+	if err != nil {
+		return nil, err
+	}
+	keys := q.collectKeys(filter{prefix: prefix})
+	return q.runBulk("DELPREFIX", keys, async, q.deleteStep), nil
+}
+
+func (q *Query) DeleteMatch(m *Matcher, async bool) (interface{}, error) {
+	q, err := q.restrict("DELMATCH")
+	if err != nil {
+		return nil, err
+	}
+	keys := q.collectKeys(filter{match: m})
+	return q.runBulk("DELMATCH", keys, async, q.deleteStep), nil
+}
+
+// deleteStep deletes key and reports whether it was still there, as it
+// may have been deleted or expired since the keys were collected.
+func (q *Query) deleteStep(key string) bool {
+	return q.store.DeleteIf(key, func(_ store.Value, exists bool) error {
+		if !exists {
+			return ErrNotFound
+		}
+		return nil
+	}) == nil
+}
+
+func (q *Query) ExpirePrefix(prefix string, ttl time.Duration, async bool) (interface{}, error) {
+	q, err := q.restrict("EXPIREPREFIX")
+	if err != nil {
+		return nil, err
+	}
+	keys := q.collectKeys(filter{prefix: prefix})
+	return q.runBulk("EXPIREPREFIX", keys, async, func(key string) bool {
+		return q.store.Expire(key, ttl)
+	}), nil
+}
+
+// RenamePrefix moves every key under from to the same suffix under to. Keys
+// are collected up front, so overlapping prefixes do not loop.
+func (q *Query) RenamePrefix(from, to string, async bool) (interface{}, error) {
+	q, err := q.restrict("RENAMEPREFIX")
+	if err != nil {
+		return nil, err
+	}
+	keys := q.collectKeys(filter{prefix: from})
+	return q.runBulk("RENAMEPREFIX", keys, async, func(key string) bool {
+		dst := to + strings.TrimPrefix(key, from)
+		return q.permits(dst) && q.checkKey(dst) == nil && q.store.Rename(key, dst) == nil
+	}), nil
+}
+
+// executeBulk handles the bulk and single-key move commands:
+//
+//	DELPREFIX <prefix> [ASYNC]
+//	DELMATCH <glob> | REGEX <re> [ASYNC]
+//	EXPIRE <key> <ttl>
+//	EXPIREPREFIX <prefix> <ttl> [ASYNC]
+//	RENAME <src> <dst>
+//	COPY <src> <dst> [REPLACE]
+//	RENAMEPREFIX <from> <to> [ASYNC]
+//	JOB <id>
+//	JOBS
+func (q *Query) executeBulk(command string, p *parser) (interface{}, error) {
+	switch command {
+	case "DELPREFIX":
+		prefix, err := p.rawArgument("prefix")
+		if err != nil {
+			return nil, err
+		}
+		async := p.acceptKeyword("ASYNC")
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.DeletePrefix(prefix, async)
+	case "DELMATCH":
+		compile := CompileGlob
+		if p.acceptKeyword("REGEX") {
+			compile = CompileRegex
+		}
+		m, err := p.pattern(compile)
+		if err != nil {
+			return nil, err
+		}
+		async := p.acceptKeyword("ASYNC")
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.DeleteMatch(m, async)
+	case "EXPIRE", "EXPIREPREFIX":
+		var target string
+		var err error
+		if command == "EXPIRE" {
+			target, err = p.argument("key")
+		} else {
+			target, err = p.rawArgument("prefix")
+		}
+		if err != nil {
+			return nil, err
+		}
+		ttl, err := p.duration()
+		if err != nil {
+			return nil, err
+		}
+		if command == "EXPIRE" {
+			if err := p.expectEOF(); err != nil {
+				return nil, err
+			}
+			return q.expire(target, ttl)
+		}
+		async := p.acceptKeyword("ASYNC")
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.ExpirePrefix(target, ttl, async)
+	case "RENAME", "COPY", "RENAMEPREFIX":
+		// Prefixes are read verbatim, as SCAN reads its prefix.
+		argument := p.argument
+		if command == "RENAMEPREFIX" {
+			argument = p.rawArgument
+		}
+		src, err := argument("source")
+		if err != nil {
+			return nil, err
+		}
+		dst, err := argument("destination")
+		if err != nil {
+			return nil, err
+		}
+		switch command {
+		case "RENAME":
+			if err := p.expectEOF(); err != nil {
+				return nil, err
+			}
+			if err := q.authorize(command, src, dst); err != nil {
+				return nil, err
+			}
+			if err := q.checkKey(dst); err != nil {
+				return nil, err
+			}
+			return nil, q.store.Rename(src, dst)
+		case "COPY":
+			replace := p.acceptKeyword("REPLACE")
+			if err := p.expectEOF(); err != nil {
+				return nil, err
+			}
+			if err := q.authorize(command, src, dst); err != nil {
+				return nil, err
+			}
+			if err := q.checkKey(dst); err != nil {
+				return nil, err
+			}
+			return nil, q.store.Copy(src, dst, replace)
+		}
+		async := p.acceptKeyword("ASYNC")
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.RenamePrefix(src, dst, async)
+	case "JOB":
+		id, err := p.argument("job id")
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.Job(id)
+	case "JOBS":
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.Jobs()
+	}
+	return nil, ErrUnknownCommand
+}
@@ -0,0 +1,51 @@
+package query
+
+import (
+	"testing"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+func TestJobRetention(t *testing.T) {
+	js := newJobs()
+	running := &job{op: "DELPREFIX"}
+	js.register(running)
+	for i := 0; i < maxFinishedJobs+10; i++ {
+		j := &job{op: "DELPREFIX"}
+		now := time.Now()
+		j.finished.Store(&now)
+		js.register(j)
+	}
+
+	// The running job is kept, and the finished ones registered after it
+	// are pruned down to the limit.
+	if n := len(js.list()); n != maxFinishedJobs+1 {
+		t.Errorf("%d jobs kept, want %d", n, maxFinishedJobs+1)
+	}
+	if _, ok := js.get(running.id); !ok {
+		t.Error("running job pruned")
+	}
+	if _, ok := js.get("job-2"); ok {
+		t.Error("oldest finished job kept")
+	}
+	if len(js.byID) != len(js.order) {
+		t.Errorf("%d jobs indexed, %d listed", len(js.byID), len(js.order))
+	}
+}
+
+func TestBulkDeleteCountsRemovedKeys(t *testing.T) {
+	dbs := store.NewDatabases(0, 0)
+	dbs.Default().Set("a:1", 1.0, 0)
+	dbs.Default().Set("a:2", 1.0, 0)
+	q := New(dbs)
+
+	// a:gone was deleted after the keys were collected.
+	affected := q.runBulk("DELPREFIX", []string{"a:1", "a:gone", "a:2"}, false, q.deleteStep)
+	if affected != int64(2) {
+		t.Errorf("affected = %v, want 2", affected)
+	}
+	if n := dbs.Default().Stats().Keys; n != 0 {
+		t.Errorf("%d keys left", n)
+	}
+}
@@ -0,0 +1,62 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+var (
+	// ErrParse is matched by every malformed query, including *SyntaxError.
+	ErrParse          = errors.New("parse error")
+	ErrUnknownCommand = errors.New("unknown command")
+	ErrIndexNotFound  = errors.New("index not found")
+	ErrNotFound       = store.ErrNotFound
+	ErrWrongType      = store.ErrWrongType
+	ErrConflict       = store.ErrConflict
+)
+
+// Error codes identify a failure independently of the protocol carrying it.
+const (
+	CodeParse            = "PARSE_ERROR"
+	CodeUnknownCommand   = "UNKNOWN_COMMAND"
+	CodeInvalidArgument  = "INVALID_ARGUMENT"
+	CodeNotFound         = "NOT_FOUND"
+	CodeWrongType        = "WRONG_TYPE"
+	CodeConflict         = "CONFLICT"
+	CodePermissionDenied = "PERMISSION_DENIED"
+	CodeTooLarge         = "TOO_LARGE"
+	CodeInternal         = "INTERNAL"
+)
+
+func (e *SyntaxError) Is(target error) bool {
+	return target == ErrParse
+}
+
+func parseErrorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s", ErrParse, fmt.Sprintf(format, args...))
+}
+
+// ErrorCode classifies err into one of the Code constants.
+func ErrorCode(err error) string {
+	switch {
+	case errors.Is(err, ErrParse):
+		return CodeParse
+	case errors.Is(err, ErrUnknownCommand):
+		return CodeUnknownCommand
+	case errors.Is(err, ErrInvalidCursor), errors.Is(err, store.ErrInvalidDBName):
+		return CodeInvalidArgument
+	case errors.Is(err, ErrNotFound), errors.Is(err, ErrIndexNotFound), errors.Is(err, ErrJobNotFound), errors.Is(err, ErrACLUserNotFound):
+		return CodeNotFound
+	case errors.Is(err, ErrWrongType):
+		return CodeWrongType
+	case errors.Is(err, ErrConflict), errors.Is(err, store.ErrTooManyDBs), errors.Is(err, ErrACLDisabled):
+		return CodeConflict
+	case errors.Is(err, ErrPermissionDenied):
+		return CodePermissionDenied
+	case errors.Is(err, ErrTooLarge):
+		return CodeTooLarge
+	}
+	return CodeInternal
+}
@@ -0,0 +1,172 @@
+package query
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Expr interface {
+	Eval(doc interface{}) bool
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e *andExpr) Eval(doc interface{}) bool { return e.left.Eval(doc) && e.right.Eval(doc) }
+
+type orExpr struct{ left, right Expr }
+
+func (e *orExpr) Eval(doc interface{}) bool { return e.left.Eval(doc) || e.right.Eval(doc) }
+
+type notExpr struct{ inner Expr }
+
+func (e *notExpr) Eval(doc interface{}) bool { return !e.inner.Eval(doc) }
+
+type compareExpr struct {
+	path  *Path
+	op    string
+	value interface{}
+}
+
+func (e *compareExpr) Eval(doc interface{}) bool {
+	actual, ok := e.path.Lookup(doc)
+	if !ok {
+		actual = nil
+	}
+	cmp, comparable := compareValues(actual, e.value)
+	switch e.op {
+	case "=":
+		return comparable && cmp == 0
+	case "!=":
+		return !comparable || cmp != 0
+	case "<":
+		return comparable && cmp < 0
+	case "<=":
+		return comparable && cmp <= 0
+	case ">":
+		return comparable && cmp > 0
+	case ">=":
+		return comparable && cmp >= 0
+	}
+	return false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case float32:
+		return float64(n), true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case uint64:
+		return float64(n), true
+	case uint32:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+// compareValues orders two JSON scalars. Values of different types are not
+// comparable, so "age > 30" never matches a string age.
+func compareValues(a, b interface{}) (int, bool) {
+	if a == nil || b == nil {
+		if a == nil && b == nil {
+			return 0, true
+		}
+		return 0, false
+	}
+	if af, ok := toFloat(a); ok {
+		bf, ok := toFloat(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case af < bf:
+			return -1, true
+		case af > bf:
+			return 1, true
+		}
+		return 0, true
+	}
+	switch av := a.(type) {
+	case string:
+		bv, ok := b.(string)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av < bv:
+			return -1, true
+		case av > bv:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		bv, ok := b.(bool)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case av == bv:
+			return 0, true
+		case !av:
+			return -1, true
+		}
+		return 1, true
+	}
+	return 0, false
+}
+
+func typeRank(v interface{}) int {
+	if v == nil {
+		return 0
+	}
+	if _, ok := toFloat(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case bool:
+		return 1
+	case string:
+		return 3
+	}
+	return 4
+}
+
+// orderValues is a total order used by ORDER BY: null < bool < number <
+// string < everything else, and values of the same type compare naturally.
+func orderValues(a, b interface{}) int {
+	if cmp, ok := compareValues(a, b); ok {
+		return cmp
+	}
+	ra, rb := typeRank(a), typeRank(b)
+	switch {
+	case ra < rb:
+		return -1
+	case ra > rb:
+		return 1
+	}
+	return 0
+}
+
+// indexTerm encodes a scalar so that values equal under compareValues map to
+// the same secondary index term.
+func indexTerm(v interface{}) (string, bool) {
+	if v == nil {
+		return "z", true
+	}
+	if f, ok := toFloat(v); ok {
+		return "n:" + strconv.FormatFloat(f, 'g', -1, 64), true
+	}
+	switch t := v.(type) {
+	case string:
+		return "s:" + t, true
+	case bool:
+		return fmt.Sprintf("b:%t", t), true
+	}
+	return "", false
+}
@@ -0,0 +1,94 @@
+package query
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/version"
+)
+
+// infoSections holds the INFO sections contributed by other components,
+// such as persistence and the protocol servers.
+type infoSections struct {
+	started time.Time
+
+	mu       sync.RWMutex
+	names    []string
+	sections map[string]func() interface{}
+}
+
+func newInfoSections() *infoSections {
+	return &infoSections{started: time.Now(), sections: make(map[string]func() interface{})}
+}
+
+// AddInfoSection adds a section to the output of INFO. fn is called on
+// every INFO and must be safe for concurrent use.
+func (q *Query) AddInfoSection(name string, fn func() interface{}) {
+	q.info.mu.Lock()
+	defer q.info.mu.Unlock()
+
+	if _, exists := q.info.sections[name]; !exists {
+		q.info.names = append(q.info.names, name)
+	}
+	q.info.sections[name] = fn
+}
+
+// ServerInfo is the "server" section of INFO.
+type ServerInfo struct {
+	Version       string    `json:"version"`
+	GoVersion     string    `json:"go_version"`
+	StartedAt     time.Time `json:"started_at"`
+	UptimeSeconds int64     `json:"uptime_seconds"`
+}
+
+// MemoryInfo is the "memory" section of INFO. DataBytes is the store's own
+// estimate; the rest come from the Go runtime.
+type MemoryInfo struct {
+	DataBytes  int64  `json:"data_bytes"`
+	HeapAlloc  uint64 `json:"heap_alloc_bytes"`
+	HeapInuse  uint64 `json:"heap_inuse_bytes"`
+	Sys        uint64 `json:"sys_bytes"`
+	NumGC      uint32 `json:"num_gc"`
+	Goroutines int    `json:"goroutines"`
+}
+
+// Info reports the state of the server, one section per component: server,
+// keyspace (per database), memory, and any added with AddInfoSection.
+func (q *Query) Info() (map[string]interface{}, error) {
+	if err := q.authorize("INFO"); err != nil {
+		return nil, err
+	}
+	keyspace := q.dbs.Stats()
+	var dataBytes int64
+	for _, st := range keyspace {
+		dataBytes += st.Bytes
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	info := map[string]interface{}{
+		"server": ServerInfo{
+			Version:       version.Version,
+			GoVersion:     runtime.Version(),
+			StartedAt:     q.info.started,
+			UptimeSeconds: int64(time.Since(q.info.started).Seconds()),
+		},
+		"keyspace": keyspace,
+		"memory": MemoryInfo{
+			DataBytes:  dataBytes,
+			HeapAlloc:  ms.HeapAlloc,
+			HeapInuse:  ms.HeapInuse,
+			Sys:        ms.Sys,
+			NumGC:      ms.NumGC,
+			Goroutines: runtime.NumGoroutine(),
+		},
+	}
+
+	q.info.mu.RLock()
+	defer q.info.mu.RUnlock()
+	for _, name := range q.info.names {
+		info[name] = q.info.sections[name]()
+	}
+	return info, nil
+}
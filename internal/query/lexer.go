@@ -0,0 +1,99 @@
+package query
+
+import (
+	"fmt"
+	"strings"
+)
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokWord
+	tokString
+	tokOp
+	tokError
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	pos  int
+}
+
+// SyntaxError reports a malformed query together with the byte offset at
+// which the problem was found.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+func isOpChar(c byte) bool {
+	return c == '=' || c == '!' || c == '<' || c == '>' || c == '(' || c == ')'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r'
+}
+
+// scanToken reads the token starting at or after off and returns it with the
+// offset just past it. Malformed input yields a tokError token whose text is
+// the problem.
+func scanToken(input string, off int) (token, int) {
+	i := off
+	for i < len(input) && isSpace(input[i]) {
+		i++
+	}
+	if i >= len(input) {
+		return token{kind: tokEOF, pos: len(input)}, len(input)
+	}
+	c := input[i]
+	start := i
+	switch {
+	case c == '"' || c == '\'':
+		var sb strings.Builder
+		i++
+		for {
+			if i >= len(input) {
+				return token{kind: tokError, text: "unterminated string", pos: start}, len(input)
+			}
+			if input[i] == '\\' && i+1 < len(input) {
+				sb.WriteByte(input[i+1])
+				i += 2
+				continue
+			}
+			if input[i] == c {
+				i++
+				break
+			}
+			sb.WriteByte(input[i])
+			i++
+		}
+		return token{kind: tokString, text: sb.String(), pos: start}, i
+	case isOpChar(c):
+		op := string(c)
+		if i+1 < len(input) && input[i+1] == '=' && (c == '!' || c == '<' || c == '>') {
+			op += "="
+		}
+		return token{kind: tokOp, text: op, pos: start}, i + len(op)
+	}
+	for i < len(input) && !isSpace(input[i]) && !isOpChar(input[i]) && input[i] != '"' && input[i] != '\'' {
+		i++
+	}
+	return token{kind: tokWord, text: input[start:i], pos: start}, i
+}
+
+// scanRaw reads the whitespace-delimited run of input starting at off
+// verbatim, for arguments such as patterns that may contain operator or
+// quote characters.
+func scanRaw(input string, off int) (token, int) {
+	i := off
+	for i < len(input) && !isSpace(input[i]) {
+		i++
+	}
+	return token{kind: tokWord, text: input[off:i], pos: off}, i
+}
@@ -0,0 +1,52 @@
+package query
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// ErrTooLarge is returned for keys and values over the configured limits.
+var ErrTooLarge = errors.New("too large")
+
+// Limits bounds what may be stored. Zero means no limit.
+type Limits struct {
+	// MaxKeySize is in bytes.
+	MaxKeySize int
+	// MaxValueSize is the size reported by store.ValueSize.
+	MaxValueSize int64
+}
+
+// limits is shared by every Query derived from the one created by New.
+type limits struct {
+	key   atomic.Int64
+	value atomic.Int64
+}
+
+// SetLimits replaces the limits, for writes from now on.
+func (q *Query) SetLimits(l Limits) {
+	q.limits.key.Store(int64(l.MaxKeySize))
+	q.limits.value.Store(l.MaxValueSize)
+}
+
+func (q *Query) Limits() Limits {
+	return Limits{MaxKeySize: int(q.limits.key.Load()), MaxValueSize: q.limits.value.Load()}
+}
+
+func (q *Query) checkKey(key string) error {
+	if max := q.limits.key.Load(); max > 0 && int64(len(key)) > max {
+		return fmt.Errorf("%w: key is %d bytes, the limit is %d", ErrTooLarge, len(key), max)
+	}
+	return nil
+}
+
+func (q *Query) checkValue(data interface{}) error {
+	if max := q.limits.value.Load(); max > 0 {
+		if size := store.ValueSize(data); size > max {
+			return fmt.Errorf("%w: value is %d bytes, the limit is %d", ErrTooLarge, size, max)
+		}
+	}
+	return nil
+}
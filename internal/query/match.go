@@ -0,0 +1,164 @@
+package query
+
+import (
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+// Matcher tests keys against a glob or RE2 pattern. Both kinds must match
+// the whole key. Prefix is the literal text every matching key starts with,
+// which lets callers walk only that part of the ordered key index.
+type Matcher struct {
+	pattern string
+	re      *regexp.Regexp
+	prefix  string
+}
+
+// CompileGlob compiles a glob pattern. '*' matches any run of characters
+// (including ':'), '?' matches one character, [abc], [a-z] and [!a] match
+// character classes, and '\' escapes the next character.
+func CompileGlob(pattern string) (*Matcher, error) {
+	var sb strings.Builder
+	var prefix strings.Builder
+	literal := true
+	sb.WriteString(`^`)
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			literal = false
+			sb.WriteString(`.*`)
+		case '?':
+			literal = false
+			sb.WriteString(`.`)
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				return nil, &SyntaxError{Pos: i, Msg: "unterminated '[' in pattern"}
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			literal = false
+			sb.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				c = pattern[i]
+			}
+			fallthrough
+		default:
+			if literal {
+				prefix.WriteByte(c)
+			}
+			sb.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	sb.WriteString(`$`)
+	re, err := regexp.Compile(sb.String())
+	if err != nil {
+		return nil, &SyntaxError{Msg: "invalid pattern: " + err.Error()}
+	}
+	return &Matcher{pattern: pattern, re: re, prefix: prefix.String()}, nil
+}
+
+// CompileRegex compiles an RE2 expression that must match the whole key.
+func CompileRegex(pattern string) (*Matcher, error) {
+	anchored := `^(?:` + pattern + `)$`
+	re, err := regexp.Compile(anchored)
+	if err != nil {
+		return nil, &SyntaxError{Msg: "invalid regex: " + err.Error()}
+	}
+	return &Matcher{pattern: pattern, re: re, prefix: regexPrefix(anchored)}, nil
+}
+
+func regexPrefix(expr string) string {
+	parsed, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		return ""
+	}
+	var sb strings.Builder
+	var walk func(re *syntax.Regexp) bool
+	walk = func(re *syntax.Regexp) bool {
+		switch re.Op {
+		case syntax.OpBeginText, syntax.OpEmptyMatch:
+			return true
+		case syntax.OpLiteral:
+			if re.Flags&syntax.FoldCase != 0 {
+				return false
+			}
+			sb.WriteString(string(re.Rune))
+			return true
+		case syntax.OpCapture:
+			return walk(re.Sub[0])
+		case syntax.OpConcat:
+			for _, sub := range re.Sub {
+				if !walk(sub) {
+					return false
+				}
+			}
+			return true
+		}
+		return false
+	}
+	walk(parsed.Simplify())
+	return sb.String()
+}
+
+func (m *Matcher) Match(key string) bool {
+	return m.re.MatchString(key)
+}
+
+func (m *Matcher) Prefix() string {
+	return m.prefix
+}
+
+func (m *Matcher) String() string {
+	return m.pattern
+}
+
+// narrowPrefix combines an explicit prefix with a matcher's literal prefix.
+// It reports false when no key can satisfy both.
+func narrowPrefix(prefix string, m *Matcher) (string, bool) {
+	if m == nil {
+		return prefix, true
+	}
+	switch {
+	case strings.HasPrefix(m.prefix, prefix):
+		return m.prefix, true
+	case strings.HasPrefix(prefix, m.prefix):
+		return prefix, true
+	}
+	return "", false
+}
+
+// parseKeyPattern parses the argument of KEYS: either a glob or
+// REGEX <re>.
+func parseKeyPattern(p *parser) (*Matcher, error) {
+	compile := CompileGlob
+	if p.acceptKeyword("REGEX") {
+		compile = CompileRegex
+	}
+	m, err := p.pattern(compile)
+	if err != nil {
+		return nil, err
+	}
+	return m, p.expectEOF()
+}
+
+// Keys lists, in order, every live key matching m.
+func (q *Query) Keys(m *Matcher) ([]string, error) {
+	q, err := q.restrict("KEYS")
+	if err != nil {
+		return nil, err
+	}
+	keys := []string{}
+	q.each(filter{match: m}, func(row scanRow) bool {
+		keys = append(keys, row.key)
+		return true
+	})
+	return keys, nil
+}
@@ -0,0 +1,13 @@
+package query
+
+import "github.com/umgbhalla/gokv/internal/metrics"
+
+var (
+	commandsTotal = metrics.Default.NewCounterVec("gokv_query_commands_total",
+		"Commands run by the query engine, by command and result code.", "command", "code")
+	commandDuration = metrics.Default.NewHistogramVec("gokv_query_command_duration_seconds",
+		"Time spent running commands in the query engine.", nil, "command")
+)
+
+// codeOK is the result code of commands that succeed.
+const codeOK = "OK"
@@ -0,0 +1,140 @@
+package query
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/metrics"
+)
+
+// monitorBuffer is the number of events queued for each MONITOR subscriber.
+// Events for a subscriber that falls further behind are dropped.
+const monitorBuffer = 256
+
+var monitorDropped = metrics.Default.NewCounter("gokv_monitor_dropped_events_total",
+	"MONITOR events dropped because a subscriber fell behind.")
+
+// MonitorEvent describes one command as it completes.
+type MonitorEvent struct {
+	Time       time.Time `json:"time"`
+	DurationUS int64     `json:"duration_us"`
+	DB         string    `json:"db"`
+	Client     string    `json:"client,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Command    string    `json:"command"`
+	Args       []string  `json:"args,omitempty"`
+	Code       string    `json:"code"`
+}
+
+// tracer holds the slowlog and MONITOR subscribers, shared by every Query
+// derived from the same New.
+type tracer struct {
+	slowlog *slowlog
+
+	mu     sync.RWMutex
+	redact []string
+	subs   map[*monitorSub]struct{}
+	active atomic.Int32
+}
+
+type monitorSub struct {
+	events chan MonitorEvent
+}
+
+func newTracer() *tracer {
+	return &tracer{
+		slowlog: newSlowlog(DefaultSlowlogThreshold, DefaultSlowlogMaxLen),
+		subs:    make(map[*monitorSub]struct{}),
+	}
+}
+
+func (t *tracer) publish(e MonitorEvent) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	for sub := range t.subs {
+		select {
+		case sub.events <- e:
+		default:
+			monitorDropped.Inc()
+		}
+	}
+}
+
+// Monitor streams every command run through any Query sharing q's tracer
+// until stop is called. The channel is closed by stop.
+func (q *Query) Monitor() (events <-chan MonitorEvent, stop func(), err error) {
+	if err := q.authorize("MONITOR"); err != nil {
+		return nil, nil, err
+	}
+	t := q.trace
+	sub := &monitorSub{events: make(chan MonitorEvent, monitorBuffer)}
+	t.mu.Lock()
+	t.subs[sub] = struct{}{}
+	t.active.Add(1)
+	t.mu.Unlock()
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			t.mu.Lock()
+			delete(t.subs, sub)
+			t.active.Add(-1)
+			t.mu.Unlock()
+			close(sub.events)
+		})
+	}
+	return sub.events, stop, nil
+}
+
+// WithClient returns a Query whose commands are attributed to client, such
+// as a remote address, in the slowlog and MONITOR.
+func (q *Query) WithClient(client string) *Query {
+	r := *q
+	r.client = client
+	return &r
+}
+
+// observe records one run of command with args that started at start, in
+// the metrics, the slowlog and the MONITOR stream. Unknown commands are
+// grouped together to bound the number of series.
+func (q *Query) observe(command string, args []string, start time.Time, err error) {
+	d := time.Since(start)
+	if _, known := commandCategories[command]; !known && command != "SELECT" {
+		command = "UNKNOWN"
+	}
+	code := codeOK
+	if err != nil {
+		code = ErrorCode(err)
+	}
+	commandsTotal.With(command, code).Inc()
+	commandDuration.With(command).Observe(d.Seconds())
+
+	t := q.trace
+	t.slowlog.mu.Lock()
+	slow := t.slowlog.threshold >= 0 && d >= t.slowlog.threshold
+	t.slowlog.mu.Unlock()
+	monitored := t.active.Load() > 0
+	if !slow && !monitored {
+		return
+	}
+
+	user := ""
+	if q.principal != nil {
+		user = q.principal.Name
+	}
+	logged := t.loggedArgs(args)
+	if slow {
+		t.slowlog.add(SlowlogEntry{
+			Time: start, DurationUS: d.Microseconds(), DB: q.db,
+			Client: q.client, User: user, Command: command, Args: logged,
+		}, d)
+	}
+	if monitored {
+		t.publish(MonitorEvent{
+			Time: start, DurationUS: d.Microseconds(), DB: q.db,
+			Client: q.client, User: user, Command: command, Args: logged, Code: code,
+		})
+	}
+}
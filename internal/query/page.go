@@ -0,0 +1,86 @@
+package query
+
+import (
+	"encoding/base64"
+	"errors"
+)
+
+const (
+	DefaultPageSize = 100
+	MaxPageSize     = 10000
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Page is one batch of a cursor-based scan. An empty Cursor means the scan
+// is complete; otherwise pass it back to fetch the next page.
+type Page struct {
+	Cursor  string  `json:"cursor"`
+	Entries []Entry `json:"entries"`
+}
+
+// Scan returns up to count entries under prefix that come after cursor in
+// key order. Keys present for the whole iteration are returned exactly once;
+// keys written or deleted while it is in progress may or may not appear.
+func (q *Query) Scan(prefix, cursor string, count int) (*Page, error) {
+	return q.ScanMatch(prefix, nil, cursor, count)
+}
+
+// ScanMatch is like Scan but only returns keys under prefix that also match
+// m.
+func (q *Query) ScanMatch(prefix string, m *Matcher, cursor string, count int) (*Page, error) {
+	q, err := q.restrict("SCAN")
+	if err != nil {
+		return nil, err
+	}
+	return q.scanPage(filter{prefix: prefix, match: m}, cursor, count)
+}
+
+func (q *Query) scanPage(f filter, cursor string, count int) (*Page, error) {
+	after, err := decodeCursor(cursor)
+	if err != nil {
+		return nil, err
+	}
+	if count <= 0 {
+		count = DefaultPageSize
+	}
+	if count > MaxPageSize {
+		count = MaxPageSize
+	}
+
+	page := &Page{Entries: make([]Entry, 0, count)}
+	prefix, ok := narrowPrefix(f.prefix, f.match)
+	if !ok {
+		return page, nil
+	}
+	visit := q.visitor(f, func(row scanRow) bool {
+		if len(page.Entries) == count {
+			// There is at least one more match, so hand out a cursor.
+			page.Cursor = encodeCursor(page.Entries[count-1].Key)
+			return false
+		}
+		page.Entries = append(page.Entries, Entry{Key: row.key, Value: row.data})
+		return true
+	})
+	if cursor == "" {
+		q.store.Range(prefix, visit)
+	} else {
+		q.store.RangeAfter(prefix, after, visit)
+	}
+	return page, nil
+}
+
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	if cursor == "" {
+		return "", nil
+	}
+	key, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", ErrInvalidCursor
+	}
+	return string(key), nil
+}
@@ -0,0 +1,249 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parser lexes lazily, one token of lookahead at a time, so that some
+// arguments can be read verbatim instead of as tokens.
+type parser struct {
+	input string
+	tok   token
+	end   int
+}
+
+func newParser(input string) *parser {
+	p := &parser{input: input}
+	p.tok, p.end = scanToken(input, 0)
+	return p
+}
+
+// commandParser returns a parser positioned just after the command word.
+func commandParser(input string) *parser {
+	p := newParser(input)
+	p.next()
+	return p
+}
+
+func (p *parser) peek() token {
+	return p.tok
+}
+
+func (p *parser) next() token {
+	t := p.tok
+	if t.kind != tokEOF && t.kind != tokError {
+		p.tok, p.end = scanToken(p.input, p.end)
+	}
+	return t
+}
+
+// nextRaw is like next but returns a bare word as the verbatim run of input
+// up to the next whitespace.
+func (p *parser) nextRaw() token {
+	if p.tok.kind == tokWord || p.tok.kind == tokOp {
+		var t token
+		t, p.end = scanRaw(p.input, p.tok.pos)
+		p.tok, p.end = scanToken(p.input, p.end)
+		return t
+	}
+	return p.next()
+}
+
+func (p *parser) errorf(t token, msg string) error {
+	if t.kind == tokError {
+		msg = t.text
+	}
+	return &SyntaxError{Pos: t.pos, Msg: msg}
+}
+
+func (p *parser) atKeyword(kw string) bool {
+	t := p.peek()
+	return t.kind == tokWord && strings.EqualFold(t.text, kw)
+}
+
+func (p *parser) acceptKeyword(kw string) bool {
+	if p.atKeyword(kw) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expectKeyword(kw string) error {
+	if !p.acceptKeyword(kw) {
+		return p.errorf(p.peek(), "expected "+kw)
+	}
+	return nil
+}
+
+func (p *parser) expectEOF() error {
+	if t := p.peek(); t.kind != tokEOF {
+		return p.errorf(t, "unexpected "+strconv.Quote(t.text))
+	}
+	return nil
+}
+
+// argument reads a bare word or quoted string, such as a key or prefix.
+func (p *parser) argument(what string) (string, error) {
+	t := p.next()
+	if t.kind != tokWord && t.kind != tokString {
+		return "", p.errorf(t, "expected "+what)
+	}
+	return t.text, nil
+}
+
+// rawArgument reads the next whitespace-delimited run of input verbatim,
+// quotes and operator characters included, as SCAN has always read its
+// prefix.
+func (p *parser) rawArgument(what string) (string, error) {
+	if p.tok.kind == tokEOF {
+		return "", p.errorf(p.tok, "expected "+what)
+	}
+	var t token
+	t, p.end = scanRaw(p.input, p.tok.pos)
+	p.tok, p.end = scanToken(p.input, p.end)
+	return t.text, nil
+}
+
+func (p *parser) path() (*Path, error) {
+	t := p.next()
+	if t.kind != tokWord {
+		return nil, p.errorf(t, "expected JSON path")
+	}
+	path, err := ParsePath(t.text)
+	if err != nil {
+		err.(*SyntaxError).Pos = t.pos
+		return nil, err
+	}
+	return path, nil
+}
+
+func (p *parser) pattern(compile func(string) (*Matcher, error)) (*Matcher, error) {
+	t := p.nextRaw()
+	if t.kind != tokWord && t.kind != tokString {
+		return nil, p.errorf(t, "expected pattern")
+	}
+	m, err := compile(t.text)
+	if err != nil {
+		err.(*SyntaxError).Pos += t.pos
+		return nil, err
+	}
+	return m, nil
+}
+
+func (p *parser) duration() (time.Duration, error) {
+	t := p.next()
+	d, err := time.ParseDuration(t.text)
+	if t.kind != tokWord || err != nil {
+		return 0, p.errorf(t, "expected duration such as 30s or 1h")
+	}
+	return d, nil
+}
+
+func (p *parser) positiveInt(what string) (int, error) {
+	t := p.next()
+	n, err := strconv.Atoi(t.text)
+	if t.kind != tokWord || err != nil || n < 0 {
+		return 0, p.errorf(t, "expected non-negative integer "+what)
+	}
+	return n, nil
+}
+
+// expr parses boolean expressions with the usual precedence:
+// NOT binds tighter than AND, which binds tighter than OR.
+func (p *parser) expr() (Expr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("OR") {
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &orExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) andExpr() (Expr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.acceptKeyword("AND") {
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = &andExpr{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) unaryExpr() (Expr, error) {
+	if p.acceptKeyword("NOT") {
+		inner, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return &notExpr{inner: inner}, nil
+	}
+	if t := p.peek(); t.kind == tokOp && t.text == "(" {
+		p.next()
+		inner, err := p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.next(); t.kind != tokOp || t.text != ")" {
+			return nil, p.errorf(t, "expected ')'")
+		}
+		return inner, nil
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, error) {
+	path, err := p.path()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	switch op.text {
+	case "=", "!=", "<", "<=", ">", ">=":
+		if op.kind == tokOp {
+			break
+		}
+		fallthrough
+	default:
+		return nil, p.errorf(op, "expected comparison operator")
+	}
+	value, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	return &compareExpr{path: path, op: op.text, value: value}, nil
+}
+
+func (p *parser) literal() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case tokString:
+		return t.text, nil
+	case tokWord:
+		switch strings.ToLower(t.text) {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		if f, err := strconv.ParseFloat(t.text, 64); err == nil {
+			return f, nil
+		}
+	}
+	return nil, p.errorf(t, "expected string, number, true, false or null")
+}
@@ -0,0 +1,53 @@
+package query
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// TestPrefixArguments checks that every command taking a key prefix reads
+// it verbatim, as SCAN does, so that prefixes holding operator characters
+// or quotes mean the same everywhere.
+func TestPrefixArguments(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+		// key, if set, must exist afterwards.
+		key string
+	}{
+		{`SCAN a=b:`, `map[a=b:1:map[n:1] a=b:2:map[n:2]]`, ""},
+		{`COUNT a=b:`, `2`, ""},
+		{`COUNT a=b: WHERE $.n > 1`, `1`, ""},
+		{`COUNT a=b: GROUP BY $.n`, `[{1 1} {2 1}]`, ""},
+		{`COUNT "q`, `1`, ""},
+		{`COUNT x<(`, `1`, ""},
+		{`SUM a=b: $.n`, `3`, ""},
+		{`AVG a=b: $.n`, `1.5`, ""},
+		{`MIN a=b: $.n`, `1`, ""},
+		{`MAX a=b: $.n MATCH *:2`, `2`, ""},
+		{`DELPREFIX a=b:`, `2`, "a=c"},
+		{`EXPIREPREFIX "q 10s`, `1`, `"q":1`},
+		{`RENAMEPREFIX a=b: y>"(`, `2`, `y>"(1`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			dbs := store.NewDatabases(0, 0)
+			for key, n := range map[string]float64{"a=b:1": 1, "a=b:2": 2, "a=c": 5, `"q":1`: 7, "x<(1": 9} {
+				dbs.Default().Set(key, map[string]interface{}{"n": n}, 0)
+			}
+			q := New(dbs)
+			got, err := q.Execute(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if s := fmt.Sprint(got); s != tt.want {
+				t.Errorf("result = %s, want %s", s, tt.want)
+			}
+			if _, ok := dbs.Default().Get(tt.key); tt.key != "" && !ok {
+				t.Errorf("key %q missing", tt.key)
+			}
+		})
+	}
+}
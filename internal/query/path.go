@@ -0,0 +1,105 @@
+package query
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+)
+
+type pathStep struct {
+	field string
+	index int
+	isIdx bool
+}
+
+// Path is a compiled JSON path of the form $.a.b[0].c. The root $ refers to
+// the whole stored value.
+type Path struct {
+	raw   string
+	steps []pathStep
+}
+
+func ParsePath(raw string) (*Path, error) {
+	if !strings.HasPrefix(raw, "$") {
+		return nil, &SyntaxError{Msg: "path must start with '$': " + raw}
+	}
+	p := &Path{raw: raw}
+	rest := raw[1:]
+	for len(rest) > 0 {
+		switch rest[0] {
+		case '.':
+			rest = rest[1:]
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, &SyntaxError{Msg: "empty field in path " + raw}
+			}
+			p.steps = append(p.steps, pathStep{field: rest[:end]})
+			rest = rest[end:]
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, &SyntaxError{Msg: "unterminated index in path " + raw}
+			}
+			inner := rest[1:end]
+			if n, err := strconv.Atoi(inner); err == nil {
+				p.steps = append(p.steps, pathStep{index: n, isIdx: true})
+			} else if unquoted, err := strconv.Unquote(inner); err == nil {
+				p.steps = append(p.steps, pathStep{field: unquoted})
+			} else {
+				return nil, &SyntaxError{Msg: "invalid index in path " + raw}
+			}
+			rest = rest[end+1:]
+		default:
+			return nil, &SyntaxError{Msg: "invalid path " + raw}
+		}
+	}
+	return p, nil
+}
+
+func (p *Path) String() string {
+	return p.raw
+}
+
+// Lookup resolves the path against a stored value. Values stored as JSON text
+// (for example through the SET query) are decoded first.
+func (p *Path) Lookup(data interface{}) (interface{}, bool) {
+	cur := document(data)
+	for _, step := range p.steps {
+		if step.isIdx {
+			arr, ok := cur.([]interface{})
+			if !ok || step.index < 0 || step.index >= len(arr) {
+				return nil, false
+			}
+			cur = arr[step.index]
+			continue
+		}
+		obj, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur, ok = obj[step.field]
+		if !ok {
+			return nil, false
+		}
+	}
+	return cur, true
+}
+
+func document(data interface{}) interface{} {
+	s, ok := data.(string)
+	if !ok {
+		return data
+	}
+	trimmed := strings.TrimSpace(s)
+	if trimmed == "" || (trimmed[0] != '{' && trimmed[0] != '[') {
+		return data
+	}
+	var decoded interface{}
+	if err := json.Unmarshal([]byte(trimmed), &decoded); err != nil {
+		return data
+	}
+	return decoded
+}
@@ -1,88 +1,360 @@
 package query
 
 import (
-	"errors"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/umgbhalla/gokv/internal/auth"
 	"github.com/umgbhalla/gokv/internal/store"
 )
 
+// Query executes commands against one logical database. Select returns a
+// Query for another database that shares the same job registry and ACL.
 type Query struct {
-	store *store.Store
+	dbs       *store.Databases
+	db        string
+	store     *store.Store
+	jobs      *jobs
+	info      *infoSections
+	acl       *ACL
+	principal *auth.Principal
+	guard     func(key string) bool
+	trace     *tracer
+	limits    *limits
+	client    string
 }
 
-func New(s *store.Store) *Query {
-	return &Query{store: s}
+func New(dbs *store.Databases) *Query {
+	return &Query{dbs: dbs, db: store.DefaultDB, store: dbs.Default(), jobs: newJobs(), info: newInfoSections(), trace: newTracer(), limits: &limits{}}
+}
+
+func (q *Query) Select(db string) (*Query, error) {
+	if db == q.db {
+		return q, nil
+	}
+	s, err := q.dbs.Open(db)
+	if err != nil {
+		return nil, err
+	}
+	r := *q
+	r.db, r.store, r.guard = db, s, nil
+	return &r, nil
+}
+
+// DB returns the name of the database q operates on.
+func (q *Query) DB() string {
+	return q.db
+}
+
+// Session carries per-connection state, such as the database chosen with
+// SELECT, across calls to Execute. It is safe for concurrent use; commands
+// run concurrently with a SELECT see the database before or after it.
+type Session struct {
+	mu sync.RWMutex
+	q  *Query
+}
+
+func (q *Query) NewSession() *Session {
+	return &Session{q: q}
+}
+
+func (s *Session) Query() *Query {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.q
+}
+
+// Execute runs queryString, handling SELECT <db> by switching the session's
+// database.
+func (s *Session) Execute(queryString string) (interface{}, error) {
+	parts := strings.Fields(queryString)
+	if len(parts) > 0 && strings.EqualFold(parts[0], "SELECT") {
+		if len(parts) != 2 {
+			return nil, parseErrorf("SELECT query should have exactly one argument")
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		start := time.Now()
+		q, err := s.q.Select(parts[1])
+		s.q.observe("SELECT", parts[1:], start, err)
+		if err != nil {
+			return nil, err
+		}
+		s.q = q
+		return nil, nil
+	}
+	return s.Query().Execute(queryString)
 }
 
 func (q *Query) Execute(queryString string) (interface{}, error) {
 	parts := strings.Fields(queryString)
 	if len(parts) == 0 {
-		return nil, errors.New("empty query")
+		return nil, parseErrorf("empty query")
 	}
 
 	command := strings.ToUpper(parts[0])
+	start := time.Now()
+	result, err := q.execute(command, parts, queryString)
+	q.observe(command, parts[1:], start, err)
+	return result, err
+}
+
+func (q *Query) execute(command string, parts []string, queryString string) (interface{}, error) {
 	switch command {
 	case "GET":
 		if len(parts) != 2 {
-			return nil, errors.New("GET query should have exactly one argument")
+			return nil, parseErrorf("GET query should have exactly one argument")
 		}
-		return q.executeGet(parts[1])
+		return q.get(parts[1])
 	case "SET":
 		if len(parts) < 3 {
-			return nil, errors.New("SET query should have at least two arguments")
+			return nil, parseErrorf("SET query should have at least two arguments")
 		}
 		ttl := 24 * time.Hour
 		if len(parts) == 4 {
 			duration, err := time.ParseDuration(parts[3])
 			if err != nil {
-				return nil, errors.New("invalid TTL format")
+				return nil, parseErrorf("invalid TTL format")
 			}
 			ttl = duration
 		}
-		return nil, q.executeSet(parts[1], parts[2], ttl)
+		return nil, q.set(parts[1], parts[2], ttl)
 	case "DELETE":
 		if len(parts) != 2 {
-			return nil, errors.New("DELETE query should have exactly one argument")
+			return nil, parseErrorf("DELETE query should have exactly one argument")
 		}
-		return nil, q.executeDelete(parts[1])
+		return nil, q.delete(parts[1])
 	case "SCAN":
-		if len(parts) != 2 {
-			return nil, errors.New("SCAN query should have exactly one argument")
+		if len(parts) < 2 {
+			return nil, parseErrorf("SCAN query should have at least one argument")
+		}
+		p := commandParser(queryString)
+		stmt, err := parseScan(p)
+		if err != nil {
+			return nil, err
+		}
+		q, err := q.restrict(command)
+		if err != nil {
+			return nil, err
+		}
+		if stmt.paginated {
+			return q.scanPage(stmt.filter, stmt.cursor, stmt.count)
+		}
+		if stmt.match == nil && stmt.where == nil && stmt.orderBy == nil && stmt.limit == 0 {
+			return q.executeScan(stmt.prefix)
+		}
+		return q.executeFilteredScan(stmt)
+	case "COUNT", "SUM", "AVG", "MIN", "MAX":
+		p := commandParser(queryString)
+		stmt, err := parseAggregate(command, p)
+		if err != nil {
+			return nil, err
+		}
+		q, err := q.restrict(command)
+		if err != nil {
+			return nil, err
+		}
+		return q.executeAggregate(stmt)
+	case "KEYS":
+		p := commandParser(queryString)
+		m, err := parseKeyPattern(p)
+		if err != nil {
+			return nil, err
 		}
-		return q.executeScan(parts[1])
+		return q.Keys(m)
+	case "INDEX":
+		if err := q.authorize(command); err != nil {
+			return nil, err
+		}
+		p := commandParser(queryString)
+		return q.executeIndex(p)
+	case "ACL":
+		p := commandParser(queryString)
+		return q.executeACL(p)
+	case "SELECT":
+		return nil, parseErrorf("SELECT is only valid within a session")
+	case "DATABASES":
+		if len(parts) != 1 {
+			return nil, parseErrorf("DATABASES query takes no arguments")
+		}
+		if err := q.authorize(command); err != nil {
+			return nil, err
+		}
+		return q.dbs.Names(), nil
+	case "INFO":
+		if len(parts) > 2 {
+			return nil, parseErrorf("INFO query takes at most one argument")
+		}
+		info, err := q.Info()
+		if err != nil || len(parts) == 1 {
+			return info, err
+		}
+		section, ok := info[strings.ToLower(parts[1])]
+		if !ok {
+			return nil, parseErrorf("unknown INFO section %q", parts[1])
+		}
+		return section, nil
+	case "SLOWLOG":
+		p := commandParser(queryString)
+		return q.executeSlowlog(p)
+	case "MONITOR":
+		return nil, parseErrorf("MONITOR is only available as a streaming WebSocket action")
+	case "DELPREFIX", "DELMATCH", "EXPIRE", "EXPIREPREFIX", "RENAME", "COPY", "RENAMEPREFIX", "JOB", "JOBS":
+		p := commandParser(queryString)
+		return q.executeBulk(command, p)
 	default:
-		return nil, errors.New("unknown command")
+		return nil, ErrUnknownCommand
 	}
 }
 
-func (q *Query) executeGet(key string) (interface{}, error) {
+// Get, Set and Delete are the direct equivalents of the commands of the
+// same name, for callers that do not go through Execute.
+
+func (q *Query) Get(key string) (value interface{}, err error) {
+	defer func(start time.Time) { q.observe("GET", []string{key}, start, err) }(time.Now())
+	return q.get(key)
+}
+
+func (q *Query) get(key string) (interface{}, error) {
+	if err := q.authorize("GET", key); err != nil {
+		return nil, err
+	}
 	value, exists := q.store.Get(key)
 	if !exists {
-		return nil, errors.New("key not found")
+		return nil, ErrNotFound
 	}
 	return value, nil
 }
 
-func (q *Query) executeSet(key string, value interface{}, ttl time.Duration) error {
-	q.store.Set(key, value, ttl)
-	return nil
+func (q *Query) Set(key string, value interface{}, ttl time.Duration) (err error) {
+	defer func(start time.Time) { q.observe("SET", []string{key}, start, err) }(time.Now())
+	return q.set(key, value, ttl)
+}
+
+func (q *Query) set(key string, value interface{}, ttl time.Duration) error {
+	if err := q.authorize("SET", key); err != nil {
+		return err
+	}
+	if err := q.checkKey(key); err != nil {
+		return err
+	}
+	if err := q.checkValue(value); err != nil {
+		return err
+	}
+	return q.store.Set(key, value, ttl)
+}
+
+func (q *Query) Delete(key string) (err error) {
+	defer func(start time.Time) { q.observe("DELETE", []string{key}, start, err) }(time.Now())
+	return q.delete(key)
 }
 
-func (q *Query) executeDelete(key string) error {
-	q.store.Delete(key)
-	return nil
+func (q *Query) delete(key string) error {
+	if err := q.authorize("DELETE", key); err != nil {
+		return err
+	}
+	return q.store.Delete(key)
+}
+
+// Expire sets a new TTL on key, removing any expiry if ttl is zero or less.
+// It reports false if the key does not exist.
+func (q *Query) Expire(key string, ttl time.Duration) (ok bool, err error) {
+	defer func(start time.Time) { q.observe("EXPIRE", []string{key, ttl.String()}, start, err) }(time.Now())
+	return q.expire(key, ttl)
+}
+
+func (q *Query) expire(key string, ttl time.Duration) (bool, error) {
+	if err := q.authorize("EXPIRE", key); err != nil {
+		return false, err
+	}
+	return q.store.Expire(key, ttl), nil
 }
 
 // TODO: find faster mech for this ?
 func (q *Query) executeScan(prefix string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
-	allData := q.store.GetAll()
-	for k, v := range allData {
-		if strings.HasPrefix(k, prefix) {
-			result[k] = v.Data
+	q.each(filter{prefix: prefix}, func(row scanRow) bool {
+		result[row.key] = row.data
+		return true
+	})
+	return result, nil
+}
+
+// executeIndex handles INDEX CREATE <path>, INDEX DROP <path> and INDEX LIST.
+func (q *Query) executeIndex(p *parser) (interface{}, error) {
+	switch {
+	case p.acceptKeyword("CREATE"):
+		path, err := p.path()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		q.store.CreateIndex(path.String(), func(v store.Value) (string, bool) {
+			value, _ := path.Lookup(v.Data)
+			return indexTerm(value)
+		})
+		return nil, nil
+	case p.acceptKeyword("DROP"):
+		path, err := p.path()
+		if err != nil {
+			return nil, err
 		}
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		if !q.store.DropIndex(path.String()) {
+			return nil, ErrIndexNotFound
+		}
+		return nil, nil
+	case p.acceptKeyword("LIST"):
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.store.Indexes(), nil
 	}
-	return result, nil
+	return nil, p.errorf(p.peek(), "expected CREATE, DROP or LIST")
+}
+
+// GetValue returns the entry for key together with its version and
+// timestamps.
+func (q *Query) GetValue(key string) (value store.Value, err error) {
+	defer func(start time.Time) { q.observe("GET", []string{key}, start, err) }(time.Now())
+	if err := q.authorize("GET", key); err != nil {
+		return store.Value{}, err
+	}
+	value, exists := q.store.GetValue(key)
+	if !exists {
+		return store.Value{}, ErrNotFound
+	}
+	return value, nil
+}
+
+// Update atomically replaces key with the result of fn. See store.Update.
+func (q *Query) Update(key string, fn func(current store.Value, exists bool) (store.Value, error)) (value store.Value, err error) {
+	defer func(start time.Time) { q.observe("SET", []string{key}, start, err) }(time.Now())
+	if err := q.authorize("SET", key); err != nil {
+		return store.Value{}, err
+	}
+	if err := q.checkKey(key); err != nil {
+		return store.Value{}, err
+	}
+	return q.store.Update(key, func(current store.Value, exists bool) (store.Value, error) {
+		next, err := fn(current, exists)
+		if err != nil {
+			return next, err
+		}
+		return next, q.checkValue(next.Data)
+	})
+}
+
+// DeleteIf atomically deletes key if check allows it. See store.DeleteIf.
+func (q *Query) DeleteIf(key string, check func(current store.Value, exists bool) error) (err error) {
+	defer func(start time.Time) { q.observe("DELETE", []string{key}, start, err) }(time.Now())
+	if err := q.authorize("DELETE", key); err != nil {
+		return err
+	}
+	return q.store.DeleteIf(key, check)
 }
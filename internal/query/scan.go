@@ -0,0 +1,239 @@
+package query
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// Entry is a single key/value pair in an ordered query result.
+type Entry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// filter selects entries by key prefix, optional key pattern and optional
+// predicate on the value.
+type filter struct {
+	prefix string
+	match  *Matcher
+	where  Expr
+}
+
+// parseFilterClauses reads the optional MATCH <glob> | REGEX <re> and
+// WHERE <expr> clauses that follow a prefix.
+func parseFilterClauses(p *parser, f *filter) error {
+	var err error
+	switch {
+	case p.acceptKeyword("MATCH"):
+		if f.match, err = p.pattern(CompileGlob); err != nil {
+			return err
+		}
+	case p.acceptKeyword("REGEX"):
+		if f.match, err = p.pattern(CompileRegex); err != nil {
+			return err
+		}
+	}
+	if p.acceptKeyword("WHERE") {
+		if f.where, err = p.expr(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type scanStmt struct {
+	filter
+	orderBy *Path
+	desc    bool
+	limit   int
+
+	paginated bool
+	cursor    string
+	count     int
+}
+
+// parseScan parses
+//
+//	SCAN <prefix> [MATCH <glob> | REGEX <re>] [WHERE <expr>] [ORDER BY <path> [ASC|DESC]] [LIMIT <n>]
+//	SCAN <prefix> [MATCH <glob> | REGEX <re>] [WHERE <expr>] CURSOR <cursor> [COUNT <n>]
+//	SCAN <prefix> [MATCH <glob> | REGEX <re>] [WHERE <expr>] COUNT <n>
+func parseScan(p *parser) (*scanStmt, error) {
+	stmt := &scanStmt{}
+	prefix, err := p.rawArgument("prefix")
+	if err != nil {
+		return nil, err
+	}
+	stmt.prefix = prefix
+	if err := parseFilterClauses(p, &stmt.filter); err != nil {
+		return nil, err
+	}
+	if p.acceptKeyword("ORDER") {
+		if err := p.expectKeyword("BY"); err != nil {
+			return nil, err
+		}
+		if stmt.orderBy, err = p.path(); err != nil {
+			return nil, err
+		}
+		if p.acceptKeyword("DESC") {
+			stmt.desc = true
+		} else {
+			p.acceptKeyword("ASC")
+		}
+	}
+	if p.acceptKeyword("LIMIT") {
+		if stmt.limit, err = p.positiveInt("after LIMIT"); err != nil {
+			return nil, err
+		}
+	}
+	if stmt.orderBy == nil && stmt.limit == 0 {
+		if p.acceptKeyword("CURSOR") {
+			stmt.paginated = true
+			if stmt.cursor, err = p.argument("cursor"); err != nil {
+				return nil, err
+			}
+		}
+		if p.acceptKeyword("COUNT") {
+			stmt.paginated = true
+			if stmt.count, err = p.positiveInt("after COUNT"); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return stmt, p.expectEOF()
+}
+
+type scanRow struct {
+	key  string
+	data interface{}
+	doc  interface{}
+}
+
+// document returns the decoded value, reusing the copy decoded for the WHERE
+// clause when there was one.
+func (r scanRow) document() interface{} {
+	if r.doc != nil {
+		return r.doc
+	}
+	return document(r.data)
+}
+
+// visitor adapts fn to the store's Range callback, skipping entries that
+// fail the filter.
+func (f *filter) visitor(fn func(row scanRow) bool) func(key string, v store.Value) bool {
+	return func(key string, v store.Value) bool {
+		if !strings.HasPrefix(key, f.prefix) || (f.match != nil && !f.match.Match(key)) {
+			return true
+		}
+		row := scanRow{key: key, data: v.Data}
+		if f.where != nil {
+			row.doc = document(v.Data)
+			if !f.where.Eval(row.doc) {
+				return true
+			}
+		}
+		return fn(row)
+	}
+}
+
+// visitor is f.visitor, also skipping keys the ACL hides from q.
+func (q *Query) visitor(f filter, fn func(row scanRow) bool) func(key string, v store.Value) bool {
+	visit := f.visitor(fn)
+	if q.guard == nil {
+		return visit
+	}
+	return func(key string, v store.Value) bool {
+		if !q.guard(key) {
+			return true
+		}
+		return visit(key, v)
+	}
+}
+
+// each calls fn for every entry selected by f. Equality predicates on an
+// indexed path are answered from the index; otherwise only the part of the
+// ordered keyspace sharing the prefix (narrowed by the pattern) is walked.
+func (q *Query) each(f filter, fn func(row scanRow) bool) {
+	visit := q.visitor(f, fn)
+	if name, term, ok := q.indexedTerm(f.where); ok {
+		if q.store.LookupIndex(name, term, visit) {
+			return
+		}
+	}
+	prefix, ok := narrowPrefix(f.prefix, f.match)
+	if !ok {
+		return
+	}
+	q.store.Range(prefix, visit)
+}
+
+// indexedTerm finds an equality comparison in the top-level AND chain of
+// where whose path has a secondary index.
+func (q *Query) indexedTerm(where Expr) (string, string, bool) {
+	switch e := where.(type) {
+	case *andExpr:
+		if name, term, ok := q.indexedTerm(e.left); ok {
+			return name, term, true
+		}
+		return q.indexedTerm(e.right)
+	case *compareExpr:
+		if e.op != "=" || !q.store.HasIndex(e.path.String()) {
+			return "", "", false
+		}
+		term, ok := indexTerm(e.value)
+		return e.path.String(), term, ok
+	}
+	return "", "", false
+}
+
+func (q *Query) executeFilteredScan(stmt *scanStmt) ([]Entry, error) {
+	var rows []scanRow
+	q.each(stmt.filter, func(row scanRow) bool {
+		rows = append(rows, row)
+		return true
+	})
+
+	if stmt.orderBy != nil {
+		keys := make([]interface{}, len(rows))
+		for i, row := range rows {
+			keys[i], _ = stmt.orderBy.Lookup(row.document())
+		}
+		sort.Sort(&rowSorter{rows: rows, keys: keys, desc: stmt.desc})
+	} else {
+		sort.Slice(rows, func(i, j int) bool { return rows[i].key < rows[j].key })
+	}
+
+	if stmt.limit > 0 && len(rows) > stmt.limit {
+		rows = rows[:stmt.limit]
+	}
+	result := make([]Entry, len(rows))
+	for i, row := range rows {
+		result[i] = Entry{Key: row.key, Value: row.data}
+	}
+	return result, nil
+}
+
+type rowSorter struct {
+	rows []scanRow
+	keys []interface{}
+	desc bool
+}
+
+func (r *rowSorter) Len() int { return len(r.rows) }
+
+func (r *rowSorter) Swap(i, j int) {
+	r.rows[i], r.rows[j] = r.rows[j], r.rows[i]
+	r.keys[i], r.keys[j] = r.keys[j], r.keys[i]
+}
+
+func (r *rowSorter) Less(i, j int) bool {
+	cmp := orderValues(r.keys[i], r.keys[j])
+	if r.desc {
+		cmp = -cmp
+	}
+	if cmp == 0 {
+		return r.rows[i].key < r.rows[j].key
+	}
+	return cmp < 0
+}
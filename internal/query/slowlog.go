@@ -0,0 +1,209 @@
+package query
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultSlowlogThreshold = 10 * time.Millisecond
+	DefaultSlowlogMaxLen    = 128
+)
+
+// Arguments are clipped before they are logged, so a large SET value does
+// not bloat the slowlog or the MONITOR stream.
+const (
+	maxLoggedArgs   = 32
+	maxLoggedArgLen = 128
+	redacted        = "(redacted)"
+)
+
+// SlowlogEntry records one command that ran for longer than the slowlog
+// threshold.
+type SlowlogEntry struct {
+	ID         uint64    `json:"id"`
+	Time       time.Time `json:"time"`
+	DurationUS int64     `json:"duration_us"`
+	DB         string    `json:"db"`
+	Client     string    `json:"client,omitempty"`
+	User       string    `json:"user,omitempty"`
+	Command    string    `json:"command"`
+	Args       []string  `json:"args,omitempty"`
+}
+
+// slowlog is a ring buffer of the most recent slow commands.
+type slowlog struct {
+	mu        sync.Mutex
+	threshold time.Duration
+	entries   []SlowlogEntry
+	next      int
+	full      bool
+	nextID    uint64
+}
+
+func newSlowlog(threshold time.Duration, maxLen int) *slowlog {
+	return &slowlog{threshold: threshold, entries: make([]SlowlogEntry, maxLen)}
+}
+
+func (l *slowlog) add(e SlowlogEntry, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.threshold < 0 || d < l.threshold || len(l.entries) == 0 {
+		return
+	}
+	l.nextID++
+	e.ID = l.nextID
+	l.entries[l.next] = e
+	l.next = (l.next + 1) % len(l.entries)
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+func (l *slowlog) len() int {
+	if l.full {
+		return len(l.entries)
+	}
+	return l.next
+}
+
+// get returns up to n entries, newest first. n <= 0 returns them all.
+func (l *slowlog) get(n int) []SlowlogEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	size := l.len()
+	if n <= 0 || n > size {
+		n = size
+	}
+	result := make([]SlowlogEntry, 0, n)
+	for i := 1; i <= n; i++ {
+		idx := (l.next - i + len(l.entries)) % len(l.entries)
+		result = append(result, l.entries[idx])
+	}
+	return result
+}
+
+func (l *slowlog) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.entries = make([]SlowlogEntry, len(l.entries))
+	l.next, l.full = 0, false
+}
+
+func (l *slowlog) configure(threshold time.Duration, maxLen int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.threshold = threshold
+	if maxLen != len(l.entries) {
+		l.entries = make([]SlowlogEntry, maxLen)
+		l.next, l.full = 0, false
+	}
+}
+
+// ConfigureSlowlog sets the duration above which commands are logged and
+// the number of entries kept. A negative threshold disables the slowlog.
+// Changing the length discards the current entries.
+func (q *Query) ConfigureSlowlog(threshold time.Duration, maxLen int) {
+	if maxLen < 0 {
+		maxLen = 0
+	}
+	q.trace.slowlog.configure(threshold, maxLen)
+}
+
+func (q *Query) Slowlog(n int) ([]SlowlogEntry, error) {
+	if err := q.authorize("SLOWLOG"); err != nil {
+		return nil, err
+	}
+	return q.trace.slowlog.get(n), nil
+}
+
+func (q *Query) ResetSlowlog() error {
+	if err := q.authorize("SLOWLOG"); err != nil {
+		return err
+	}
+	q.trace.slowlog.reset()
+	return nil
+}
+
+// executeSlowlog handles SLOWLOG GET [n], SLOWLOG LEN and SLOWLOG RESET.
+func (q *Query) executeSlowlog(p *parser) (interface{}, error) {
+	switch {
+	case p.acceptKeyword("GET"):
+		n := 10
+		if p.peek().kind != tokEOF {
+			count, err := p.positiveInt("entry count")
+			if err != nil {
+				return nil, err
+			}
+			n = count
+		}
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return q.Slowlog(n)
+	case p.acceptKeyword("LEN"):
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		entries, err := q.Slowlog(0)
+		return len(entries), err
+	case p.acceptKeyword("RESET"):
+		if err := p.expectEOF(); err != nil {
+			return nil, err
+		}
+		return nil, q.ResetSlowlog()
+	}
+	return nil, p.errorf(p.peek(), "expected GET, LEN or RESET")
+}
+
+// SetRedactedPrefixes hides the arguments of commands on keys under any of
+// prefixes from the slowlog and MONITOR. The key itself is still shown.
+func (q *Query) SetRedactedPrefixes(prefixes []string) {
+	q.trace.mu.Lock()
+	defer q.trace.mu.Unlock()
+	q.trace.redact = append([]string(nil), prefixes...)
+}
+
+// loggedArgs clips args for logging, and redacts all but the first when any
+// of them names a key under a redacted prefix.
+func (t *tracer) loggedArgs(args []string) []string {
+	if len(args) == 0 {
+		return nil
+	}
+	t.mu.RLock()
+	redact := t.redact
+	t.mu.RUnlock()
+
+	sensitive := false
+	for _, arg := range args {
+		for _, prefix := range redact {
+			if strings.HasPrefix(arg, prefix) {
+				sensitive = true
+			}
+		}
+	}
+	n := len(args)
+	if n > maxLoggedArgs {
+		n = maxLoggedArgs
+	}
+	logged := make([]string, 0, n+1)
+	for i, arg := range args[:n] {
+		switch {
+		case sensitive && i > 0:
+			arg = redacted
+		case len(arg) > maxLoggedArgLen:
+			arg = arg[:maxLoggedArgLen] + "... (" + strconv.Itoa(len(arg)) + " bytes)"
+		}
+		logged = append(logged, arg)
+	}
+	if len(args) > n {
+		logged = append(logged, "... ("+strconv.Itoa(len(args)-n)+" more arguments)")
+	}
+	return logged
+}
@@ -0,0 +1,73 @@
+package query
+
+import (
+	"time"
+
+	"github.com/umgbhalla/gokv/internal/store"
+)
+
+// TxnWrite is one write of a transaction: Value is stored under Key, or Key
+// is deleted if Delete is set.
+type TxnWrite struct {
+	Key    string
+	Value  store.Value
+	Delete bool
+}
+
+// Commit atomically checks that every key in reads is still at the version
+// given, zero for a key that must not exist, and then applies writes in
+// order. If any key has changed it fails with ErrConflict and writes
+// nothing.
+//
+// The principal must be allowed TXN, GET on every key read and SET or
+// DELETE on every key written.
+func (q *Query) Commit(reads map[string]uint64, writes []TxnWrite) (err error) {
+	keys := make([]string, len(writes))
+	for i, w := range writes {
+		keys[i] = w.Key
+	}
+	defer func(start time.Time) { q.observe("TXN", keys, start, err) }(time.Now())
+
+	if err := q.authorize("TXN"); err != nil {
+		return err
+	}
+	for key := range reads {
+		if err := q.authorize("GET", key); err != nil {
+			return err
+		}
+	}
+	for _, w := range writes {
+		if w.Delete {
+			if err := q.authorize("DELETE", w.Key); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := q.authorize("SET", w.Key); err != nil {
+			return err
+		}
+		if err := q.checkKey(w.Key); err != nil {
+			return err
+		}
+		if err := q.checkValue(w.Value.Data); err != nil {
+			return err
+		}
+	}
+
+	return q.store.Atomic(func(tx *store.Tx) error {
+		for key, version := range reads {
+			v, exists := tx.Get(key)
+			if (exists && v.Version != version) || (!exists && version != 0) {
+				return ErrConflict
+			}
+		}
+		for _, w := range writes {
+			if w.Delete {
+				tx.Delete(w.Key)
+			} else {
+				tx.Put(w.Key, w.Value)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,25 @@
+package query
+
+import "github.com/umgbhalla/gokv/internal/store"
+
+// Watch reports every later change to the keys starting with prefix and
+// matching m, if not nil, that q's principal may WATCH. The caller must
+// stop the watcher.
+func (q *Query) Watch(prefix string, m *Matcher) (*store.Watcher, error) {
+	r, err := q.restrict("WATCH")
+	if err != nil {
+		return nil, err
+	}
+	narrowed, ok := narrowPrefix(prefix, m)
+	if !ok {
+		// No key can match, but the watch still runs until stopped.
+		return q.store.Watch(prefix, func(string) bool { return false }), nil
+	}
+	match := r.guard
+	if m != nil {
+		match = func(key string) bool {
+			return m.Match(key) && r.permits(key)
+		}
+	}
+	return q.store.Watch(narrowed, match), nil
+}
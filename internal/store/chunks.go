@@ -0,0 +1,176 @@
+package store
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// DefaultChunkSize is the size of the pieces chunked values are stored in.
+const DefaultChunkSize = 1 << 20
+
+// Chunks is a binary value held as a sequence of pieces of at most the chunk
+// size, so that a large value needs no single large allocation and a
+// snapshot can store the pieces apart from the other entries. Wherever a
+// value is encoded it reads as one byte string. Chunks are never modified
+// once created.
+type Chunks struct {
+	parts [][]byte
+	size  int64
+}
+
+// NewChunks wraps parts, which must not be modified afterwards.
+func NewChunks(parts [][]byte) *Chunks {
+	c := &Chunks{parts: parts}
+	for _, p := range parts {
+		c.size += int64(len(p))
+	}
+	return c
+}
+
+// ReadChunks reads r to the end into pieces of chunkSize bytes.
+func ReadChunks(r io.Reader, chunkSize int) (*Chunks, error) {
+	if chunkSize <= 0 {
+		return nil, errors.New("chunk size must be positive")
+	}
+	var parts [][]byte
+	for {
+		part := make([]byte, chunkSize)
+		n, err := io.ReadFull(r, part)
+		if n > 0 {
+			parts = append(parts, part[:n:n])
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return NewChunks(parts), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Size is the length of the value in bytes.
+func (c *Chunks) Size() int64 {
+	return c.size
+}
+
+// Parts returns the pieces, which must not be modified.
+func (c *Chunks) Parts() [][]byte {
+	return c.parts
+}
+
+// Bytes returns the value as a single slice.
+func (c *Chunks) Bytes() []byte {
+	b := make([]byte, 0, c.size)
+	for _, p := range c.parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+// NewReader reads the value without copying it, seeking as http.ServeContent
+// does to answer Range requests.
+func (c *Chunks) NewReader() io.ReadSeeker {
+	return &chunkReader{c: c}
+}
+
+type chunkReader struct {
+	c   *Chunks
+	off int64
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	if r.off >= r.c.size {
+		return 0, io.EOF
+	}
+	n := 0
+	start := int64(0)
+	for _, p := range r.c.parts {
+		end := start + int64(len(p))
+		if r.off < end && n < len(b) {
+			copied := copy(b[n:], p[r.off-start:])
+			n += copied
+			r.off += int64(copied)
+		}
+		start = end
+	}
+	return n, nil
+}
+
+func (r *chunkReader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.off
+	case io.SeekEnd:
+		offset += r.c.size
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	r.off = offset
+	return offset, nil
+}
+
+// MarshalJSON encodes the value as a base64 string, as encoding/json does
+// for []byte.
+func (c *Chunks) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Grow(base64.StdEncoding.EncodedLen(int(c.size)) + 2)
+	buf.WriteByte('"')
+	enc := base64.NewEncoder(base64.StdEncoding, &buf)
+	for _, p := range c.parts {
+		enc.Write(p)
+	}
+	enc.Close()
+	buf.WriteByte('"')
+	return buf.Bytes(), nil
+}
+
+// MarshalMsgpack encodes the value as a MessagePack bin.
+func (c *Chunks) MarshalMsgpack() ([]byte, error) {
+	var header []byte
+	switch {
+	case c.size <= 0xff:
+		header = []byte{0xc4, byte(c.size)}
+	case c.size <= 0xffff:
+		header = binary.BigEndian.AppendUint16([]byte{0xc5}, uint16(c.size))
+	case c.size <= 0xffffffff:
+		header = binary.BigEndian.AppendUint32([]byte{0xc6}, uint32(c.size))
+	default:
+		return nil, errors.New("value too large for MessagePack")
+	}
+	return c.withHeader(header), nil
+}
+
+// MarshalCBOR encodes the value as a CBOR byte string.
+func (c *Chunks) MarshalCBOR() ([]byte, error) {
+	const byteString = 2 << 5
+	var header []byte
+	switch {
+	case c.size < 24:
+		header = []byte{byteString | byte(c.size)}
+	case c.size <= 0xff:
+		header = []byte{byteString | 24, byte(c.size)}
+	case c.size <= 0xffff:
+		header = binary.BigEndian.AppendUint16([]byte{byteString | 25}, uint16(c.size))
+	case c.size <= 0xffffffff:
+		header = binary.BigEndian.AppendUint32([]byte{byteString | 26}, uint32(c.size))
+	default:
+		header = binary.BigEndian.AppendUint64([]byte{byteString | 27}, uint64(c.size))
+	}
+	return c.withHeader(header), nil
+}
+
+func (c *Chunks) withHeader(header []byte) []byte {
+	b := make([]byte, 0, len(header)+int(c.size))
+	b = append(b, header...)
+	for _, p := range c.parts {
+		b = append(b, p...)
+	}
+	return b
+}
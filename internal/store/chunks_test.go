@@ -0,0 +1,83 @@
+package store
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+)
+
+func TestReadChunks(t *testing.T) {
+	tests := []struct {
+		data  string
+		parts int
+	}{
+		{"", 0},
+		{"abc", 1},
+		{"abcd", 1},
+		{"abcde", 2},
+		{"abcdefghij", 3},
+	}
+	for _, tt := range tests {
+		c, err := ReadChunks(strings.NewReader(tt.data), 4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(c.Parts()) != tt.parts || c.Size() != int64(len(tt.data)) || string(c.Bytes()) != tt.data {
+			t.Errorf("ReadChunks(%q) = %d parts of %q, size %d", tt.data, len(c.Parts()), c.Bytes(), c.Size())
+		}
+	}
+	if _, err := ReadChunks(strings.NewReader("a"), 0); err == nil {
+		t.Error("chunk size 0 accepted")
+	}
+}
+
+func TestChunkReader(t *testing.T) {
+	data := []byte("0123456789")
+	c := NewChunks([][]byte{data[:3], data[3:4], data[4:]})
+	r := c.NewReader()
+	for _, seek := range []struct {
+		offset int64
+		whence int
+		at     int64
+	}{
+		{0, io.SeekStart, 0},
+		{2, io.SeekStart, 2},
+		{5, io.SeekStart, 5},
+		{-4, io.SeekEnd, 6},
+		{10, io.SeekStart, 10},
+	} {
+		at, err := r.Seek(seek.offset, seek.whence)
+		if err != nil || at != seek.at {
+			t.Fatalf("Seek(%d, %d) = %d, %v", seek.offset, seek.whence, at, err)
+		}
+		rest, err := io.ReadAll(r)
+		if err != nil || !bytes.Equal(rest, data[at:]) {
+			t.Errorf("read %q after seeking to %d, want %q", rest, at, data[at:])
+		}
+	}
+	if _, err := r.Seek(-1, io.SeekStart); err == nil {
+		t.Error("seeked before the start")
+	}
+}
+
+// Chunks encode as the byte string they hold.
+func TestChunksEncoding(t *testing.T) {
+	data := bytes.Repeat([]byte("chunk"), 100)
+	c := NewChunks([][]byte{data[:7], data[7:300], data[300:]})
+	for _, enc := range codec.All {
+		got, err := enc.Marshal(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := enc.Marshal(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s encodes chunks as %q, want %q", enc.Name(), got, want)
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package store
+
+import (
+	"errors"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultDB = "0"
+
+// DefaultMaxDatabases bounds how many logical databases clients can create
+// on demand.
+const DefaultMaxDatabases = 16
+
+var (
+	ErrInvalidDBName = errors.New("invalid database name")
+	ErrTooManyDBs    = errors.New("too many databases")
+)
+
+var dbNamePattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Databases is a set of independent named keyspaces. Each database is a
+// separate Store with its own TTL sweep and secondary indexes.
+type Databases struct {
+	mu    sync.RWMutex
+	dbs   map[string]*Store
+	max   int
+	sweep time.Duration
+}
+
+// NewDatabases allows up to max databases, each sweeping expired entries
+// every sweep. Zero values select DefaultMaxDatabases and
+// DefaultSweepInterval.
+func NewDatabases(max int, sweep time.Duration) *Databases {
+	if max <= 0 {
+		max = DefaultMaxDatabases
+	}
+	if sweep <= 0 {
+		sweep = DefaultSweepInterval
+	}
+	d := &Databases{dbs: make(map[string]*Store), max: max, sweep: sweep}
+	d.dbs[DefaultDB] = NewWithSweep(sweep)
+	return d
+}
+
+func (d *Databases) Default() *Store {
+	s, _ := d.Open(DefaultDB)
+	return s
+}
+
+// Open returns the named database, creating it if it does not exist yet.
+func (d *Databases) Open(name string) (*Store, error) {
+	if !dbNamePattern.MatchString(name) {
+		return nil, ErrInvalidDBName
+	}
+
+	d.mu.RLock()
+	s, ok := d.dbs[name]
+	d.mu.RUnlock()
+	if ok {
+		return s, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if s, ok := d.dbs[name]; ok {
+		return s, nil
+	}
+	if len(d.dbs) >= d.max {
+		return nil, ErrTooManyDBs
+	}
+	s = NewWithSweep(d.sweep)
+	d.dbs[name] = s
+	return s, nil
+}
+
+func (d *Databases) Names() []string {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	names := make([]string, 0, len(d.dbs))
+	for name := range d.dbs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Snapshot copies the contents of every database.
+func (d *Databases) Snapshot() map[string]map[string]Value {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	result := make(map[string]map[string]Value, len(d.dbs))
+	for name, s := range d.dbs {
+		result[name] = s.GetAll()
+	}
+	return result
+}
+
+// Restore replaces the contents of the given databases, creating them as
+// needed. Databases not mentioned are left untouched.
+func (d *Databases) Restore(data map[string]map[string]Value) error {
+	for name, values := range data {
+		s, err := d.Open(name)
+		if err != nil {
+			return err
+		}
+		s.SetAll(values)
+	}
+	return nil
+}
+
+// Stats returns the statistics of every open database.
+func (d *Databases) Stats() map[string]Stats {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	stats := make(map[string]Stats, len(d.dbs))
+	for name, s := range d.dbs {
+		stats[name] = s.Stats()
+	}
+	return stats
+}
@@ -0,0 +1,9 @@
+package store
+
+import "errors"
+
+var (
+	ErrNotFound  = errors.New("key not found")
+	ErrWrongType = errors.New("operation against a value of the wrong type")
+	ErrConflict  = errors.New("conflicting write")
+)
@@ -0,0 +1,142 @@
+package store
+
+import (
+	"sort"
+	"time"
+)
+
+// Indexer extracts the term a value is filed under in a secondary index.
+// Returning false leaves the key out of the index.
+type Indexer func(value Value) (string, bool)
+
+type index struct {
+	extract Indexer
+	terms   map[string]map[string]struct{}
+	keyTerm map[string]string
+}
+
+func newIndex(extract Indexer) *index {
+	return &index{
+		extract: extract,
+		terms:   make(map[string]map[string]struct{}),
+		keyTerm: make(map[string]string),
+	}
+}
+
+func (idx *index) add(key string, value Value) {
+	idx.remove(key)
+	term, ok := idx.extract(value)
+	if !ok {
+		return
+	}
+	keys, ok := idx.terms[term]
+	if !ok {
+		keys = make(map[string]struct{})
+		idx.terms[term] = keys
+	}
+	keys[key] = struct{}{}
+	idx.keyTerm[key] = term
+}
+
+func (idx *index) remove(key string) {
+	term, ok := idx.keyTerm[key]
+	if !ok {
+		return
+	}
+	delete(idx.keyTerm, key)
+	keys := idx.terms[term]
+	delete(keys, key)
+	if len(keys) == 0 {
+		delete(idx.terms, term)
+	}
+}
+
+// CreateIndex builds a secondary index over every stored value and keeps it
+// up to date on later writes. Creating an index that already exists
+// replaces it.
+func (s *Store) CreateIndex(name string, extract Indexer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	idx := newIndex(extract)
+	for k, v := range s.data {
+		idx.add(k, v)
+	}
+	s.indexes[name] = idx
+}
+
+func (s *Store) DropIndex(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.indexes[name]; !ok {
+		return false
+	}
+	delete(s.indexes, name)
+	return true
+}
+
+func (s *Store) HasIndex(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, ok := s.indexes[name]
+	return ok
+}
+
+func (s *Store) Indexes() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	names := make([]string, 0, len(s.indexes))
+	for name := range s.indexes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupIndex calls fn for every live key filed under term in the named
+// index. It reports false if the index does not exist.
+func (s *Store) LookupIndex(name, term string, fn func(key string, value Value) bool) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	idx, ok := s.indexes[name]
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	for k := range idx.terms[term] {
+		v := s.data[k]
+		if v.Expired(now) {
+			continue
+		}
+		if !fn(k, v) {
+			break
+		}
+	}
+	return true
+}
+
+func (s *Store) indexAdd(key string, value Value) {
+	for _, idx := range s.indexes {
+		idx.add(key, value)
+	}
+}
+
+func (s *Store) indexRemove(key string) {
+	for _, idx := range s.indexes {
+		idx.remove(key)
+	}
+}
+
+func (s *Store) rebuildIndexes() {
+	for name, idx := range s.indexes {
+		rebuilt := newIndex(idx.extract)
+		for k, v := range s.data {
+			rebuilt.add(k, v)
+		}
+		s.indexes[name] = rebuilt
+	}
+}
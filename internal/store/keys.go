@@ -0,0 +1,98 @@
+package store
+
+import (
+	"strings"
+	"time"
+
+	"github.com/google/btree"
+)
+
+// put and remove are the only places that change s.data, so the ordered key
+// index and the secondary indexes always agree with it and watchers see
+// every change. Callers hold s.mu.
+func (s *Store) put(key string, v Value) {
+	if old, exists := s.data[key]; exists {
+		s.bytes -= entrySize(key, old)
+	} else {
+		s.keys.ReplaceOrInsert(key)
+	}
+	s.version++
+	v.Version = s.version
+	v.ModifiedAt = time.Now()
+	s.data[key] = v
+	s.bytes += entrySize(key, v)
+	s.indexAdd(key, v)
+	if len(s.watchers) > 0 {
+		s.notify(Event{Type: EventSet, Key: key, Value: v})
+	}
+}
+
+func (s *Store) remove(key string) {
+	s.removeAs(key, EventDelete)
+}
+
+// removeAs removes key, reporting it to watchers as an event of type t.
+func (s *Store) removeAs(key string, t EventType) {
+	old, exists := s.data[key]
+	if !exists {
+		return
+	}
+	s.bytes -= entrySize(key, old)
+	delete(s.data, key)
+	s.keys.Delete(key)
+	s.indexRemove(key)
+	if len(s.watchers) > 0 {
+		s.notify(Event{Type: t, Key: key})
+	}
+}
+
+func newKeyIndex() *btree.BTreeG[string] {
+	return btree.NewOrderedG[string](32)
+}
+
+func (s *Store) rebuildKeys() {
+	s.keys = newKeyIndex()
+	for k := range s.data {
+		s.keys.ReplaceOrInsert(k)
+	}
+}
+
+// Range calls fn in key order for every live key starting with prefix until
+// fn returns false. It holds the read lock for the whole walk, so fn must not
+// call back into the store.
+func (s *Store) Range(prefix string, fn func(key string, value Value) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	s.rangeFrom(prefix, prefix, fn)
+}
+
+// RangeAfter is like Range but starts at the first key strictly greater than
+// after. Keys that exist for the whole of a paginated walk are therefore
+// visited exactly once, whatever is written between pages.
+func (s *Store) RangeAfter(prefix, after string, fn func(key string, value Value) bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if after < prefix {
+		s.rangeFrom(prefix, prefix, fn)
+		return
+	}
+	s.rangeFrom(after, prefix, func(key string, value Value) bool {
+		return key == after || fn(key, value)
+	})
+}
+
+func (s *Store) rangeFrom(start, prefix string, fn func(key string, value Value) bool) {
+	now := time.Now()
+	s.keys.AscendGreaterOrEqual(start, func(k string) bool {
+		if !strings.HasPrefix(k, prefix) {
+			return false
+		}
+		v := s.data[k]
+		if v.Expired(now) {
+			return true
+		}
+		return fn(k, v)
+	})
+}
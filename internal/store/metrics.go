@@ -0,0 +1,32 @@
+package store
+
+import "github.com/umgbhalla/gokv/internal/metrics"
+
+// RegisterMetrics exposes key counts, memory estimates and expirations of
+// every database in r.
+func (d *Databases) RegisterMetrics(r *metrics.Registry) {
+	perDB := func(field func(Stats) float64) func() map[string]float64 {
+		return func() map[string]float64 {
+			samples := make(map[string]float64)
+			for name, st := range d.Stats() {
+				samples[name] = field(st)
+			}
+			return samples
+		}
+	}
+	total := func(field func(Stats) float64) func() float64 {
+		return func() float64 {
+			var sum float64
+			for _, st := range d.Stats() {
+				sum += field(st)
+			}
+			return sum
+		}
+	}
+	r.NewGaugeVecFunc("gokv_keys", "Number of keys, including expired keys not yet swept.", "db",
+		perDB(func(st Stats) float64 { return float64(st.Keys) }))
+	r.NewGaugeVecFunc("gokv_memory_bytes", "Estimated memory held by keys and values.", "db",
+		perDB(func(st Stats) float64 { return float64(st.Bytes) }))
+	r.NewCounterFunc("gokv_expired_keys_total", "Keys removed because their TTL passed.",
+		total(func(st Stats) float64 { return float64(st.Expired) }))
+}
@@ -0,0 +1,73 @@
+package store
+
+import "time"
+
+// entryOverhead approximates the per-key cost of the map entry, the B-tree
+// item and the Value header.
+const entryOverhead = 96
+
+// Stats summarises a store for monitoring.
+type Stats struct {
+	Keys int `json:"keys"`
+	// Bytes is an estimate of the memory held by keys and values.
+	Bytes int64 `json:"bytes"`
+	// Expired counts keys removed by the TTL sweep.
+	Expired uint64 `json:"expired"`
+}
+
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return Stats{Keys: len(s.data), Bytes: s.bytes, Expired: s.expired}
+}
+
+// entrySize estimates the memory used by one entry.
+func entrySize(key string, v Value) int64 {
+	return int64(entryOverhead + len(key) + dataSize(v.Data))
+}
+
+// ValueSize is the size of data as limited by the server: the length of a
+// string or binary value, or the estimated memory held by anything else.
+func ValueSize(data interface{}) int64 {
+	switch d := data.(type) {
+	case string:
+		return int64(len(d))
+	case []byte:
+		return int64(len(d))
+	case *Chunks:
+		return d.size
+	}
+	return int64(dataSize(data))
+}
+
+// dataSize estimates the size of a decoded JSON value without encoding it.
+func dataSize(data interface{}) int {
+	switch d := data.(type) {
+	case nil, bool:
+		return 8
+	case float64, int, int64, uint64:
+		return 8
+	case string:
+		return 16 + len(d)
+	case []byte:
+		return 24 + len(d)
+	case *Chunks:
+		return 40 + 24*len(d.parts) + int(d.size)
+	case []interface{}:
+		n := 24
+		for _, item := range d {
+			n += 16 + dataSize(item)
+		}
+		return n
+	case map[string]interface{}:
+		n := 48
+		for k, item := range d {
+			n += 32 + len(k) + dataSize(item)
+		}
+		return n
+	case time.Time:
+		return 24
+	}
+	return 16
+}
@@ -3,23 +3,66 @@ package store
 import (
 	"sync"
 	"time"
+
+	"github.com/google/btree"
 )
 
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]Value
+	mu       sync.RWMutex
+	version  uint64
+	data     map[string]Value
+	keys     *btree.BTreeG[string]
+	indexes  map[string]*index
+	watchers map[*Watcher]struct{}
+	bytes    int64
+	expired  uint64
+	stop     chan struct{}
+	once     sync.Once
 }
 
+// Value is a stored entry. A zero ExpiresAt means the entry never expires.
+// Version increases on every write to the store and, with ModifiedAt,
+// identifies a particular revision of the entry. ContentType is set for
+// binary values stored with a media type, whose Data is []byte. Flags is
+// opaque to the store and kept for memcached clients.
 type Value struct {
-	Data      interface{}
-	ExpiresAt time.Time
+	Data        interface{}
+	ContentType string `json:",omitempty"`
+	Flags       uint32 `json:",omitempty"`
+	ExpiresAt   time.Time
+	Version     uint64 `json:",omitempty"`
+	ModifiedAt  time.Time
+}
+
+func (v Value) Expired(now time.Time) bool {
+	return !v.ExpiresAt.IsZero() && now.After(v.ExpiresAt)
 }
 
+// ExpiresIn converts a TTL into an expiry time. A TTL of zero or less means
+// no expiry.
+func ExpiresIn(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+// DefaultSweepInterval is how often expired entries are removed.
+const DefaultSweepInterval = 30 * time.Second
+
 func New() *Store {
+	return NewWithSweep(DefaultSweepInterval)
+}
+
+// NewWithSweep is like New but removes expired entries every interval.
+func NewWithSweep(interval time.Duration) *Store {
 	s := &Store{
-		data: make(map[string]Value),
+		data:    make(map[string]Value),
+		keys:    newKeyIndex(),
+		indexes: make(map[string]*index),
+		stop:    make(chan struct{}),
 	}
-	s.StartTTLCleanup(30 * time.Second)
+	s.StartTTLCleanup(interval)
 	return s
 }
 
@@ -27,11 +70,10 @@ func (s *Store) Set(key string, value interface{}, ttl time.Duration) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	expiresAt := time.Now().Add(ttl)
-	s.data[key] = Value{
+	s.put(key, Value{
 		Data:      value,
-		ExpiresAt: expiresAt,
-	}
+		ExpiresAt: ExpiresIn(ttl),
+	})
 	return nil
 }
 
@@ -44,17 +86,65 @@ func (s *Store) Get(key string) (interface{}, bool) {
 		return nil, false
 	}
 
-	if time.Now().After(value.ExpiresAt) {
+	if value.Expired(time.Now()) {
 		return nil, false
 	}
 
 	return value.Data, true
 }
 
+// GetValue returns the live entry for key including its metadata.
+func (s *Store) GetValue(key string) (Value, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, exists := s.data[key]
+	if !exists || value.Expired(time.Now()) {
+		return Value{}, false
+	}
+	return value, true
+}
+
+// Update atomically replaces key with the result of fn, which receives the
+// current live entry. If fn returns an error nothing is written. Version and
+// ModifiedAt of the returned value are assigned by the store.
+func (s *Store) Update(key string, fn func(current Value, exists bool) (Value, error)) (Value, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.data[key]
+	if exists && current.Expired(time.Now()) {
+		current, exists = Value{}, false
+	}
+	next, err := fn(current, exists)
+	if err != nil {
+		return Value{}, err
+	}
+	s.put(key, next)
+	return s.data[key], nil
+}
+
+// DeleteIf atomically deletes key if check, given the current live entry,
+// returns nil.
+func (s *Store) DeleteIf(key string, check func(current Value, exists bool) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, exists := s.data[key]
+	if exists && current.Expired(time.Now()) {
+		current, exists = Value{}, false
+	}
+	if err := check(current, exists); err != nil {
+		return err
+	}
+	s.remove(key)
+	return nil
+}
+
 func (s *Store) Delete(key string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	delete(s.data, key)
+	s.remove(key)
 	return nil
 }
 
@@ -63,20 +153,37 @@ func (s *Store) StartTTLCleanup(interval time.Duration) {
 		ticker := time.NewTicker(interval)
 		defer ticker.Stop()
 
-		for range ticker.C {
-			s.cleanupExpired()
+		for {
+			select {
+			case <-ticker.C:
+				s.cleanupExpired()
+			case <-s.stop:
+				return
+			}
 		}
 	}()
 }
 
+// Close stops the TTL sweep. The store remains readable.
+func (s *Store) Close() {
+	s.once.Do(func() { close(s.stop) })
+}
+
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.data)
+}
+
 func (s *Store) cleanupExpired() {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
 	now := time.Now()
 	for key, value := range s.data {
-		if now.After(value.ExpiresAt) {
-			delete(s.data, key)
+		if value.Expired(now) {
+			s.removeAs(key, EventExpire)
+			s.expired++
 		}
 	}
 }
@@ -98,7 +205,83 @@ func (s *Store) SetAll(data map[string]Value) {
 	defer s.mu.Unlock()
 
 	s.data = make(map[string]Value, len(data))
+	s.bytes = 0
 	for k, v := range data {
 		s.data[k] = v
+		s.bytes += entrySize(k, v)
+		if v.Version > s.version {
+			s.version = v.Version
+		}
+	}
+	s.rebuildKeys()
+	s.rebuildIndexes()
+}
+
+// Expire sets a new TTL on an existing key. It reports false if the key does
+// not exist.
+func (s *Store) Expire(key string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.data[key]
+	if !ok || v.Expired(time.Now()) {
+		return false
+	}
+	v.ExpiresAt = ExpiresIn(ttl)
+	s.put(key, v)
+	return true
+}
+
+// Rename atomically moves src to dst, replacing any value at dst.
+func (s *Store) Rename(src, dst string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v, ok := s.data[src]
+	if !ok || v.Expired(time.Now()) {
+		return ErrNotFound
+	}
+	if src == dst {
+		return nil
+	}
+	s.remove(src)
+	s.put(dst, v)
+	return nil
+}
+
+// Copy atomically duplicates src into dst, keeping its expiry. Unless
+// replace is set it fails with ErrConflict when dst already exists.
+func (s *Store) Copy(src, dst string, replace bool) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	v, ok := s.data[src]
+	if !ok || v.Expired(now) {
+		return ErrNotFound
+	}
+	if existing, ok := s.data[dst]; ok && !replace && !existing.Expired(now) {
+		return ErrConflict
+	}
+	v.Data = copyData(v.Data)
+	s.put(dst, v)
+	return nil
+}
+
+func copyData(data interface{}) interface{} {
+	switch d := data.(type) {
+	case map[string]interface{}:
+		c := make(map[string]interface{}, len(d))
+		for k, v := range d {
+			c[k] = copyData(v)
+		}
+		return c
+	case []interface{}:
+		c := make([]interface{}, len(d))
+		for i, v := range d {
+			c[i] = copyData(v)
+		}
+		return c
 	}
+	return data
 }
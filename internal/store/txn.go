@@ -0,0 +1,36 @@
+package store
+
+import "time"
+
+// Tx reads and writes the store inside Atomic.
+type Tx struct {
+	s   *Store
+	now time.Time
+}
+
+// Atomic runs fn with the store locked, so that other readers and writers
+// see everything it does as a single change. Writes are not undone if fn
+// fails, so fn must make every check before its first write.
+func (s *Store) Atomic(fn func(tx *Tx) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return fn(&Tx{s: s, now: time.Now()})
+}
+
+// Get returns the live entry for key.
+func (tx *Tx) Get(key string) (Value, bool) {
+	v, exists := tx.s.data[key]
+	if !exists || v.Expired(tx.now) {
+		return Value{}, false
+	}
+	return v, true
+}
+
+// Put stores v under key, assigning its Version and ModifiedAt.
+func (tx *Tx) Put(key string, v Value) {
+	tx.s.put(key, v)
+}
+
+func (tx *Tx) Delete(key string) {
+	tx.s.remove(key)
+}
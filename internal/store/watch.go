@@ -0,0 +1,100 @@
+package store
+
+import (
+	"strings"
+	"sync"
+)
+
+// WatchBuffer is the number of events queued for each watcher. A watcher
+// that falls further behind is stopped, see Watcher.Lagged.
+const WatchBuffer = 1024
+
+// EventType is the kind of change an Event reports.
+type EventType string
+
+const (
+	EventSet    EventType = "set"
+	EventDelete EventType = "delete"
+	// EventExpire is sent when the TTL sweep removes an entry. Expired
+	// entries are hidden from readers before then, without an event.
+	EventExpire EventType = "expire"
+)
+
+// Event is one change to a key. Value is the new entry for EventSet and
+// empty otherwise.
+type Event struct {
+	Type  EventType
+	Key   string
+	Value Value
+}
+
+// Watcher receives the changes to the keys it watches, in the order they
+// were made. Restoring a snapshot with SetAll sends no events.
+type Watcher struct {
+	s      *Store
+	prefix string
+	match  func(key string) bool
+	events chan Event
+	once   sync.Once
+	// lagged is set, under s.mu, before events is closed for falling
+	// behind.
+	lagged bool
+}
+
+// Watch sends an event for every later change to a key starting with
+// prefix and, if match is not nil, for which match returns true. match is
+// called with the store locked and must not call back into it.
+func (s *Store) Watch(prefix string, match func(key string) bool) *Watcher {
+	w := &Watcher{s: s, prefix: prefix, match: match, events: make(chan Event, WatchBuffer)}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.watchers == nil {
+		s.watchers = make(map[*Watcher]struct{})
+	}
+	s.watchers[w] = struct{}{}
+	return w
+}
+
+// Events is closed by Stop, or when the watcher falls behind.
+func (w *Watcher) Events() <-chan Event {
+	return w.events
+}
+
+// Lagged reports whether Events was closed because the watcher fell more
+// than WatchBuffer events behind. Events were lost, so the caller should
+// read the keys again before watching anew.
+func (w *Watcher) Lagged() bool {
+	w.s.mu.RLock()
+	defer w.s.mu.RUnlock()
+	return w.lagged
+}
+
+// Stop unregisters the watcher and closes Events.
+func (w *Watcher) Stop() {
+	w.s.mu.Lock()
+	defer w.s.mu.Unlock()
+	w.close()
+}
+
+// close is called with s.mu held.
+func (w *Watcher) close() {
+	w.once.Do(func() {
+		delete(w.s.watchers, w)
+		close(w.events)
+	})
+}
+
+// notify sends e to the watchers of its key. Callers hold s.mu.
+func (s *Store) notify(e Event) {
+	for w := range s.watchers {
+		if !strings.HasPrefix(e.Key, w.prefix) || (w.match != nil && !w.match(e.Key)) {
+			continue
+		}
+		select {
+		case w.events <- e:
+		default:
+			w.lagged = true
+			w.close()
+		}
+	}
+}
@@ -0,0 +1,142 @@
+// Package tlsconfig builds server TLS configurations whose certificate is
+// reloaded from disk when the files change, so rotated certificates are
+// picked up without a restart.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+// Client certificate policies for Config.ClientAuth.
+const (
+	ClientAuthNone     = ""
+	ClientAuthOptional = "optional"
+	ClientAuthRequire  = "require"
+)
+
+// reloadInterval bounds how often the certificate files are checked for
+// changes.
+const reloadInterval = 10 * time.Second
+
+type Config struct {
+	CertFile string `json:"cert_file"`
+	KeyFile  string `json:"key_file"`
+	// ClientCAFile enables mutual TLS: client certificates are verified
+	// against the CAs in this PEM file.
+	ClientCAFile string `json:"client_ca_file,omitempty"`
+	// ClientAuth is "optional" to verify client certificates only when one
+	// is presented, or "require" (the default with a ClientCAFile) to
+	// refuse clients without one.
+	ClientAuth string `json:"client_auth,omitempty"`
+}
+
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != ""
+}
+
+// MutualTLS reports whether client certificates are verified.
+func (c Config) MutualTLS() bool {
+	return c.ClientCAFile != ""
+}
+
+// Server returns a TLS configuration serving the configured certificate.
+func (c Config) Server() (*tls.Config, error) {
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, errors.New("both a certificate and a key file are required")
+	}
+	r := &reloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.getCertificate,
+	}
+	if c.ClientCAFile != "" {
+		pool, err := LoadCertPool(c.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		cfg.ClientCAs = pool
+		switch c.ClientAuth {
+		case ClientAuthOptional:
+			cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		case ClientAuthNone, ClientAuthRequire:
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		default:
+			return nil, fmt.Errorf("unknown client_auth %q", c.ClientAuth)
+		}
+	}
+	return cfg, nil
+}
+
+// LoadCertPool reads the PEM certificates in filename.
+func LoadCertPool(filename string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", filename)
+	}
+	return pool, nil
+}
+
+type reloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time
+	checked time.Time
+}
+
+func (r *reloader) modified() (time.Time, error) {
+	var latest time.Time
+	for _, name := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(name)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+func (r *reloader) load() error {
+	modTime, err := r.modified()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return err
+	}
+	r.cert, r.modTime, r.checked = &cert, modTime, time.Now()
+	return nil
+}
+
+// getCertificate serves the current certificate, reloading it first if the
+// files changed. A failed reload, such as one that sees a half-written pair,
+// keeps serving the previous certificate and is retried later.
+func (r *reloader) getCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= reloadInterval {
+		r.checked = time.Now()
+		if modTime, err := r.modified(); err == nil && !modTime.Equal(r.modTime) {
+			r.load()
+		}
+	}
+	return r.cert, nil
+}
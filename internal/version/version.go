@@ -0,0 +1,7 @@
+// Package version identifies the running build.
+package version
+
+// Version is set at build time with
+//
+//	-ldflags "-X github.com/umgbhalla/gokv/internal/version.Version=v1.2.3"
+var Version = "dev"
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// DefaultContentType is used by SetBytes and SetReader when no content type
+// is given.
+const DefaultContentType = "application/octet-stream"
+
+// SetBytes stores data as a binary value. Get and GetBytes return it with
+// contentType.
+func (c *Client) SetBytes(key string, data []byte, contentType string, ttl time.Duration) error {
+	return c.SetReader(key, bytes.NewReader(data), contentType, ttl)
+}
+
+// SetReader is like SetBytes but streams the value from body. If body is a
+// *bytes.Reader, *bytes.Buffer or *strings.Reader its length is sent up
+// front and the server reads it into a single buffer.
+func (c *Client) SetReader(key string, body io.Reader, contentType string, ttl time.Duration) error {
+	if contentType == "" {
+		contentType = DefaultContentType
+	}
+	req, err := http.NewRequest("PUT", c.keyURL(key), body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if ttl > 0 {
+		req.Header.Set("X-Gokv-TTL", ttl.String())
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
+		return c.handleErrorResponse(resp)
+	}
+	return nil
+}
+
+// GetReader streams the value of key. Binary values are returned as stored,
+// with their content type; any other value is encoded in the client's
+// encoding. The caller must close the reader.
+func (c *Client) GetReader(key string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequest("GET", c.keyURL(key), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	enc, err := c.codec()
+	if err != nil {
+		return nil, "", err
+	}
+	req.Header.Set("Accept", DefaultContentType+", "+enc.ContentType()+";q=0.9")
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		return nil, "", c.handleErrorResponse(resp)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// GetRange reads length bytes of a binary value starting at offset. A
+// negative length reads to the end. Fewer bytes are returned if the value
+// ends first.
+func (c *Client) GetRange(key string, offset, length int64) ([]byte, error) {
+	if length == 0 {
+		return []byte{}, nil
+	}
+	req, err := http.NewRequest("GET", c.keyURL(key), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", DefaultContentType)
+	if length < 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+	} else {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", offset, offset+length-1))
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		return io.ReadAll(resp.Body)
+	case http.StatusRequestedRangeNotSatisfiable:
+		return []byte{}, nil
+	case http.StatusOK:
+		// Ranges are only served for binary values.
+		return nil, &Error{StatusCode: resp.StatusCode, Code: "WRONG_TYPE", Message: "value is not binary",
+			RequestID: resp.Header.Get("X-Request-ID")}
+	}
+	return nil, c.handleErrorResponse(resp)
+}
+
+// GetBytes is like GetReader but reads the whole value.
+func (c *Client) GetBytes(key string) ([]byte, string, error) {
+	body, contentType, err := c.GetReader(key)
+	if err != nil {
+		return nil, "", err
+	}
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
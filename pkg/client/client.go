@@ -2,116 +2,221 @@ package client
 
 import (
 	"bytes"
-	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
+	"net/url"
 	"time"
+
+	"github.com/umgbhalla/gokv/internal/codec"
 )
 
 type Client struct {
 	baseURL    string
+	db         string
+	apiKey     string
+	token      string
 	httpClient *http.Client
-	logger     *log.Logger
+	logger     *slog.Logger
+	encoding   Encoding
 }
 
+// Encoding is the format values are sent and received in.
+type Encoding string
+
+const (
+	EncodingJSON        Encoding = "json"
+	EncodingMessagePack Encoding = "msgpack"
+	EncodingCBOR        Encoding = "cbor"
+)
+
 func New(baseURL string) *Client {
 	return &Client{
 		baseURL: baseURL,
 		httpClient: &http.Client{
 			Timeout: time.Second * 10,
 		},
-		logger: log.New(log.Writer(), "GoKV Client: ", log.LstdFlags),
+		logger:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+		encoding: EncodingJSON,
 	}
 }
 
-func (c *Client) Get(key string) (interface{}, error) {
-	c.logger.Printf("Getting value for key: %s", key)
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s/get/%s", c.baseURL, key))
+// DB returns a client that addresses the named logical database on the same
+// server.
+func (c *Client) DB(name string) *Client {
+	db := *c
+	db.db = name
+	return &db
+}
+
+// WithAPIKey returns a client that authenticates with a static API key.
+func (c *Client) WithAPIKey(key string) *Client {
+	authed := *c
+	authed.apiKey = key
+	return &authed
+}
+
+// WithToken returns a client that authenticates with a bearer token such as
+// a JWT.
+func (c *Client) WithToken(token string) *Client {
+	authed := *c
+	authed.token = token
+	return &authed
+}
+
+// WithLogger returns a client that logs each request to l at debug level.
+// Clients log nothing by default.
+func (c *Client) WithLogger(l *slog.Logger) *Client {
+	logged := *c
+	logged.logger = l
+	return &logged
+}
+
+// WithEncoding returns a client that sends and asks for values in e.
+// MessagePack and CBOR carry []byte values natively; through JSON they are
+// base64 strings.
+func (c *Client) WithEncoding(e Encoding) *Client {
+	encoded := *c
+	encoded.encoding = e
+	return &encoded
+}
+
+func (c *Client) codec() (codec.Codec, error) {
+	return codec.ByName(string(c.encoding))
+}
+
+// do sends req with the client's credentials, asking for a response in the
+// client's encoding unless req says otherwise.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	enc, err := c.codec()
 	if err != nil {
-		c.logger.Printf("Error getting value for key %s: %v", key, err)
 		return nil, err
 	}
-	defer resp.Body.Close()
+	if req.Header.Get("Accept") == "" {
+		req.Header.Set("Accept", enc.ContentType())
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-API-Key", c.apiKey)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+	start := time.Now()
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		c.logger.Debug("gokv request failed", "method", req.Method, "url", req.URL.String(), "error", err)
+		return nil, err
+	}
+	c.logger.Debug("gokv request", "method", req.Method, "url", req.URL.String(), "status", resp.StatusCode,
+		"duration", time.Since(start), "request_id", resp.Header.Get("X-Request-ID"))
+	return resp, nil
+}
 
-	if resp.StatusCode == http.StatusNotFound {
-		c.logger.Printf("Key not found: %s", key)
-		return nil, fmt.Errorf("key not found")
+func (c *Client) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
 	}
+	return c.do(req)
+}
+
+// dbPath is the path segment selecting the client's database, if any.
+func (c *Client) dbPath() string {
+	if c.db == "" {
+		return ""
+	}
+	return "/db/" + url.PathEscape(c.db)
+}
+
+func (c *Client) keyURL(key string) string {
+	return fmt.Sprintf("%s/v1%s/keys/%s", c.baseURL, c.dbPath(), url.PathEscape(key))
+}
+
+// Get returns the value of key. Binary values stored with a content type
+// are returned as []byte.
+func (c *Client) Get(key string) (interface{}, error) {
+	resp, err := c.get(c.keyURL(key))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		return nil, c.handleErrorResponse(resp)
 	}
+	if _, ok := codec.ForContentType(resp.Header.Get("Content-Type")); !ok {
+		return io.ReadAll(resp.Body)
+	}
 
-	var result map[string]interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.logger.Printf("Error decoding response for key %s: %v", key, err)
+	var result interface{}
+	if err := decodeResponse(resp, &result); err != nil {
 		return nil, err
 	}
 
-	c.logger.Printf("Successfully retrieved value for key: %s", key)
-	return result["value"], nil
+	return result, nil
 }
 
+// Set stores value in the client's encoding. A []byte value is stored with
+// SetBytes, so that it reads back as []byte whatever the encoding.
 func (c *Client) Set(key string, value interface{}, ttl time.Duration) error {
-	c.logger.Printf("Setting value for key: %s", key)
-	data := map[string]interface{}{
-		"key":   key,
-		"value": value,
+	if data, ok := value.([]byte); ok {
+		return c.SetBytes(key, data, "", ttl)
 	}
-	if ttl > 0 {
-		data["ttl"] = ttl.Seconds()
+	enc, err := c.codec()
+	if err != nil {
+		return err
+	}
+	data, err := enc.Marshal(value)
+	if err != nil {
+		return err
 	}
 
-	jsonData, err := json.Marshal(data)
+	req, err := http.NewRequest("PUT", c.keyURL(key), bytes.NewBuffer(data))
 	if err != nil {
-		c.logger.Printf("Error marshaling data for key %s: %v", key, err)
 		return err
 	}
+	req.Header.Set("Content-Type", enc.ContentType())
+	if ttl > 0 {
+		req.Header.Set("X-Gokv-TTL", ttl.String())
+	}
 
-	resp, err := c.httpClient.Post(fmt.Sprintf("%s/set", c.baseURL), "application/json", bytes.NewBuffer(jsonData))
+	resp, err := c.do(req)
 	if err != nil {
-		c.logger.Printf("Error setting value for key %s: %v", key, err)
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent {
 		return c.handleErrorResponse(resp)
 	}
 
-	c.logger.Printf("Successfully set value for key: %s", key)
 	return nil
 }
 
 func (c *Client) Delete(key string) error {
-	c.logger.Printf("Deleting key: %s", key)
-	req, err := http.NewRequest("DELETE", fmt.Sprintf("%s/delete/%s", c.baseURL, key), nil)
+	req, err := http.NewRequest("DELETE", c.keyURL(key), nil)
 	if err != nil {
-		c.logger.Printf("Error creating delete request for key %s: %v", key, err)
 		return err
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		c.logger.Printf("Error deleting key %s: %v", key, err)
 		return err
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
+	// Deleting a missing key is not an error.
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusNotFound {
 		return c.handleErrorResponse(resp)
 	}
 
-	c.logger.Printf("Successfully deleted key: %s", key)
 	return nil
 }
 
 func (c *Client) Query(queryString string) (interface{}, error) {
-	c.logger.Printf("Executing query: %s", queryString)
-	resp, err := c.httpClient.Get(fmt.Sprintf("%s/query?q=%s", c.baseURL, queryString))
+	resp, err := c.get(fmt.Sprintf("%s%s/query?q=%s", c.baseURL, c.dbPath(), url.QueryEscape(queryString)))
 	if err != nil {
-		c.logger.Printf("Error executing query: %v", err)
 		return nil, err
 	}
 	defer resp.Body.Close()
@@ -121,23 +226,36 @@ func (c *Client) Query(queryString string) (interface{}, error) {
 	}
 
 	var result interface{}
-	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
-		c.logger.Printf("Error decoding query response: %v", err)
+	if err := decodeResponse(resp, &result); err != nil {
 		return nil, err
 	}
 
-	c.logger.Printf("Successfully executed query")
 	return result, nil
 }
 
+// handleErrorResponse turns a failed response into an *Error. Legacy routes
+// answer {"error": ..., "code": ...}; /v1 routes answer problem+json.
 func (c *Client) handleErrorResponse(resp *http.Response) error {
-	var errorResp map[string]string
-	if err := json.NewDecoder(resp.Body).Decode(&errorResp); err == nil {
-		if errorMsg, ok := errorResp["error"]; ok {
-			c.logger.Printf("Server error: %s", errorMsg)
-			return fmt.Errorf("server error: %s", errorMsg)
+	apiErr := &Error{StatusCode: resp.StatusCode, RequestID: resp.Header.Get("X-Request-ID")}
+	var errorResp map[string]interface{}
+	if err := decodeResponse(resp, &errorResp); err == nil {
+		for _, field := range []string{"error", "detail"} {
+			if errorMsg, ok := errorResp[field].(string); ok {
+				apiErr.Message = errorMsg
+				break
+			}
 		}
+		apiErr.Code, _ = errorResp["code"].(string)
+	}
+	return apiErr
+}
+
+// decodeResponse reads the body of resp into v with the codec its
+// Content-Type names.
+func decodeResponse(resp *http.Response, v interface{}) error {
+	enc, ok := codec.ForContentType(resp.Header.Get("Content-Type"))
+	if !ok {
+		return fmt.Errorf("unexpected Content-Type %q", resp.Header.Get("Content-Type"))
 	}
-	c.logger.Printf("Unexpected status code: %d", resp.StatusCode)
-	return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	return enc.Decode(resp.Body, v)
 }
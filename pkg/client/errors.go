@@ -0,0 +1,62 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Sentinel errors for use with errors.Is on an *Error.
+var (
+	ErrNotFound           = errors.New("not found")
+	ErrBadRequest         = errors.New("bad request")
+	ErrWrongType          = errors.New("wrong type")
+	ErrConflict           = errors.New("conflict")
+	ErrPreconditionFailed = errors.New("precondition failed")
+	ErrUnauthorized       = errors.New("unauthorized")
+	ErrPermissionDenied   = errors.New("permission denied")
+	ErrTooLarge           = errors.New("too large")
+)
+
+// Error is a failed request as reported by the server. Code is the server's
+// error code, such as PARSE_ERROR or NOT_FOUND, when it sent one.
+// RequestID is the ID the server logged the request under. Errors from the
+// gRPC API have no StatusCode or RequestID.
+type Error struct {
+	StatusCode int
+	Code       string
+	Message    string
+	RequestID  string
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" {
+		return fmt.Sprintf("unexpected status code: %d", e.StatusCode)
+	}
+	if e.Code == "" {
+		return fmt.Sprintf("server error: %s", e.Message)
+	}
+	return fmt.Sprintf("server error: %s (%s)", e.Message, e.Code)
+}
+
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == "NOT_FOUND" || e.StatusCode == http.StatusNotFound
+	case ErrBadRequest:
+		return e.StatusCode == http.StatusBadRequest || e.Code == "PARSE_ERROR" || e.Code == "INVALID_ARGUMENT"
+	case ErrWrongType:
+		return e.Code == "WRONG_TYPE"
+	case ErrConflict:
+		return e.Code == "CONFLICT" || e.StatusCode == http.StatusConflict
+	case ErrPreconditionFailed:
+		return e.StatusCode == http.StatusPreconditionFailed
+	case ErrUnauthorized:
+		return e.StatusCode == http.StatusUnauthorized || e.Code == "UNAUTHENTICATED"
+	case ErrPermissionDenied:
+		return e.Code == "PERMISSION_DENIED" || e.StatusCode == http.StatusForbidden
+	case ErrTooLarge:
+		return e.Code == "TOO_LARGE" || e.StatusCode == http.StatusRequestEntityTooLarge
+	}
+	return false
+}
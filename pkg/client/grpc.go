@@ -0,0 +1,469 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"io"
+	"time"
+
+	"github.com/umgbhalla/gokv/api/grpc/kvrpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Item is a value with its version, content type and expiry, as returned by
+// the gRPC API. Binary values are []byte.
+type Item struct {
+	Value       interface{}
+	ContentType string
+	Version     uint64
+	ExpiresAt   *time.Time
+}
+
+func itemFrom(e *kvrpc.Entry) *Item {
+	if e == nil {
+		return nil
+	}
+	item := &Item{Value: e.Value.AsInterface(), ContentType: e.Value.GetContentType(), Version: e.Version}
+	if e.ExpiresAt != nil {
+		expiresAt := e.ExpiresAt.AsTime()
+		item.ExpiresAt = &expiresAt
+	}
+	return item
+}
+
+// toValue converts v for the gRPC API. A []byte is a binary value; types
+// structpb does not take, such as structs, go through JSON as they would
+// over HTTP.
+func toValue(v interface{}) (*kvrpc.Value, error) {
+	if value, err := kvrpc.NewValue(v); err == nil {
+		return value, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return kvrpc.NewValue(doc)
+}
+
+func setRequest(key string, value interface{}, contentType string, ttl time.Duration) (*kvrpc.SetRequest, error) {
+	v, err := toValue(value)
+	if err != nil {
+		return nil, err
+	}
+	v.ContentType = contentType
+	req := &kvrpc.SetRequest{Key: key, Value: v}
+	if ttl != 0 {
+		req.Ttl = durationpb.New(ttl)
+	}
+	return req, nil
+}
+
+// GRPCClient calls the gRPC API, which takes values as they are, without
+// going through JSON. Copies made with DB, WithAPIKey and WithToken share
+// its connection.
+type GRPCClient struct {
+	conn   *grpc.ClientConn
+	kv     kvrpc.KVClient
+	db     string
+	apiKey string
+	token  string
+}
+
+// DialGRPC connects to the gRPC API at target, such as "localhost:9090",
+// over TLS with cfg or in plain text if cfg is nil. The connection is made
+// lazily, on the first call.
+func DialGRPC(target string, cfg *tls.Config, opts ...grpc.DialOption) (*GRPCClient, error) {
+	creds := insecure.NewCredentials()
+	if cfg != nil {
+		creds = credentials.NewTLS(cfg)
+	}
+	opts = append([]grpc.DialOption{grpc.WithTransportCredentials(creds)}, opts...)
+	conn, err := grpc.NewClient(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GRPCClient{conn: conn, kv: kvrpc.NewKVClient(conn)}, nil
+}
+
+// Close closes the connection shared by c and its copies.
+func (c *GRPCClient) Close() error {
+	return c.conn.Close()
+}
+
+// DB returns a client that addresses the named logical database.
+func (c *GRPCClient) DB(name string) *GRPCClient {
+	db := *c
+	db.db = name
+	return &db
+}
+
+// WithAPIKey returns a client that authenticates with a static API key.
+func (c *GRPCClient) WithAPIKey(key string) *GRPCClient {
+	authed := *c
+	authed.apiKey = key
+	return &authed
+}
+
+// WithToken returns a client that authenticates with a bearer token such as
+// a JWT.
+func (c *GRPCClient) WithToken(token string) *GRPCClient {
+	authed := *c
+	authed.token = token
+	return &authed
+}
+
+// outgoing adds the client's database and credentials to ctx.
+func (c *GRPCClient) outgoing(ctx context.Context) context.Context {
+	var kv []string
+	if c.db != "" {
+		kv = append(kv, kvrpc.MetadataDB, c.db)
+	}
+	if c.apiKey != "" {
+		kv = append(kv, "x-api-key", c.apiKey)
+	}
+	if c.token != "" {
+		kv = append(kv, "authorization", "Bearer "+c.token)
+	}
+	if len(kv) == 0 {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, kv...)
+}
+
+// Get returns the value of key. Binary values are returned as []byte.
+func (c *GRPCClient) Get(ctx context.Context, key string) (interface{}, error) {
+	item, err := c.GetItem(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return item.Value, nil
+}
+
+// GetItem is like Get but also returns the version, content type and
+// expiry of the value.
+func (c *GRPCClient) GetItem(ctx context.Context, key string) (*Item, error) {
+	var trailer metadata.MD
+	e, err := c.kv.Get(c.outgoing(ctx), &kvrpc.GetRequest{Key: key}, grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, grpcError(err, trailer)
+	}
+	return itemFrom(e), nil
+}
+
+// Set stores value, returning its new version. A []byte value is stored as
+// a binary value.
+func (c *GRPCClient) Set(ctx context.Context, key string, value interface{}, ttl time.Duration) (uint64, error) {
+	req, err := setRequest(key, value, "", ttl)
+	if err != nil {
+		return 0, err
+	}
+	return c.set(ctx, req)
+}
+
+// SetBytes stores data as a binary value with contentType.
+func (c *GRPCClient) SetBytes(ctx context.Context, key string, data []byte, contentType string, ttl time.Duration) (uint64, error) {
+	req, err := setRequest(key, data, contentType, ttl)
+	if err != nil {
+		return 0, err
+	}
+	return c.set(ctx, req)
+}
+
+// SetIfVersion is like Set but only writes while key is at version, zero
+// meaning key must not exist. Otherwise it fails with ErrConflict.
+func (c *GRPCClient) SetIfVersion(ctx context.Context, key string, value interface{}, ttl time.Duration, version uint64) (uint64, error) {
+	req, err := setRequest(key, value, "", ttl)
+	if err != nil {
+		return 0, err
+	}
+	req.IfVersion = &version
+	return c.set(ctx, req)
+}
+
+func (c *GRPCClient) set(ctx context.Context, req *kvrpc.SetRequest) (uint64, error) {
+	var trailer metadata.MD
+	resp, err := c.kv.Set(c.outgoing(ctx), req, grpc.Trailer(&trailer))
+	if err != nil {
+		return 0, grpcError(err, trailer)
+	}
+	return resp.Version, nil
+}
+
+// Delete deletes key, reporting whether it existed.
+func (c *GRPCClient) Delete(ctx context.Context, key string) (bool, error) {
+	return c.delete(ctx, &kvrpc.DeleteRequest{Key: key})
+}
+
+// DeleteIfVersion is like Delete but only deletes key while it is at
+// version. Otherwise it fails with ErrConflict.
+func (c *GRPCClient) DeleteIfVersion(ctx context.Context, key string, version uint64) (bool, error) {
+	return c.delete(ctx, &kvrpc.DeleteRequest{Key: key, IfVersion: &version})
+}
+
+func (c *GRPCClient) delete(ctx context.Context, req *kvrpc.DeleteRequest) (bool, error) {
+	var trailer metadata.MD
+	resp, err := c.kv.Delete(c.outgoing(ctx), req, grpc.Trailer(&trailer))
+	if err != nil {
+		return false, grpcError(err, trailer)
+	}
+	return resp.Deleted, nil
+}
+
+// Op is one operation of a Batch; see GetOp, SetOp and DeleteOp.
+type Op struct {
+	op *kvrpc.Op
+	// err is why the op could not be made, returned by Batch.
+	err error
+}
+
+func GetOp(key string) Op {
+	return Op{op: &kvrpc.Op{Op: &kvrpc.Op_Get{Get: &kvrpc.GetRequest{Key: key}}}}
+}
+
+func SetOp(key string, value interface{}, ttl time.Duration) Op {
+	req, err := setRequest(key, value, "", ttl)
+	if err != nil {
+		return Op{err: err}
+	}
+	return Op{op: &kvrpc.Op{Op: &kvrpc.Op_Set{Set: req}}}
+}
+
+func DeleteOp(key string) Op {
+	return Op{op: &kvrpc.Op{Op: &kvrpc.Op_Delete{Delete: &kvrpc.DeleteRequest{Key: key}}}}
+}
+
+// BatchResult is the outcome of one Op: Item for a get, Version for a set
+// and Deleted for a delete, or Err if it failed.
+type BatchResult struct {
+	Item    *Item
+	Version uint64
+	Deleted bool
+	Err     error
+}
+
+func batchResult(r *kvrpc.Result) BatchResult {
+	res := BatchResult{
+		Item:    itemFrom(r.GetEntry()),
+		Version: r.GetSet().GetVersion(),
+		Deleted: r.GetDelete().GetDeleted(),
+	}
+	if e := r.GetError(); e != nil {
+		res.Err = &Error{Code: e.Code, Message: e.Message}
+	}
+	return res
+}
+
+// Batch runs ops in one call. They run in order but each on its own, so
+// one failing does not stop the rest; the error returned is only for the
+// call as a whole, or for an op that could not be made.
+func (c *GRPCClient) Batch(ctx context.Context, ops []Op) ([]BatchResult, error) {
+	req := &kvrpc.BatchRequest{Ops: make([]*kvrpc.Op, len(ops))}
+	for i, op := range ops {
+		if op.err != nil {
+			return nil, op.err
+		}
+		req.Ops[i] = op.op
+	}
+	var trailer metadata.MD
+	resp, err := c.kv.Batch(c.outgoing(ctx), req, grpc.Trailer(&trailer))
+	if err != nil {
+		return nil, grpcError(err, trailer)
+	}
+	results := make([]BatchResult, len(resp.Results))
+	for i, r := range resp.Results {
+		results[i] = batchResult(r)
+	}
+	return results, nil
+}
+
+// WatchEvent is one change seen by a Watch: Type is "set", "delete" or
+// "expire", and Item is the new item of a set.
+type WatchEvent struct {
+	Type string
+	Key  string
+	Item *Item
+}
+
+var eventTypes = map[kvrpc.EventType]string{
+	kvrpc.EventType_EVENT_TYPE_SET:    "set",
+	kvrpc.EventType_EVENT_TYPE_DELETE: "delete",
+	kvrpc.EventType_EVENT_TYPE_EXPIRE: "expire",
+}
+
+// Watch follows the changes to the keys starting with prefix.
+type Watch struct {
+	stream grpc.ServerStreamingClient[kvrpc.WatchEvent]
+}
+
+// Watch starts following the changes to the keys starting with prefix
+// until ctx is cancelled. Every change made after it returns is seen.
+func (c *GRPCClient) Watch(ctx context.Context, prefix string) (*Watch, error) {
+	return c.watch(ctx, &kvrpc.WatchRequest{Prefix: prefix})
+}
+
+// WatchMatch is like Watch but follows the keys matching a glob pattern
+// such as "user:*:session".
+func (c *GRPCClient) WatchMatch(ctx context.Context, pattern string) (*Watch, error) {
+	return c.watch(ctx, &kvrpc.WatchRequest{Match: pattern})
+}
+
+// WatchRegex is like Watch but follows the keys matching an RE2 regular
+// expression.
+func (c *GRPCClient) WatchRegex(ctx context.Context, expr string) (*Watch, error) {
+	return c.watch(ctx, &kvrpc.WatchRequest{Regex: expr})
+}
+
+func (c *GRPCClient) watch(ctx context.Context, req *kvrpc.WatchRequest) (*Watch, error) {
+	stream, err := c.kv.Watch(c.outgoing(ctx), req)
+	if err != nil {
+		return nil, grpcError(err, nil)
+	}
+	// The server sends its headers once it is watching, and none if the
+	// watch failed, whose error Recv returns.
+	md, err := stream.Header()
+	if err == nil && md == nil {
+		_, err = stream.Recv()
+	}
+	if err != nil {
+		return nil, grpcError(err, stream.Trailer())
+	}
+	return &Watch{stream: stream}, nil
+}
+
+// Next waits for the next change. A watch that falls too far behind fails
+// with the code WATCH_LAGGED, after which the keys should be read again.
+func (w *Watch) Next() (*WatchEvent, error) {
+	e, err := w.stream.Recv()
+	if err != nil {
+		return nil, grpcError(err, w.stream.Trailer())
+	}
+	return &WatchEvent{Type: eventTypes[e.Type], Key: e.Key, Item: itemFrom(e.Entry)}, nil
+}
+
+// Txn is an optimistic transaction. Its reads see its own writes, which
+// are sent to the server but only applied by Commit, atomically and only
+// if no key read has changed since. Otherwise Commit fails with
+// ErrConflict and the transaction can be retried.
+//
+// After Commit or Rollback the Txn starts a new transaction. It is not
+// safe for concurrent use.
+type Txn struct {
+	stream grpc.BidiStreamingClient[kvrpc.Op, kvrpc.Result]
+	cancel context.CancelFunc
+}
+
+// Txn opens a stream of transactions, which lasts until Close or until ctx
+// is cancelled.
+func (c *GRPCClient) Txn(ctx context.Context) (*Txn, error) {
+	ctx, cancel := context.WithCancel(c.outgoing(ctx))
+	stream, err := c.kv.Txn(ctx)
+	if err != nil {
+		cancel()
+		return nil, grpcError(err, nil)
+	}
+	return &Txn{stream: stream, cancel: cancel}, nil
+}
+
+func (t *Txn) do(op *kvrpc.Op) (*kvrpc.Result, error) {
+	if err := t.stream.Send(op); err != nil {
+		// The reason the stream ended is reported by Recv.
+		if _, err := t.stream.Recv(); err != nil {
+			return nil, grpcError(err, t.stream.Trailer())
+		}
+		return nil, err
+	}
+	res, err := t.stream.Recv()
+	if err != nil {
+		return nil, grpcError(err, t.stream.Trailer())
+	}
+	if e := res.GetError(); e != nil {
+		return nil, &Error{Code: e.Code, Message: e.Message}
+	}
+	return res, nil
+}
+
+// Get returns the value of key as seen by the transaction.
+func (t *Txn) Get(key string) (interface{}, error) {
+	res, err := t.do(GetOp(key).op)
+	if err != nil {
+		return nil, err
+	}
+	return res.GetEntry().GetValue().AsInterface(), nil
+}
+
+func (t *Txn) Set(key string, value interface{}, ttl time.Duration) error {
+	op := SetOp(key, value, ttl)
+	if op.err != nil {
+		return op.err
+	}
+	_, err := t.do(op.op)
+	return err
+}
+
+func (t *Txn) Delete(key string) error {
+	_, err := t.do(DeleteOp(key).op)
+	return err
+}
+
+func (t *Txn) Commit() error {
+	_, err := t.do(&kvrpc.Op{Op: &kvrpc.Op_Commit{Commit: &kvrpc.Commit{}}})
+	return err
+}
+
+func (t *Txn) Rollback() error {
+	_, err := t.do(&kvrpc.Op{Op: &kvrpc.Op_Rollback{Rollback: &kvrpc.Rollback{}}})
+	return err
+}
+
+// Close ends the stream, discarding a transaction not yet committed.
+func (t *Txn) Close() error {
+	defer t.cancel()
+	if err := t.stream.CloseSend(); err != nil {
+		return err
+	}
+	if _, err := t.stream.Recv(); err != io.EOF {
+		return grpcError(err, t.stream.Trailer())
+	}
+	return nil
+}
+
+// grpcCodes maps status codes to error codes for failures the server did
+// not classify, such as those of the connection.
+var grpcCodes = map[codes.Code]string{
+	codes.InvalidArgument:  "INVALID_ARGUMENT",
+	codes.NotFound:         "NOT_FOUND",
+	codes.PermissionDenied: "PERMISSION_DENIED",
+	codes.Unauthenticated:  "UNAUTHENTICATED",
+	codes.Unavailable:      "UNAVAILABLE",
+	codes.Canceled:         "CANCELED",
+}
+
+// grpcError converts a failed call into an *Error, with the code from the
+// call's trailer if the server sent one. Context errors are returned as
+// they are.
+func grpcError(err error, trailer metadata.MD) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	apiErr := &Error{Code: grpcCodes[st.Code()], Message: st.Message()}
+	if code := trailer.Get(kvrpc.MetadataCode); len(code) > 0 {
+		apiErr.Code = code[0]
+	}
+	return apiErr
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/umgbhalla/gokv/internal/codec"
+)
+
+type Entry struct {
+	Key   string      `json:"key"`
+	Value interface{} `json:"value"`
+}
+
+// Page is one batch of keys returned by Keys. An empty Cursor means there
+// are no more pages.
+type Page struct {
+	Cursor  string  `json:"cursor"`
+	Entries []Entry `json:"entries"`
+}
+
+// Keys fetches a single page of entries under prefix. Pass the empty cursor
+// to start and the returned Page.Cursor to continue.
+func (c *Client) Keys(prefix, cursor string, limit int) (*Page, error) {
+	return c.keys(url.Values{"prefix": {prefix}}, cursor, limit)
+}
+
+// KeysMatch is like Keys but selects keys with a glob pattern such as
+// "user:*:session".
+func (c *Client) KeysMatch(pattern, cursor string, limit int) (*Page, error) {
+	return c.keys(url.Values{"match": {pattern}}, cursor, limit)
+}
+
+func (c *Client) keys(params url.Values, cursor string, limit int) (*Page, error) {
+	if cursor != "" {
+		params.Set("cursor", cursor)
+	}
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+
+	resp, err := c.get(fmt.Sprintf("%s%s/keys?%s", c.baseURL, c.dbPath(), params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, c.handleErrorResponse(resp)
+	}
+
+	var page Page
+	if err := decodeResponse(resp, &page); err != nil {
+		return nil, err
+	}
+	// Values decoded into the struct keep the binary codecs' integer types.
+	for i := range page.Entries {
+		if page.Entries[i].Value, err = codec.Normalize(page.Entries[i].Value); err != nil {
+			return nil, err
+		}
+	}
+	return &page, nil
+}
+
+// ScanIterator walks every entry under a prefix, fetching pages on demand.
+//
+//	it := c.Scan("user:", 500)
+//	for it.Next() {
+//		e := it.Entry()
+//	}
+//	if err := it.Err(); err != nil { ... }
+type ScanIterator struct {
+	fetch   func(cursor string, limit int) (*Page, error)
+	limit   int
+	cursor  string
+	entries []Entry
+	current Entry
+	done    bool
+	err     error
+}
+
+func (c *Client) Scan(prefix string, pageSize int) *ScanIterator {
+	fetch := func(cursor string, limit int) (*Page, error) {
+		return c.Keys(prefix, cursor, limit)
+	}
+	return &ScanIterator{fetch: fetch, limit: pageSize}
+}
+
+// ScanMatch iterates over every key matching a glob pattern.
+func (c *Client) ScanMatch(pattern string, pageSize int) *ScanIterator {
+	fetch := func(cursor string, limit int) (*Page, error) {
+		return c.KeysMatch(pattern, cursor, limit)
+	}
+	return &ScanIterator{fetch: fetch, limit: pageSize}
+}
+
+func (it *ScanIterator) Next() bool {
+	for len(it.entries) == 0 {
+		if it.done || it.err != nil {
+			return false
+		}
+		page, err := it.fetch(it.cursor, it.limit)
+		if err != nil {
+			it.err = err
+			return false
+		}
+		it.entries = page.Entries
+		it.cursor = page.Cursor
+		it.done = page.Cursor == ""
+	}
+	it.current = it.entries[0]
+	it.entries = it.entries[1:]
+	return true
+}
+
+func (it *ScanIterator) Entry() Entry {
+	return it.current
+}
+
+func (it *ScanIterator) Err() error {
+	return it.err
+}
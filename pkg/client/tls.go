@@ -0,0 +1,57 @@
+package client
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// WithCACert returns a client that trusts the server certificates signed by
+// the CAs in the PEM file, instead of the system roots.
+func (c *Client) WithCACert(caFile string) (*Client, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no certificates found in %s", caFile)
+	}
+	return c.withTLS(func(cfg *tls.Config) {
+		cfg.RootCAs = pool
+	}), nil
+}
+
+// WithClientCert returns a client that presents the certificate in certFile
+// for mutual TLS.
+func (c *Client) WithClientCert(certFile, keyFile string) (*Client, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return c.withTLS(func(cfg *tls.Config) {
+		cfg.Certificates = []tls.Certificate{cert}
+	}), nil
+}
+
+// withTLS returns a copy of c with its own transport, whose TLS
+// configuration is changed by fn.
+func (c *Client) withTLS(fn func(cfg *tls.Config)) *Client {
+	transport, ok := c.httpClient.Transport.(*http.Transport)
+	if !ok {
+		transport = http.DefaultTransport.(*http.Transport)
+	}
+	transport = transport.Clone()
+	if transport.TLSClientConfig == nil {
+		transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	fn(transport.TLSClientConfig)
+
+	httpClient := *c.httpClient
+	httpClient.Transport = transport
+	tlsClient := *c
+	tlsClient.httpClient = &httpClient
+	return &tlsClient
+}